@@ -3,13 +3,17 @@ package main
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/Shobayosamuel/tap-me/config"
 	"github.com/Shobayosamuel/tap-me/internal/auth"
 	"github.com/Shobayosamuel/tap-me/internal/chat"
+	"github.com/Shobayosamuel/tap-me/internal/docs"
 	"github.com/Shobayosamuel/tap-me/internal/middleware"
 	"github.com/Shobayosamuel/tap-me/internal/models"
 	"github.com/Shobayosamuel/tap-me/internal/repository"
+	"github.com/Shobayosamuel/tap-me/internal/storage"
+	"github.com/Shobayosamuel/tap-me/internal/unfurl"
 	"github.com/Shobayosamuel/tap-me/internal/ws"
 	"github.com/gin-gonic/gin"
 	"gorm.io/driver/postgres"
@@ -24,32 +28,86 @@ func main() {
 	db := setupDatabase(cfg)
 
 	// Auto migrate
-	db.AutoMigrate(&models.User{}, &models.Room{}, &models.Message{}, &models.RoomMember{})
+	db.AutoMigrate(&models.User{}, &models.Room{}, &models.Message{}, &models.RoomMember{}, &models.MessageRevision{}, &models.MessageReaction{}, &models.MessageMention{}, &models.Attachment{}, &models.SavedItem{}, &models.ScheduledJob{}, &models.Poll{}, &models.PollOption{}, &models.PollVote{})
+
+	// Number messages stored before rooms had sequence numbers
+	if err := repository.BackfillSequences(db); err != nil {
+		log.Fatal("Failed to backfill message sequence numbers:", err)
+	}
+	if err := repository.SetupMessageSearch(db); err != nil {
+		log.Fatal("Failed to set up message search:", err)
+	}
 
 	// Setup repositories
 	userRepo := repository.NewUserRepository(db)
 	roomRepo := repository.NewRoomRepository(db)
 	messageRepo := repository.NewMessageRepository(db)
+	reactionRepo := repository.NewReactionRepository(db)
+	mentionRepo := repository.NewMentionRepository(db)
+	attachmentRepo := repository.NewAttachmentRepository(db)
+	savedItemRepo := repository.NewSavedItemRepository(db)
+	scheduledRepo := repository.NewScheduledJobRepository(db)
+	pollRepo := repository.NewPollRepository(db)
+
+	// Setup file storage
+	blobStore, err := storage.New(cfg.Storage)
+	if err != nil {
+		log.Fatal("Failed to set up file storage:", err)
+	}
+	urlSigner := storage.NewURLSigner(cfg.Storage.URLSecret, time.Duration(cfg.Chat.FileURLTTLMinutes)*time.Minute)
+
+	// Setup link previews
+	var unfurler chat.Unfurler
+	if cfg.Chat.LinkPreviews {
+		client := unfurl.NewSafeClient(time.Duration(cfg.Chat.UnfurlTimeoutSeconds) * time.Second)
+		unfurler = unfurl.New(unfurl.NewHTTPFetcher(client), time.Duration(cfg.Chat.UnfurlCacheMinutes)*time.Minute, 1000)
+	}
 
 	// Setup services
 	authService := auth.NewService(userRepo)
-	chatService := chat.NewService(roomRepo, messageRepo, userRepo)
+	presence := ws.NewPresence()
+	chatService := chat.NewService(roomRepo, messageRepo, userRepo, reactionRepo, mentionRepo, attachmentRepo, savedItemRepo, scheduledRepo, pollRepo, blobStore, urlSigner, presence, unfurler, cfg.Chat)
 
 	// Setup WebSocket hub
-	hub := ws.NewHub(chatService)
+	hub := ws.NewHub(chatService, presence)
+	chatService.SetNotifier(hub)
 	go hub.Run()
 
+	// Hard-delete messages whose retention after deletion has passed, and
+	// uploads that were never sent
+	go purgeDeletedMessages(chatService, time.Hour)
+
+	// Send scheduled messages and reminders as they come due. Jobs are
+	// claimed with row locks, so any number of servers can run this
+	go runScheduledJobs(chatService, 5*time.Second)
+
 	// Setup handlers
 	authHandler := auth.NewHandler(authService)
 	chatHandler := chat.NewHandler(chatService, authService, hub)
+	docsHandler := docs.NewHandler()
 
 	// Setup router
+	r := setupRouter(authService, authHandler, chatHandler, docsHandler)
+
+	// Routes the OpenAPI spec doesn't describe are caught by the tests; warn
+	// in case one slipped through
+	if err := docs.CheckRoutes(r.Routes()); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+
+	// Start server
+	log.Printf("Server starting on :%s", cfg.Server.Port)
+	r.Run(":" + cfg.Server.Port)
+}
+
+// setupRouter registers the middleware and every route of the server.
+func setupRouter(authService auth.Service, authHandler *auth.Handler, chatHandler *chat.Handler, docsHandler *docs.Handler) *gin.Engine {
 	r := gin.Default()
 
 	// CORS middleware
 	r.Use(func(c *gin.Context) {
 		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
 
 		if c.Request.Method == "OPTIONS" {
@@ -60,6 +118,11 @@ func main() {
 		c.Next()
 	})
 
+	// API documentation
+	r.GET("/openapi.json", docsHandler.OpenAPI)
+	r.GET("/asyncapi.json", docsHandler.AsyncAPI)
+	r.GET("/docs", docsHandler.UI)
+
 	// Public routes
 	authGroup := r.Group("/auth")
 	{
@@ -71,6 +134,9 @@ func main() {
 	// WebSocket endpoint (token-based auth)
 	r.GET("/ws", chatHandler.HandleWebSocket)
 
+	// File downloads (signed URLs)
+	r.GET("/files/:id", chatHandler.DownloadFile)
+
 	// Protected routes
 	apiGroup := r.Group("/api")
 	apiGroup.Use(middleware.AuthMiddleware(authService))
@@ -78,20 +144,84 @@ func main() {
 		// Auth routes
 		apiGroup.GET("/profile", authHandler.GetProfile)
 
+		// Mention routes
+		apiGroup.GET("/mentions", chatHandler.GetMentions)
+		apiGroup.POST("/mentions/read", chatHandler.MarkMentionsRead)
+
+		// Saved item routes
+		apiGroup.GET("/saved", chatHandler.GetSavedItems)
+		apiGroup.POST("/saved", chatHandler.SaveMessage)
+		apiGroup.PATCH("/saved/:id", chatHandler.UpdateSavedItem)
+		apiGroup.DELETE("/saved/:id", chatHandler.DeleteSavedItem)
+
+		// Scheduled message and reminder routes
+		apiGroup.GET("/scheduled", chatHandler.GetScheduled)
+		apiGroup.PATCH("/scheduled/:id", chatHandler.UpdateScheduled)
+		apiGroup.DELETE("/scheduled/:id", chatHandler.CancelScheduled)
+
 		// Chat routes
 		chatGroup := apiGroup.Group("/chat")
 		{
 			chatGroup.POST("/rooms", chatHandler.CreateRoom)
 			chatGroup.GET("/rooms", chatHandler.GetUserRooms)
+			chatGroup.GET("/search", chatHandler.Search)
+			chatGroup.POST("/attachments", chatHandler.UploadAttachment)
+			chatGroup.GET("/attachments/:id", chatHandler.GetAttachment)
 			chatGroup.GET("/rooms/:roomId/messages", chatHandler.GetRoomMessages)
+			chatGroup.GET("/rooms/:roomId/sync", chatHandler.Sync)
+			chatGroup.POST("/rooms/:roomId/messages", chatHandler.SendMessage)
+			chatGroup.POST("/rooms/:roomId/scheduled", chatHandler.ScheduleMessage)
+			chatGroup.PATCH("/rooms/:roomId", chatHandler.UpdateRoom)
 			chatGroup.POST("/rooms/:roomId/join", chatHandler.JoinRoom)
+			chatGroup.POST("/rooms/:roomId/leave", chatHandler.LeaveRoom)
+			chatGroup.PUT("/rooms/:roomId/members/:userId/role", chatHandler.SetMemberRole)
 			chatGroup.GET("/rooms/:roomId/online", chatHandler.GetOnlineUsers)
+			chatGroup.GET("/rooms/:roomId/read", chatHandler.GetReadPositions)
+			chatGroup.POST("/rooms/:roomId/read", chatHandler.MarkRead)
+			chatGroup.GET("/rooms/:roomId/pins", chatHandler.GetPinnedMessages)
+			chatGroup.PATCH("/messages/:id", chatHandler.EditMessage)
+			chatGroup.DELETE("/messages/:id", chatHandler.DeleteMessage)
+			chatGroup.GET("/messages/:id/thread", chatHandler.GetThread)
+			chatGroup.POST("/messages/:id/forward", chatHandler.ForwardMessage)
+			chatGroup.GET("/messages/:id/revisions", chatHandler.GetMessageRevisions)
+			chatGroup.POST("/messages/:id/reactions", chatHandler.AddReaction)
+			chatGroup.DELETE("/messages/:id/reactions/:emoji", chatHandler.RemoveReaction)
+			chatGroup.POST("/messages/:id/pin", chatHandler.PinMessage)
+			chatGroup.DELETE("/messages/:id/pin", chatHandler.UnpinMessage)
+			chatGroup.POST("/messages/:id/reminders", chatHandler.RemindMe)
+			chatGroup.PUT("/messages/:id/poll/votes", chatHandler.VotePoll)
+			chatGroup.POST("/messages/:id/poll/close", chatHandler.ClosePoll)
 		}
 	}
 
-	// Start server
-	log.Printf("Server starting on :%s", cfg.Server.Port)
-	r.Run(":" + cfg.Server.Port)
+	return r
+}
+
+func purgeDeletedMessages(chatService chat.Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purged, err := chatService.PurgeDeletedMessages()
+		if err != nil {
+			log.Printf("Failed to purge deleted messages: %v", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d deleted messages", purged)
+		}
+	}
+}
+
+func runScheduledJobs(chatService chat.Service, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if _, err := chatService.RunScheduledJobs(); err != nil {
+			log.Printf("Failed to run scheduled jobs: %v", err)
+		}
+	}
 }
 
 func setupDatabase(cfg *config.Config) *gorm.DB {
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/auth"
+	"github.com/Shobayosamuel/tap-me/internal/chat"
+	"github.com/Shobayosamuel/tap-me/internal/docs"
+	"github.com/gin-gonic/gin"
+)
+
+// Every /auth and /api route must be described in the OpenAPI spec.
+func TestRoutesDocumented(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	r := setupRouter(nil, auth.NewHandler(nil), chat.NewHandler(nil, nil, nil), docs.NewHandler())
+	if err := docs.CheckRoutes(r.Routes()); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -9,6 +9,8 @@ type Config struct {
 	Server   ServerConfig
 	Database DatabaseConfig
 	JWT      JWTConfig
+	Chat     ChatConfig
+	Storage  StorageConfig
 }
 
 type ServerConfig struct {
@@ -32,6 +34,34 @@ type JWTConfig struct {
 	RefreshTokenTTL   int // days
 }
 
+type ChatConfig struct {
+	EditWindowMinutes     int // 0 disables the limit
+	DeletedRetentionHours int // how long deleted messages are kept before purging
+	MaxReactionEmoji      int // distinct emoji allowed per message
+	MaxAttachmentMB       int // largest file a user may upload
+	AttachmentQuotaMB     int // total size of the files a user may keep
+	FileURLTTLMinutes     int // how long signed download URLs work
+	OrphanUploadHours     int // how long uploads never sent in a message are kept
+	MaxVoiceMinutes       int // longest voice note
+	MaxPinsPerRoom        int // 0 disables the limit
+	MaxScheduled          int // pending scheduled messages and reminders per user; 0 disables the limit
+	LinkPreviews          bool
+	UnfurlTimeoutSeconds  int // per request made to build a link preview
+	UnfurlCacheMinutes    int // how long link previews are reused
+}
+
+type StorageConfig struct {
+	Backend     string // "local" or "s3"
+	LocalDir    string
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PathStyle bool   // needed by MinIO and other local stand-ins
+	URLSecret   string // signs download URLs
+}
+
 func Load() *Config {
 	return &Config{
 		Server: ServerConfig{
@@ -52,6 +82,32 @@ func Load() *Config {
 			AccessTokenTTL:  getEnvAsInt("ACCESS_TOKEN_TTL_HOURS", 1),
 			RefreshTokenTTL: getEnvAsInt("REFRESH_TOKEN_TTL_DAYS", 7),
 		},
+		Chat: ChatConfig{
+			EditWindowMinutes:     getEnvAsInt("MESSAGE_EDIT_WINDOW_MINUTES", 15),
+			DeletedRetentionHours: getEnvAsInt("DELETED_MESSAGE_RETENTION_HOURS", 720),
+			MaxReactionEmoji:      getEnvAsInt("MAX_REACTION_EMOJI_PER_MESSAGE", 20),
+			MaxAttachmentMB:       getEnvAsInt("MAX_ATTACHMENT_MB", 25),
+			AttachmentQuotaMB:     getEnvAsInt("ATTACHMENT_QUOTA_MB", 1024),
+			FileURLTTLMinutes:     getEnvAsInt("FILE_URL_TTL_MINUTES", 15),
+			OrphanUploadHours:     getEnvAsInt("ORPHAN_UPLOAD_RETENTION_HOURS", 24),
+			MaxVoiceMinutes:       getEnvAsInt("MAX_VOICE_NOTE_MINUTES", 15),
+			MaxPinsPerRoom:        getEnvAsInt("MAX_PINS_PER_ROOM", 50),
+			MaxScheduled:          getEnvAsInt("MAX_SCHEDULED_PER_USER", 100),
+			LinkPreviews:          getEnvAsBool("LINK_PREVIEWS_ENABLED", true),
+			UnfurlTimeoutSeconds:  getEnvAsInt("UNFURL_TIMEOUT_SECONDS", 5),
+			UnfurlCacheMinutes:    getEnvAsInt("UNFURL_CACHE_MINUTES", 60),
+		},
+		Storage: StorageConfig{
+			Backend:     getEnv("STORAGE_BACKEND", "local"),
+			LocalDir:    getEnv("STORAGE_LOCAL_DIR", "./uploads"),
+			S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+			S3Region:    getEnv("S3_REGION", "us-east-1"),
+			S3Bucket:    getEnv("S3_BUCKET", ""),
+			S3AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			S3SecretKey: getEnv("S3_SECRET_KEY", ""),
+			S3PathStyle: getEnvAsBool("S3_PATH_STYLE", false),
+			URLSecret:   getEnv("FILE_URL_SECRET", "your-file-url-secret"),
+		},
 	}
 }
 
@@ -69,4 +125,13 @@ func getEnvAsInt(key string, defaultValue int) int {
 		}
 	}
 	return defaultValue
+}
+
+func getEnvAsBool(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if boolValue, err := strconv.ParseBool(value); err == nil {
+			return boolValue
+		}
+	}
+	return defaultValue
 }
\ No newline at end of file
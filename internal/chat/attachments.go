@@ -0,0 +1,358 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Shobayosamuel/tap-me/internal/media"
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+	"github.com/Shobayosamuel/tap-me/internal/storage"
+	"github.com/gabriel-vasile/mimetype"
+	"gorm.io/gorm"
+)
+
+const (
+	maxAttachmentsPerMessage = 10
+	maxFilenameLength        = 255
+)
+
+// File is a stored file opened for download. The caller must close Body.
+type File struct {
+	Body     io.ReadCloser
+	Filename string
+	MimeType string
+	Size     int64
+	Inline   bool
+}
+
+// UploadAttachment stores a file the user can then send in a message. The
+// content type is sniffed from the file itself rather than trusted from the
+// client. Images have their metadata stripped and get thumbnails and a
+// blurhash placeholder. Voice notes must be Ogg/Opus or WebM audio and get
+// their duration and waveform.
+func (s *service) UploadAttachment(userID uint, filename string, size int64, r io.Reader, voice bool) (*models.Attachment, error) {
+	if size > s.MaxUploadBytes() {
+		return nil, ErrFileTooLarge
+	}
+
+	head := make([]byte, 3072)
+	n, err := io.ReadFull(r, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	head = head[:n]
+
+	key, err := newStorageKey(userID)
+	if err != nil {
+		return nil, err
+	}
+	attachment := &models.Attachment{
+		UserID:     userID,
+		StorageKey: key,
+		Filename:   cleanFilename(filename),
+		MimeType:   mimetype.Detect(head).String(),
+		Size:       size,
+	}
+	body := io.MultiReader(bytes.NewReader(head), r)
+
+	var thumbnails []media.Thumbnail
+	if voice {
+		data, err := io.ReadAll(io.LimitReader(body, size))
+		if err != nil {
+			return nil, err
+		}
+		audio, err := media.ProbeVoice(data)
+		if errors.Is(err, media.ErrInvalidAudio) {
+			return nil, ErrInvalidVoice
+		}
+		if err != nil {
+			return nil, err
+		}
+		if audio.Duration > time.Duration(s.cfg.MaxVoiceMinutes)*time.Minute {
+			return nil, ErrVoiceTooLong
+		}
+
+		body = bytes.NewReader(data)
+		attachment.MimeType = audio.MimeType
+		attachment.DurationMs = max(1, int(audio.Duration.Milliseconds()))
+		attachment.Waveform = audio.Waveform
+	} else if attachment.IsImage() {
+		data, err := io.ReadAll(io.LimitReader(body, size))
+		if err != nil {
+			return nil, err
+		}
+		img, err := media.Process(data, attachment.MimeType)
+		if errors.Is(err, media.ErrUnsupported) || errors.Is(err, media.ErrTooLarge) {
+			return nil, ErrInvalidImage
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		body = bytes.NewReader(img.Data)
+		attachment.Size = int64(len(img.Data))
+		attachment.Width = img.Width
+		attachment.Height = img.Height
+		attachment.Blurhash = img.Blurhash
+		thumbnails = img.Thumbnails
+		for _, thumb := range img.Thumbnails {
+			attachment.Thumbnails = append(attachment.Thumbnails, models.Thumbnail{
+				Width:    thumb.Width,
+				Height:   thumb.Height,
+				MimeType: thumb.MimeType,
+				Size:     int64(len(thumb.Data)),
+			})
+		}
+	}
+
+	ctx := context.Background()
+	hash := sha256.New()
+	if err := s.store.Put(ctx, key, io.TeeReader(body, hash), attachment.Size, attachment.MimeType); err != nil {
+		return nil, err
+	}
+	attachment.Checksum = hex.EncodeToString(hash.Sum(nil))
+
+	for _, thumb := range thumbnails {
+		err := s.store.Put(ctx, thumbnailKey(key, thumb.Width, thumb.Height), bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.MimeType)
+		if err != nil {
+			s.deleteBlobs([]models.Attachment{*attachment})
+			return nil, err
+		}
+	}
+
+	quota := int64(s.cfg.AttachmentQuotaMB) << 20
+	if err := s.attachmentRepo.Create(attachment, quota); err != nil {
+		s.deleteBlobs([]models.Attachment{*attachment})
+		if errors.Is(err, repository.ErrQuotaExceeded) {
+			return nil, ErrQuotaExceeded
+		}
+		return nil, err
+	}
+
+	s.signAttachment(attachment)
+	return attachment, nil
+}
+
+// MaxUploadBytes is the size of the largest file a user may upload.
+func (s *service) MaxUploadBytes() int64 {
+	return int64(s.cfg.MaxAttachmentMB) << 20
+}
+
+// GetAttachment returns an attachment with a fresh download URL. Unsent
+// uploads are only visible to their uploader, sent ones to the members of
+// the message's room.
+func (s *service) GetAttachment(userID, attachmentID uint) (*models.Attachment, error) {
+	attachment, err := s.attachmentRepo.GetByID(attachmentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if attachment.MessageID == nil {
+		if attachment.UserID != userID {
+			return nil, ErrAttachmentNotFound
+		}
+	} else {
+		message, err := s.getMessage(*attachment.MessageID)
+		if errors.Is(err, ErrMessageNotFound) {
+			return nil, ErrAttachmentNotFound
+		}
+		if err != nil {
+			return nil, err
+		}
+		canAccess, err := s.CanUserAccessRoom(userID, message.RoomID)
+		if err != nil {
+			return nil, err
+		}
+		if !canAccess {
+			return nil, ErrAccessDenied
+		}
+	}
+
+	s.signAttachment(attachment)
+	return attachment, nil
+}
+
+// OpenAttachment checks a signed download URL and opens the file it points
+// to, or the thumbnail of the given width if thumb is set. Files of deleted
+// messages are gone as soon as the message is deleted.
+func (s *service) OpenAttachment(attachmentID uint, thumb int, expires, signature string) (*File, error) {
+	if !s.signer.Verify(attachmentID, expires, signature) {
+		return nil, ErrInvalidFileURL
+	}
+
+	attachment, err := s.attachmentRepo.GetByID(attachmentID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if attachment.MessageID != nil {
+		if _, err := s.getMessage(*attachment.MessageID); errors.Is(err, ErrMessageNotFound) {
+			return nil, ErrAttachmentNotFound
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	file := &File{
+		Filename: attachment.Filename,
+		MimeType: attachment.MimeType,
+		Size:     attachment.Size,
+		Inline:   attachment.IsImage(),
+	}
+	key := attachment.StorageKey
+	if thumb != 0 {
+		found := false
+		for _, t := range attachment.Thumbnails {
+			if t.Width == thumb {
+				key = thumbnailKey(attachment.StorageKey, t.Width, t.Height)
+				file.MimeType = t.MimeType
+				file.Size = t.Size
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, ErrAttachmentNotFound
+		}
+	}
+
+	file.Body, err = s.store.Get(context.Background(), key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return nil, ErrAttachmentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return file, nil
+}
+
+// sentAttachments checks the uploads a message is being sent with and
+// returns the message type they call for.
+func (s *service) sentAttachments(userID uint, ids []uint) ([]uint, models.MessageType, error) {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) > maxAttachmentsPerMessage {
+		return nil, "", ErrInvalidAttachment
+	}
+
+	attachments, err := s.attachmentRepo.GetOwned(userID, unique)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(attachments) != len(unique) {
+		return nil, "", ErrInvalidAttachment
+	}
+
+	messageType := models.MessageTypeImage
+	for i := range attachments {
+		if attachments[i].IsVoice() {
+			if len(attachments) > 1 {
+				return nil, "", ErrVoiceNotAlone
+			}
+			return unique, models.MessageTypeVoice, nil
+		}
+		if !attachments[i].IsImage() {
+			messageType = models.MessageTypeFile
+		}
+	}
+	return unique, messageType, nil
+}
+
+// signAttachments gives every attachment of the messages a fresh download URL.
+func (s *service) signAttachments(messages []models.Message) {
+	for i := range messages {
+		s.signMessageAttachments(&messages[i])
+	}
+}
+
+func (s *service) signMessageAttachments(message *models.Message) {
+	for i := range message.Attachments {
+		s.signAttachment(&message.Attachments[i])
+	}
+}
+
+func (s *service) signAttachment(attachment *models.Attachment) {
+	attachment.URL = s.signer.Sign(attachment.ID)
+	for i := range attachment.Thumbnails {
+		attachment.Thumbnails[i].URL = attachment.URL + "&thumb=" + strconv.Itoa(attachment.Thumbnails[i].Width)
+	}
+}
+
+// deleteBlobs removes the stored files of attachments, thumbnails included,
+// once no attachment refers to them any more. Failures are only logged: an
+// unreferenced blob is wasted space, not a broken message.
+func (s *service) deleteBlobs(attachments []models.Attachment) {
+	for _, attachment := range attachments {
+		keys := []string{attachment.StorageKey}
+		for _, t := range attachment.Thumbnails {
+			keys = append(keys, thumbnailKey(attachment.StorageKey, t.Width, t.Height))
+		}
+		for _, key := range keys {
+			if err := s.store.Delete(context.Background(), key); err != nil {
+				log.Printf("Failed to delete blob %s: %v", key, err)
+			}
+		}
+	}
+}
+
+// purgeOrphanUploads removes uploads that were never sent in a message.
+func (s *service) purgeOrphanUploads() error {
+	retention := time.Duration(s.cfg.OrphanUploadHours) * time.Hour
+	orphans, err := s.attachmentRepo.PurgeOrphans(time.Now().Add(-retention))
+	if err != nil {
+		return err
+	}
+	s.deleteBlobs(orphans)
+	return nil
+}
+
+func newStorageKey(userID uint) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("attachments/%d/%s", userID, hex.EncodeToString(b)), nil
+}
+
+// thumbnailKey is where a thumbnail is stored, next to its original.
+func thumbnailKey(key string, width, height int) string {
+	return fmt.Sprintf("%s_%dx%d", key, width, height)
+}
+
+// cleanFilename keeps the base name of an uploaded file, as some browsers
+// send the full client-side path.
+func cleanFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" || !utf8.ValidString(name) {
+		return "file"
+	}
+	for len(name) > maxFilenameLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	return name
+}
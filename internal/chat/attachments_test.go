@@ -0,0 +1,237 @@
+package chat
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"io/fs"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/config"
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+	"github.com/Shobayosamuel/tap-me/internal/storage"
+	"gorm.io/gorm"
+)
+
+// fakeAttachmentRepo keeps attachments in memory and charges quota per
+// stored blob, as the Postgres repository does.
+type fakeAttachmentRepo struct {
+	attachments map[uint]*models.Attachment
+	nextID      uint
+}
+
+func (r *fakeAttachmentRepo) Create(attachment *models.Attachment, quota int64) error {
+	used := int64(0)
+	counted := map[string]bool{}
+	for _, a := range r.attachments {
+		if a.UserID == attachment.UserID && !counted[a.StorageKey] {
+			counted[a.StorageKey] = true
+			used += a.Size
+		}
+	}
+	if quota > 0 && used+attachment.Size > quota {
+		return repository.ErrQuotaExceeded
+	}
+	r.nextID++
+	attachment.ID = r.nextID
+	stored := *attachment
+	r.attachments[attachment.ID] = &stored
+	return nil
+}
+
+func (r *fakeAttachmentRepo) GetByID(id uint) (*models.Attachment, error) {
+	a, ok := r.attachments[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *a
+	return &found, nil
+}
+
+func (r *fakeAttachmentRepo) GetOwned(userID uint, ids []uint) ([]models.Attachment, error) {
+	var owned []models.Attachment
+	for _, id := range ids {
+		if a, ok := r.attachments[id]; ok && a.UserID == userID {
+			owned = append(owned, *a)
+		}
+	}
+	return owned, nil
+}
+
+func (r *fakeAttachmentRepo) PurgeOrphans(before time.Time) ([]models.Attachment, error) {
+	return nil, nil
+}
+
+func newAttachmentService(t *testing.T, cfg config.ChatConfig) (*service, string) {
+	t.Helper()
+	root := t.TempDir()
+	store, err := storage.NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &service{
+		attachmentRepo: &fakeAttachmentRepo{attachments: map[uint]*models.Attachment{}},
+		store:          store,
+		signer:         storage.NewURLSigner("secret", time.Minute),
+		cfg:            cfg,
+	}, root
+}
+
+func upload(s *service, filename string, data []byte) (*models.Attachment, error) {
+	return s.UploadAttachment(1, filename, int64(len(data)), bytes.NewReader(data), false)
+}
+
+// open downloads an attachment through its signed URL.
+func open(t *testing.T, s *service, attachment *models.Attachment) *File {
+	t.Helper()
+	u, err := url.Parse(attachment.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := s.OpenAttachment(attachment.ID, 0, u.Query().Get("expires"), u.Query().Get("signature"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { file.Body.Close() })
+	return file
+}
+
+func pngBytes(t *testing.T) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 4, 3))
+	img.Set(1, 1, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestUploadAttachmentSniffsContentType(t *testing.T) {
+	s, _ := newAttachmentService(t, config.ChatConfig{MaxAttachmentMB: 1})
+
+	tests := []struct {
+		name     string
+		filename string
+		data     []byte
+		mimeType string
+		inline   bool
+	}{
+		{"png named as text", "notes.txt", pngBytes(t), "image/png", true},
+		{"html named as image", "photo.png", []byte("<!DOCTYPE html><html><script>alert(1)</script></html>"), "text/html; charset=utf-8", false},
+		{"svg", "logo.svg", []byte(`<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"></svg>`), "image/svg+xml", false},
+		{"plain text named as jpeg", "cat.jpg", []byte("just some text"), "text/plain; charset=utf-8", false},
+		{"pdf", "doc.pdf", []byte("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n"), "application/pdf", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attachment, err := upload(s, tt.filename, tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attachment.MimeType != tt.mimeType {
+				t.Errorf("MimeType = %q, want %q", attachment.MimeType, tt.mimeType)
+			}
+			if attachment.Filename != tt.filename {
+				t.Errorf("Filename = %q, want %q", attachment.Filename, tt.filename)
+			}
+
+			file := open(t, s, attachment)
+			if file.Inline != tt.inline {
+				t.Errorf("Inline = %v, want %v", file.Inline, tt.inline)
+			}
+			if file.MimeType != tt.mimeType {
+				t.Errorf("served MimeType = %q, want %q", file.MimeType, tt.mimeType)
+			}
+			if !tt.inline {
+				data, _ := io.ReadAll(file.Body)
+				if !bytes.Equal(data, tt.data) {
+					t.Errorf("download changed the file's bytes")
+				}
+			}
+		})
+	}
+}
+
+func TestUploadAttachmentRejectsBrokenImage(t *testing.T) {
+	s, _ := newAttachmentService(t, config.ChatConfig{MaxAttachmentMB: 1})
+	data := pngBytes(t)
+	if _, err := upload(s, "x.png", data[:len(data)/2]); !errors.Is(err, ErrInvalidImage) {
+		t.Fatalf("truncated png: err = %v, want ErrInvalidImage", err)
+	}
+}
+
+func TestUploadAttachmentLimits(t *testing.T) {
+	s, root := newAttachmentService(t, config.ChatConfig{MaxAttachmentMB: 1, AttachmentQuotaMB: 2})
+	mb := bytes.Repeat([]byte("a"), 1<<20)
+
+	if _, err := upload(s, "big.txt", append(mb, 'x')); !errors.Is(err, ErrFileTooLarge) {
+		t.Fatalf("file over the size limit: err = %v, want ErrFileTooLarge", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := upload(s, "full.txt", mb); err != nil {
+			t.Fatalf("upload %d within quota: %v", i, err)
+		}
+	}
+	if _, err := upload(s, "over.txt", []byte("x")); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("upload over quota: err = %v, want ErrQuotaExceeded", err)
+	}
+
+	// The refused upload's blob is removed again
+	var blobs []string
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			blobs = append(blobs, path)
+		}
+		return err
+	})
+	if len(blobs) != 2 {
+		t.Fatalf("stored blobs = %v, want the 2 accepted uploads", blobs)
+	}
+}
+
+func TestOpenAttachmentChecksSignature(t *testing.T) {
+	s, _ := newAttachmentService(t, config.ChatConfig{MaxAttachmentMB: 1})
+	attachment, err := upload(s, "a.txt", []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, _ := url.Parse(attachment.URL)
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+
+	if _, err := s.OpenAttachment(attachment.ID+1, 0, expires, signature); !errors.Is(err, ErrInvalidFileURL) {
+		t.Errorf("other attachment: err = %v, want ErrInvalidFileURL", err)
+	}
+	if _, err := s.OpenAttachment(attachment.ID, 0, expires, strings.Repeat("0", len(signature))); !errors.Is(err, ErrInvalidFileURL) {
+		t.Errorf("forged signature: err = %v, want ErrInvalidFileURL", err)
+	}
+	if _, err := s.OpenAttachment(attachment.ID, 640, expires, signature); !errors.Is(err, ErrAttachmentNotFound) {
+		t.Errorf("missing thumbnail: err = %v, want ErrAttachmentNotFound", err)
+	}
+}
+
+func TestCleanFilename(t *testing.T) {
+	tests := map[string]string{
+		"report.pdf":               "report.pdf",
+		"  spaced.txt  ":           "spaced.txt",
+		"C:\\Users\\me\\photo.jpg": "photo.jpg",
+		"/home/me/../etc/passwd":   "passwd",
+		"":                         "file",
+		"/":                        "file",
+		"bad\xffutf8":              "file",
+		strings.Repeat("é", 200):   strings.Repeat("é", 127),
+	}
+	for in, want := range tests {
+		if got := cleanFilename(in); got != want {
+			t.Errorf("cleanFilename(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -1,15 +1,98 @@
 package chat
 
+import (
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
 type CreateRoomRequest struct {
 	Name string `json:"name" binding:"required,min=1,max=100"`
 	Description string `json:"description" binding:"max=500"`
 	IsPrivate bool `json:"is_private"`
 }
 
+// UpdateRoomRequest changes the fields that are set and leaves the rest.
+type UpdateRoomRequest struct {
+	Name *string `json:"name" binding:"omitempty,min=1,max=100"`
+	Description *string `json:"description" binding:"omitempty,max=500"`
+}
+
+type SetMemberRoleRequest struct {
+	Role string `json:"role" binding:"required,oneof=admin moderator member"`
+}
+
 type JoinRoomRequest struct {
 	RoomID uint `json:"room_id" binding:"required"`
 }
 
 type SendMessageRequest struct {
+	Content string `json:"content" binding:"max=1000"`
+	Format string `json:"format" binding:"omitempty,oneof=plain markdown"`
+	ClientMsgID string `json:"client_msg_id" binding:"max=64"`
+	ParentID uint `json:"parent_id"`
+	AlsoSendToChannel bool `json:"also_send_to_channel"`
+	ReplyToID uint `json:"reply_to_id"`
+	AttachmentIDs []uint `json:"attachment_ids" binding:"max=10"`
+	Poll *models.PollInput `json:"poll"`
+}
+
+// ScheduleMessageRequest is a SendMessageRequest to send at SendAt. It cannot
+// carry attachments.
+type ScheduleMessageRequest struct {
+	Content string `json:"content" binding:"required,max=1000"`
+	Format string `json:"format" binding:"omitempty,oneof=plain markdown"`
+	ParentID uint `json:"parent_id"`
+	AlsoSendToChannel bool `json:"also_send_to_channel"`
+	ReplyToID uint `json:"reply_to_id"`
+	SendAt time.Time `json:"send_at" binding:"required"`
+}
+
+type CreateReminderRequest struct {
+	RemindAt time.Time `json:"remind_at" binding:"required"`
+	Note string `json:"note" binding:"max=1000"`
+}
+
+// UpdateScheduledRequest changes the fields that are set and leaves the rest.
+// Content and format only apply to scheduled messages, and note to reminders.
+type UpdateScheduledRequest struct {
+	RunAt *time.Time `json:"run_at"`
+	Content *string `json:"content" binding:"omitempty,min=1,max=1000"`
+	Format *string `json:"format" binding:"omitempty,oneof=plain markdown"`
+	Note *string `json:"note" binding:"omitempty,max=1000"`
+}
+
+type EditMessageRequest struct {
 	Content string `json:"content" binding:"required,min=1,max=1000"`
+}
+
+type ForwardMessageRequest struct {
+	RoomID uint `json:"room_id" binding:"required"`
+	ClientMsgID string `json:"client_msg_id" binding:"max=64"`
+}
+
+type SaveMessageRequest struct {
+	MessageID uint `json:"message_id" binding:"required"`
+	Note string `json:"note" binding:"max=1000"`
+}
+
+type UpdateSavedItemRequest struct {
+	Note string `json:"note" binding:"max=1000"`
+}
+
+type MarkMentionsReadRequest struct {
+	MessageIDs []uint `json:"message_ids"`
+}
+
+type MarkReadRequest struct {
+	MessageID uint `json:"message_id" binding:"required"`
+}
+
+// PollVoteRequest replaces the user's votes; an empty list takes them back.
+type PollVoteRequest struct {
+	OptionIDs []uint `json:"option_ids" binding:"max=10"`
+}
+
+type ReactionRequest struct {
+	Emoji string `json:"emoji" binding:"required,max=64"`
 }
\ No newline at end of file
@@ -0,0 +1,24 @@
+package chat
+
+import (
+	"github.com/Shobayosamuel/tap-me/internal/markdown"
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+// renderContent fills in the HTML and plain text of a message from its
+// content, according to its format. Messages without a format are plain.
+func renderContent(message *models.Message) error {
+	switch message.Format {
+	case models.MessageFormatMarkdown:
+		doc := markdown.Render(message.Content)
+		message.HTML = doc.HTML
+		message.PlainText = doc.Text
+	case "", models.MessageFormatPlain:
+		message.Format = models.MessageFormatPlain
+		message.HTML = ""
+		message.PlainText = message.Content
+	default:
+		return ErrInvalidFormat
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package chat
 
 import (
+	"errors"
+	"mime"
 	"net/http"
 	"strconv"
 	"time"
@@ -87,6 +89,491 @@ func (h *Handler) GetRoomMessages(c *gin.Context) {
 		return
 	}
 
+	req := MessagePageRequest{Cursor: c.Query("cursor")}
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			req.Limit = parsed
+		}
+	}
+	for param, anchor := range map[string]*uint{"before": &req.Before, "after": &req.After, "around": &req.Around} {
+		if v := c.Query(param); v != "" {
+			parsed, err := strconv.ParseUint(v, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + param + " message ID"})
+				return
+			}
+			*anchor = uint(parsed)
+		}
+	}
+
+	page, err := h.service.GetRoomMessages(user.ID, uint(roomID), req)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *Handler) SendMessage(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	var req SendMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, created, err := h.service.CreateMessage(user.ID, uint(roomID), models.MessageInput{
+		Content:           req.Content,
+		Format:            models.MessageFormat(req.Format),
+		ClientMsgID:       req.ClientMsgID,
+		ParentID:          req.ParentID,
+		AlsoSendToChannel: req.AlsoSendToChannel,
+		ReplyToID:         req.ReplyToID,
+		AttachmentIDs:     req.AttachmentIDs,
+		Poll:              req.Poll,
+	})
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	// A retry with a known client_msg_id returns the original message
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	// Fan out to live WebSocket subscribers
+	h.hub.PublishMessage(message)
+
+	c.JSON(http.StatusCreated, gin.H{"message": message})
+}
+
+func (h *Handler) ScheduleMessage(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	var req ScheduleMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.service.ScheduleMessage(user.ID, uint(roomID), req)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"scheduled": job})
+}
+
+func (h *Handler) RemindMe(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req CreateReminderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.service.RemindMe(user.ID, uint(messageID), req.RemindAt, req.Note)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"scheduled": job})
+}
+
+func (h *Handler) GetScheduled(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	limit := defaultPageSize
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			offset = parsed
+		}
+	}
+
+	jobs, err := h.service.GetScheduled(user.ID, limit, offset)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled": jobs})
+}
+
+func (h *Handler) UpdateScheduled(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled ID"})
+		return
+	}
+
+	var req UpdateScheduledRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := h.service.UpdateScheduled(user.ID, uint(jobID), req)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"scheduled": job})
+}
+
+func (h *Handler) CancelScheduled(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	jobID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid scheduled ID"})
+		return
+	}
+
+	if err := h.service.CancelScheduled(user.ID, uint(jobID)); err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cancelled"})
+}
+
+func (h *Handler) EditMessage(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req EditMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, _, err := h.service.EditMessage(user.ID, uint(messageID), req.Content)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func (h *Handler) DeleteMessage(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, err := h.service.DeleteMessage(user.ID, uint(messageID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func (h *Handler) ForwardMessage(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req ForwardMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, created, err := h.service.ForwardMessage(user.ID, uint(messageID), req.RoomID, req.ClientMsgID)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"message": message})
+		return
+	}
+
+	h.hub.PublishMessage(message)
+	c.JSON(http.StatusCreated, gin.H{"message": message})
+}
+
+func (h *Handler) VotePoll(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req PollVoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, changed, err := h.service.VotePoll(user.ID, uint(messageID), req.OptionIDs)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if changed {
+		h.hub.PublishPollUpdated(change)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"poll": change.Poll})
+}
+
+func (h *Handler) ClosePoll(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	change, closed, err := h.service.ClosePoll(user.ID, uint(messageID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if closed {
+		h.hub.PublishPollUpdated(change)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"poll": change.Poll})
+}
+
+func (h *Handler) AddReaction(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var req ReactionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	change, added, err := h.service.AddReaction(user.ID, uint(messageID), req.Emoji)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if added {
+		h.hub.PublishReaction(change, true)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reaction": change})
+}
+
+func (h *Handler) RemoveReaction(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	change, removed, err := h.service.RemoveReaction(user.ID, uint(messageID), c.Param("emoji"))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if removed {
+		h.hub.PublishReaction(change, false)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"reaction": change})
+}
+
+func (h *Handler) GetMessageRevisions(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	revisions, err := h.service.GetMessageRevisions(user.ID, uint(messageID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"revisions": revisions})
+}
+
+func (h *Handler) PinMessage(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, _, err := h.service.PinMessage(user.ID, uint(messageID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func (h *Handler) UnpinMessage(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	message, _, err := h.service.UnpinMessage(user.ID, uint(messageID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": message})
+}
+
+func (h *Handler) GetPinnedMessages(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	messages, err := h.service.GetPinnedMessages(user.ID, uint(roomID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": messages})
+}
+
+func (h *Handler) Sync(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	since, err := strconv.ParseUint(c.DefaultQuery("since", "0"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since"})
+		return
+	}
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	result, err := h.service.Sync(user.ID, uint(roomID), since, limit)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *Handler) Search(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	limit := 0
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+
+	page, err := h.service.Search(user.ID, c.Query("q"), c.Query("cursor"), limit)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *Handler) GetThread(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	messageID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
 	limit := 50
 	offset := 0
 	if l := c.Query("limit"); l != "" {
@@ -100,13 +587,149 @@ func (h *Handler) GetRoomMessages(c *gin.Context) {
 		}
 	}
 
-	messages, err := h.service.GetRoomMessages(user.ID, uint(roomID), limit, offset)
+	root, replies, err := h.service.GetThread(user.ID, uint(messageID), limit, offset)
 	if err != nil {
-		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"messages": messages})
+	c.JSON(http.StatusOK, gin.H{"root": root, "replies": replies})
+}
+
+func (h *Handler) GetMentions(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	limit := 50
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			offset = parsed
+		}
+	}
+
+	mentions, err := h.service.GetUnreadMentions(user.ID, limit, offset)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"mentions": mentions})
+}
+
+func (h *Handler) SaveMessage(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	var req SaveMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, created, err := h.service.SaveMessage(user.ID, req.MessageID, req.Note)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if !created {
+		c.JSON(http.StatusOK, gin.H{"saved_item": item})
+		return
+	}
+
+	h.hub.PublishSavedItem(item, false)
+	c.JSON(http.StatusCreated, gin.H{"saved_item": item})
+}
+
+func (h *Handler) GetSavedItems(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	limit := defaultPageSize
+	offset := 0
+	if l := c.Query("limit"); l != "" {
+		if parsed, err := strconv.Atoi(l); err == nil {
+			limit = parsed
+		}
+	}
+	if o := c.Query("offset"); o != "" {
+		if parsed, err := strconv.Atoi(o); err == nil {
+			offset = parsed
+		}
+	}
+
+	items, err := h.service.GetSavedItems(user.ID, limit, offset)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"saved_items": items})
+}
+
+func (h *Handler) UpdateSavedItem(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid saved item ID"})
+		return
+	}
+
+	var req UpdateSavedItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := h.service.UpdateSavedItem(user.ID, uint(itemID), req.Note)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.hub.PublishSavedItem(item, false)
+	c.JSON(http.StatusOK, gin.H{"saved_item": item})
+}
+
+func (h *Handler) DeleteSavedItem(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	itemID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid saved item ID"})
+		return
+	}
+
+	item, err := h.service.DeleteSavedItem(user.ID, uint(itemID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	h.hub.PublishSavedItem(item, true)
+	c.JSON(http.StatusOK, gin.H{"message": "Saved item removed"})
+}
+
+func (h *Handler) MarkMentionsRead(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	var req MarkMentionsReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	marked, err := h.service.MarkMentionsRead(user.ID, req.MessageIDs)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
 }
 
 func (h *Handler) JoinRoom(c *gin.Context) {
@@ -126,6 +749,221 @@ func (h *Handler) JoinRoom(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "Successfully joined room"})
 }
 
+func (h *Handler) LeaveRoom(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	if err := h.service.LeaveRoom(user.ID, uint(roomID)); err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Successfully left room"})
+}
+
+func (h *Handler) UpdateRoom(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	var req UpdateRoomRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	room, err := h.service.UpdateRoom(user.ID, uint(roomID), req)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"room": room})
+}
+
+func (h *Handler) SetMemberRole(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+	memberID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req SetMemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.SetMemberRole(user.ID, uint(roomID), uint(memberID), models.MemberRole(req.Role)); err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated"})
+}
+
+// UploadAttachment stores a file sent as the multipart form field "file",
+// as a voice note if the form field "voice" is true. The returned attachment
+// is then sent by listing its ID in a message's attachment_ids.
+func (h *Handler) UploadAttachment(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	// Leave room for the multipart framing around the file itself
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, h.service.MaxUploadBytes()+1<<20)
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": ErrFileTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Missing file"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Close()
+
+	voice, _ := strconv.ParseBool(c.PostForm("voice"))
+	attachment, err := h.service.UploadAttachment(user.ID, header.Filename, header.Size, file, voice)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"attachment": attachment})
+}
+
+// GetAttachment returns an attachment with a fresh download URL, for clients
+// whose earlier URL expired.
+func (h *Handler) GetAttachment(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	attachment, err := h.service.GetAttachment(user.ID, uint(attachmentID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"attachment": attachment})
+}
+
+// DownloadFile serves a stored file to anyone holding a valid signed URL, so
+// it works from <img> tags and links that cannot send an access token.
+func (h *Handler) DownloadFile(c *gin.Context) {
+	attachmentID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	var thumb int
+	if raw := c.Query("thumb"); raw != "" {
+		thumb, err = strconv.Atoi(raw)
+		if err != nil || thumb <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid thumbnail size"})
+			return
+		}
+	}
+
+	file, err := h.service.OpenAttachment(uint(attachmentID), thumb, c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+	defer file.Body.Close()
+
+	disposition := "attachment"
+	if file.Inline {
+		disposition = "inline"
+	}
+	c.DataFromReader(http.StatusOK, file.Size, file.MimeType, file.Body, map[string]string{
+		"Content-Disposition":    mime.FormatMediaType(disposition, map[string]string{"filename": file.Filename}),
+		"X-Content-Type-Options": "nosniff",
+		"Cache-Control":          "private, max-age=300",
+	})
+}
+
+// statusFor maps service errors onto HTTP status codes.
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrMessageNotFound),
+		errors.Is(err, ErrAttachmentNotFound),
+		errors.Is(err, ErrNotRoomMember),
+		errors.Is(err, ErrSavedItemNotFound),
+		errors.Is(err, ErrScheduledNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrAccessDenied),
+		errors.Is(err, ErrNotMessageAuthor),
+		errors.Is(err, ErrModeratorRequired),
+		errors.Is(err, ErrAdminRequired),
+		errors.Is(err, ErrCannotDelete),
+		errors.Is(err, ErrCannotClosePoll),
+		errors.Is(err, ErrInvalidFileURL):
+		return http.StatusForbidden
+	case errors.Is(err, ErrInvalidEmoji),
+		errors.Is(err, ErrInvalidParent),
+		errors.Is(err, ErrInvalidReplyTo),
+		errors.Is(err, ErrMessageNotInRoom),
+		errors.Is(err, ErrInvalidCursor),
+		errors.Is(err, ErrInvalidSeq),
+		errors.Is(err, ErrInvalidSearch),
+		errors.Is(err, ErrInvalidLimit),
+		errors.Is(err, ErrEmptyMessage),
+		errors.Is(err, ErrInvalidFormat),
+		errors.Is(err, ErrInvalidAttachment),
+		errors.Is(err, ErrInvalidImage),
+		errors.Is(err, ErrInvalidVoice),
+		errors.Is(err, ErrVoiceTooLong),
+		errors.Is(err, ErrVoiceNotAlone),
+		errors.Is(err, ErrSystemMessage),
+		errors.Is(err, ErrOwnRole),
+		errors.Is(err, ErrInvalidSchedule),
+		errors.Is(err, ErrInvalidPoll),
+		errors.Is(err, ErrNotPoll),
+		errors.Is(err, ErrPollMessage),
+		errors.Is(err, ErrInvalidVote):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrFileTooLarge),
+		errors.Is(err, ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrEditWindowExpired),
+		errors.Is(err, ErrTooManyReactions),
+		errors.Is(err, ErrTooManyPins),
+		errors.Is(err, ErrTooManyScheduled),
+		errors.Is(err, ErrPollClosed):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
 func (h *Handler) HandleWebSocket(c *gin.Context) {
 	// Get JWT token from query parameter (since WebSocket doesn't support headers easily)
 	token := c.Query("token")
@@ -150,15 +988,24 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 		},
 	}
 
+	// Pick the protocol version from the subprotocol header or query parameter
+	protocol, closeCode, reason := ws.NegotiateProtocol(c.Request)
+
 	// Upgrade connection to WebSocket
-	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, ws.ProtocolHeader(c.Request, protocol))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upgrade connection"})
 		return
 	}
 
+	// Unknown or deprecated versions are told why before the socket is closed
+	if closeCode != 0 {
+		ws.CloseWithReason(conn, closeCode, reason)
+		return
+	}
+
 	// Create new client and register with hub
-	client := ws.NewClient(h.hub, conn, user)
+	client := ws.NewClient(h.hub, conn, user, protocol)
 	h.hub.Register <- client
 
 	// Start client goroutines
@@ -166,6 +1013,52 @@ func (h *Handler) HandleWebSocket(c *gin.Context) {
 	go client.ReadPump()
 }
 
+func (h *Handler) MarkRead(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	var req MarkReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	position, moved, err := h.service.MarkRead(user.ID, uint(roomID), req.MessageID)
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	if moved {
+		h.hub.PublishReadPosition(position)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"read_position": position})
+}
+
+func (h *Handler) GetReadPositions(c *gin.Context) {
+	user := c.MustGet("user").(*models.User)
+
+	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	positions, err := h.service.GetReadPositions(user.ID, uint(roomID))
+	if err != nil {
+		c.JSON(statusFor(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"read_positions": positions})
+}
+
 func (h *Handler) GetOnlineUsers(c *gin.Context) {
 	roomID, err := strconv.ParseUint(c.Param("roomId"), 10, 32)
 	if err != nil {
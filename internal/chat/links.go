@@ -0,0 +1,159 @@
+package chat
+
+import (
+	"context"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+// Unfurler builds the preview of a link, or returns nil if it has none. See
+// the unfurl package.
+type Unfurler interface {
+	Unfurl(ctx context.Context, url string) *models.LinkPreview
+}
+
+// Notifier is told about messages the service posts or changes on its own
+// account: system messages, link previews added in the background, polls
+// closed at their closing time, and scheduled messages and reminders as they
+// fire. Deletions and pins are published through it too, since the system
+// message recording one must reach clients after it, and so are edits and
+// thread counters lowered by a deletion.
+type Notifier interface {
+	PublishMessage(message *models.Message)
+	PublishMessageUpdated(message *models.Message)
+	PublishMessageEdited(message *models.Message)
+	PublishMessageDeleted(message *models.Message)
+	PublishThreadUpdated(root *models.Message)
+	PublishMessagePinned(message *models.Message, pinned bool)
+	PublishScheduledJob(job *models.ScheduledJob)
+	PublishPollUpdated(change *models.PollChange)
+}
+
+const (
+	maxLinkPreviews = 3
+	unfurlWorkers   = 4
+	unfurlQueueSize = 256
+)
+
+// urlPattern matches http(s) links in message content. Trailing punctuation
+// is trimmed separately so "see https://example.com." works.
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"'` + "`" + `]+`)
+
+// SetNotifier sets where the service's own messages and updates are
+// published. It must be called before the service handles requests.
+func (s *service) SetNotifier(notifier Notifier) {
+	s.notifier = notifier
+}
+
+// queueUnfurl schedules fetching previews for the links in a message that
+// have none yet. Previews are best effort: when the queue is full the
+// message simply goes without.
+func (s *service) queueUnfurl(message *models.Message) {
+	if s.unfurler == nil {
+		return
+	}
+
+	urls := extractURLs(message.Content)
+	if len(urls) == 0 || len(urls) == len(message.LinkPreviews) {
+		return
+	}
+
+	job := *message
+	select {
+	case s.unfurls <- &job:
+	default:
+		log.Printf("Link preview queue full, skipping message %d", message.ID)
+	}
+}
+
+func (s *service) unfurlWorker() {
+	for message := range s.unfurls {
+		s.unfurlLinks(message)
+	}
+}
+
+// unfurlLinks fetches the previews for message's links, stores them and
+// tells the room.
+func (s *service) unfurlLinks(message *models.Message) {
+	known := make(map[string]models.LinkPreview, len(message.LinkPreviews))
+	for _, preview := range message.LinkPreviews {
+		known[preview.URL] = preview
+	}
+
+	// A preview may take two requests: the page and its oEmbed endpoint
+	timeout := 2 * time.Duration(s.cfg.UnfurlTimeoutSeconds) * time.Second
+	var previews []models.LinkPreview
+	for _, link := range extractURLs(message.Content) {
+		if preview, ok := known[link]; ok {
+			previews = append(previews, preview)
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		preview := s.unfurler.Unfurl(ctx, link)
+		cancel()
+		if preview != nil {
+			previews = append(previews, *preview)
+		}
+	}
+	if len(previews) == len(message.LinkPreviews) {
+		return
+	}
+
+	updated, err := s.messageRepo.SetLinkPreviews(message, previews)
+	if err != nil {
+		log.Printf("Failed to store link previews of message %d: %v", message.ID, err)
+		return
+	}
+	if !updated || s.notifier == nil {
+		return
+	}
+
+	loaded, err := s.loadMessage(message.ID)
+	if err != nil {
+		log.Printf("Failed to load message %d: %v", message.ID, err)
+		return
+	}
+	s.notifier.PublishMessageUpdated(loaded)
+}
+
+// keepLinkPreviews returns the previews whose links are still in content.
+func keepLinkPreviews(previews []models.LinkPreview, content string) []models.LinkPreview {
+	links := make(map[string]bool)
+	for _, link := range extractURLs(content) {
+		links[link] = true
+	}
+
+	var kept []models.LinkPreview
+	for _, preview := range previews {
+		if links[preview.URL] {
+			kept = append(kept, preview)
+		}
+	}
+	return kept
+}
+
+// extractURLs returns the first few distinct http(s) links in content.
+func extractURLs(content string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, match := range urlPattern.FindAllString(content, -1) {
+		match = strings.TrimRight(match, ".,;:!?)]}")
+		if u, err := url.Parse(match); err != nil || u.Host == "" {
+			continue
+		}
+		if seen[match] {
+			continue
+		}
+		seen[match] = true
+		urls = append(urls, match)
+		if len(urls) == maxLinkPreviews {
+			break
+		}
+	}
+	return urls
+}
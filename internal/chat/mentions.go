@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+// Presence reports which users are connected. It resolves @here.
+type Presence interface {
+	IsOnline(userID uint) bool
+}
+
+// mentionPattern matches an @ that starts a word, followed by the mentioned name.
+var mentionPattern = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([\p{L}\p{N}_.\-]+)`)
+
+// GetUnreadMentions returns the user's unread mentions, newest first.
+func (s *service) GetUnreadMentions(userID uint, limit, offset int) ([]models.MessageMention, error) {
+	return s.mentionRepo.GetUnread(userID, limit, offset)
+}
+
+// MarkMentionsRead marks the user's mentions in the given messages as read,
+// or all of them if messageIDs is empty.
+func (s *service) MarkMentionsRead(userID uint, messageIDs []uint) (int64, error) {
+	return s.mentionRepo.MarkRead(userID, messageIDs)
+}
+
+// resolveMentions finds the room members mentioned in content. A user
+// mentioned both by name and through @here or @room is recorded once, as a
+// direct mention. Senders never mention themselves.
+func (s *service) resolveMentions(senderID, roomID uint, content string) ([]models.MessageMention, error) {
+	matches := mentionPattern.FindAllStringSubmatch(content, -1)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	members, err := s.roomRepo.GetMembers(roomID)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]uint, len(members))
+	byFoldedName := make(map[string]uint, len(members))
+	for _, member := range members {
+		byName[member.Username] = member.ID
+		byFoldedName[strings.ToLower(member.Username)] = member.ID
+	}
+	lookup := func(name string) (uint, bool) {
+		if id, ok := byName[name]; ok {
+			return id, true
+		}
+		id, ok := byFoldedName[strings.ToLower(name)]
+		return id, ok
+	}
+
+	kinds := make(map[uint]models.MentionKind)
+	broadcast := func(kind models.MentionKind) {
+		for _, member := range members {
+			if _, ok := kinds[member.ID]; ok {
+				continue
+			}
+			if kind == models.MentionHere && !s.presence.IsOnline(member.ID) {
+				continue
+			}
+			kinds[member.ID] = kind
+		}
+	}
+
+	var here, room bool
+	for _, match := range matches {
+		name := match[1]
+		switch strings.ToLower(name) {
+		case "here":
+			here = true
+			continue
+		case "room":
+			room = true
+			continue
+		}
+
+		// Sentence punctuation after a name isn't part of it
+		id, ok := lookup(name)
+		if !ok {
+			id, ok = lookup(strings.TrimRight(name, ".-"))
+		}
+		if ok {
+			kinds[id] = models.MentionUser
+		}
+	}
+	if room {
+		broadcast(models.MentionRoom)
+	} else if here {
+		broadcast(models.MentionHere)
+	}
+
+	delete(kinds, senderID)
+	mentions := make([]models.MessageMention, 0, len(kinds))
+	for userID, kind := range kinds {
+		mentions = append(mentions, models.MessageMention{UserID: userID, Kind: kind})
+	}
+	return mentions, nil
+}
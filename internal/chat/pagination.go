@@ -0,0 +1,245 @@
+package chat
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// MessagePageRequest selects a page of a room's timeline. At most one of
+// Cursor, Before, After and Around may be set; with none of them the newest
+// messages are returned. Before, After and Around are message IDs.
+type MessagePageRequest struct {
+	Cursor string
+	Before uint
+	After  uint
+	Around uint
+	Limit  int
+}
+
+// MessagePage is a page of a room's timeline, oldest first. PrevCursor pages
+// towards older messages and is empty when there are none. NextCursor pages
+// towards newer messages and is empty when the page ends at the newest one.
+type MessagePage struct {
+	Messages   []models.Message `json:"messages"`
+	PrevCursor string           `json:"prev_cursor,omitempty"`
+	NextCursor string           `json:"next_cursor,omitempty"`
+}
+
+// pageLimit checks the limit of a list request and caps it at maxPageSize.
+func pageLimit(limit int) (int, error) {
+	if limit < 1 {
+		return 0, ErrInvalidLimit
+	}
+	return min(limit, maxPageSize), nil
+}
+
+// Cursor directions.
+const (
+	cursorOlder = 'o'
+	cursorNewer = 'n'
+)
+
+// GetRoomMessages returns a page of the room's timeline. Pages are keyed on
+// (created_at, id) rather than offsets, so messages arriving while a client
+// scrolls neither shift nor repeat what it sees.
+func (s *service) GetRoomMessages(userID, roomID uint, req MessagePageRequest) (*MessagePage, error) {
+	// Check if user can access room
+	canAccess, err := s.CanUserAccessRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+
+	anchors := 0
+	for _, set := range []bool{req.Cursor != "", req.Before != 0, req.After != 0, req.Around != 0} {
+		if set {
+			anchors++
+		}
+	}
+	if anchors > 1 {
+		return nil, ErrInvalidCursor
+	}
+
+	limit := req.Limit
+	if limit <= 0 {
+		limit = defaultPageSize
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	var (
+		messages           []models.Message
+		hasOlder, hasNewer bool
+	)
+	switch {
+	case req.Cursor != "":
+		direction, position, err := decodeCursor(req.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		if direction == cursorOlder {
+			messages, hasOlder, err = s.olderMessages(roomID, &position, limit)
+			hasNewer = true
+		} else {
+			messages, hasNewer, err = s.newerMessages(roomID, position, limit)
+			hasOlder = true
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	case req.Before != 0 || req.After != 0:
+		anchorID := req.Before
+		if req.After != 0 {
+			anchorID = req.After
+		}
+		anchor, err := s.anchorMessage(roomID, anchorID)
+		if err != nil {
+			return nil, err
+		}
+		if req.Before != 0 {
+			position := anchor.Cursor()
+			messages, hasOlder, err = s.olderMessages(roomID, &position, limit)
+			hasNewer = true
+		} else {
+			messages, hasNewer, err = s.newerMessages(roomID, anchor.Cursor(), limit)
+			hasOlder = true
+		}
+		if err != nil {
+			return nil, err
+		}
+
+	case req.Around != 0:
+		anchor, err := s.anchorMessage(roomID, req.Around)
+		if err != nil {
+			return nil, err
+		}
+		position := anchor.Cursor()
+
+		// Split the page around the anchor, which takes one slot
+		older, olderMore, err := s.olderMessages(roomID, &position, (limit-1)/2)
+		if err != nil {
+			return nil, err
+		}
+		newer, newerMore, err := s.newerMessages(roomID, position, limit-1-len(older))
+		if err != nil {
+			return nil, err
+		}
+		messages = append(append(older, *anchor), newer...)
+		hasOlder, hasNewer = olderMore, newerMore
+
+	default:
+		messages, hasOlder, err = s.olderMessages(roomID, nil, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.attachReactions(userID, messages); err != nil {
+		return nil, err
+	}
+	if err := s.attachPolls(userID, messages); err != nil {
+		return nil, err
+	}
+	if err := s.attachReplyPreviews(messages); err != nil {
+		return nil, err
+	}
+	s.signAttachments(messages)
+
+	page := &MessagePage{Messages: messages}
+	if page.Messages == nil {
+		page.Messages = []models.Message{}
+	}
+	if len(messages) > 0 {
+		if hasOlder {
+			page.PrevCursor = encodeCursor(cursorOlder, messages[0].Cursor())
+		}
+		if hasNewer {
+			page.NextCursor = encodeCursor(cursorNewer, messages[len(messages)-1].Cursor())
+		}
+	}
+	return page, nil
+}
+
+// olderMessages returns up to limit timeline messages before the position,
+// oldest first, and whether there are more before them.
+func (s *service) olderMessages(roomID uint, before *models.MessageCursor, limit int) ([]models.Message, bool, error) {
+	if limit <= 0 {
+		return nil, true, nil
+	}
+	messages, err := s.messageRepo.GetRoomMessagesBefore(roomID, before, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		return messages[1:], true, nil
+	}
+	return messages, false, nil
+}
+
+// newerMessages returns up to limit timeline messages after the position,
+// oldest first, and whether there are more after them.
+func (s *service) newerMessages(roomID uint, after models.MessageCursor, limit int) ([]models.Message, bool, error) {
+	if limit <= 0 {
+		return nil, true, nil
+	}
+	messages, err := s.messageRepo.GetRoomMessagesAfter(roomID, after, limit+1)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(messages) > limit {
+		return messages[:limit], true, nil
+	}
+	return messages, false, nil
+}
+
+// anchorMessage loads a message that a page is positioned relative to.
+// Deleted messages keep their place and can be anchors.
+func (s *service) anchorMessage(roomID, messageID uint) (*models.Message, error) {
+	message, err := s.messageRepo.GetByIDWithDeleted(messageID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotInRoom
+	}
+	if err != nil {
+		return nil, err
+	}
+	if message.RoomID != roomID {
+		return nil, ErrMessageNotInRoom
+	}
+	return message, nil
+}
+
+// encodeCursor makes an opaque cursor paging from position in a direction.
+func encodeCursor(direction byte, position models.MessageCursor) string {
+	raw := fmt.Sprintf("%c%d.%d", direction, position.CreatedAt.UnixNano(), position.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (byte, models.MessageCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) == 0 {
+		return 0, models.MessageCursor{}, ErrInvalidCursor
+	}
+
+	var nanos int64
+	var id uint
+	direction := raw[0]
+	n, err := fmt.Sscanf(string(raw[1:]), "%d.%d", &nanos, &id)
+	if err != nil || n != 2 || (direction != cursorOlder && direction != cursorNewer) {
+		return 0, models.MessageCursor{}, ErrInvalidCursor
+	}
+	return direction, models.MessageCursor{CreatedAt: time.Unix(0, nanos), ID: id}, nil
+}
@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+)
+
+// brokenMessageRepo fails every lookup, as with a dropped connection.
+type brokenMessageRepo struct {
+	repository.MessageRepository
+}
+
+var errConnection = errors.New("connection reset")
+
+func (brokenMessageRepo) GetByIDWithDeleted(id uint) (*models.Message, error) {
+	return nil, errConnection
+}
+
+func TestAnchorMessage(t *testing.T) {
+	s, messages, _ := newSystemTestService()
+	message := messages.add(&models.Message{UserID: 1, RoomID: 1, Content: "hi"})
+
+	if anchor, err := s.anchorMessage(1, message.ID); err != nil || anchor.ID != message.ID {
+		t.Fatalf("anchor in its room: %v, %v", anchor, err)
+	}
+	if _, err := s.anchorMessage(2, message.ID); !errors.Is(err, ErrMessageNotInRoom) {
+		t.Errorf("anchor in another room: err = %v, want ErrMessageNotInRoom", err)
+	}
+	if _, err := s.anchorMessage(1, message.ID+1); !errors.Is(err, ErrMessageNotInRoom) {
+		t.Errorf("missing anchor: err = %v, want ErrMessageNotInRoom", err)
+	}
+
+	s.messageRepo = brokenMessageRepo{}
+	if _, err := s.anchorMessage(1, message.ID); !errors.Is(err, errConnection) {
+		t.Errorf("failed lookup: err = %v, want it returned unchanged", err)
+	}
+}
+
+func TestPageLimit(t *testing.T) {
+	tests := []struct {
+		limit, want int
+		err         error
+	}{
+		{1, 1, nil},
+		{50, 50, nil},
+		{100, 100, nil},
+		{101, 100, nil},
+		{1 << 30, 100, nil},
+		{0, 0, ErrInvalidLimit},
+		{-5, 0, ErrInvalidLimit},
+	}
+	for _, tt := range tests {
+		if got, err := pageLimit(tt.limit); got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("pageLimit(%d) = %d, %v, want %d, %v", tt.limit, got, err, tt.want, tt.err)
+		}
+	}
+}
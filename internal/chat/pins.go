@@ -0,0 +1,126 @@
+package chat
+
+import (
+	"errors"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+)
+
+// PinMessage pins a message to its room. Only moderators and admins may pin.
+// The bool reports whether the message was newly pinned, in which case the
+// pin is published and a system message records it in the timeline.
+func (s *service) PinMessage(userID, messageID uint) (*models.Message, bool, error) {
+	message, err := s.pinnableMessage(userID, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	pinned, err := s.messageRepo.Pin(message, userID, s.cfg.MaxPinsPerRoom)
+	if errors.Is(err, repository.ErrPinLimit) {
+		return nil, false, ErrTooManyPins
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	loaded, err := s.loadMessage(message.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if pinned {
+		s.publishPin(loaded, true)
+		s.postSystemMessage(message.RoomID, &models.SystemEvent{
+			Action:    models.SystemMessagePinned,
+			ActorID:   userID,
+			MessageID: &message.ID,
+		})
+	}
+	return loaded, pinned, nil
+}
+
+// UnpinMessage unpins a message. Only moderators and admins may unpin. The
+// bool reports whether the message was pinned, in which case the unpin is
+// published and recorded like a pin.
+func (s *service) UnpinMessage(userID, messageID uint) (*models.Message, bool, error) {
+	message, err := s.pinnableMessage(userID, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	unpinned, err := s.messageRepo.Unpin(message)
+	if err != nil {
+		return nil, false, err
+	}
+	loaded, err := s.loadMessage(message.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if unpinned {
+		s.publishPin(loaded, false)
+		s.postSystemMessage(message.RoomID, &models.SystemEvent{
+			Action:    models.SystemMessageUnpinned,
+			ActorID:   userID,
+			MessageID: &message.ID,
+		})
+	}
+	return loaded, unpinned, nil
+}
+
+// publishPin publishes a pin or unpin ahead of the system message recording
+// it, which comes next in the room's sequence.
+func (s *service) publishPin(message *models.Message, pinned bool) {
+	if s.notifier != nil {
+		s.notifier.PublishMessagePinned(message, pinned)
+	}
+}
+
+// GetPinnedMessages returns the messages pinned in a room, most recently
+// pinned first, to its members.
+func (s *service) GetPinnedMessages(userID, roomID uint) ([]models.Message, error) {
+	canAccess, err := s.CanUserAccessRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+
+	messages, err := s.messageRepo.GetPinned(roomID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.attachReactions(userID, messages); err != nil {
+		return nil, err
+	}
+	if err := s.attachPolls(userID, messages); err != nil {
+		return nil, err
+	}
+	if err := s.attachReplyPreviews(messages); err != nil {
+		return nil, err
+	}
+	s.signAttachments(messages)
+
+	if messages == nil {
+		messages = []models.Message{}
+	}
+	return messages, nil
+}
+
+func (s *service) pinnableMessage(userID, messageID uint) (*models.Message, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message.Type == models.MessageTypeSystem {
+		return nil, ErrSystemMessage
+	}
+
+	isModerator, err := s.isModerator(userID, message.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !isModerator {
+		return nil, ErrModeratorRequired
+	}
+	return message, nil
+}
@@ -0,0 +1,267 @@
+package chat
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+)
+
+const (
+	maxPollOptions     = 10
+	maxPollQuestionLen = 300
+	maxPollOptionLen   = 100
+)
+
+// newPoll validates the poll of a message being sent.
+func newPoll(input *models.PollInput) (*models.Poll, error) {
+	question := strings.TrimSpace(input.Question)
+	if question == "" || utf8.RuneCountInString(question) > maxPollQuestionLen {
+		return nil, ErrInvalidPoll
+	}
+	if len(input.Options) < 2 || len(input.Options) > maxPollOptions {
+		return nil, ErrInvalidPoll
+	}
+	if input.ClosesAt != nil && !input.ClosesAt.After(time.Now()) {
+		return nil, ErrInvalidPoll
+	}
+
+	poll := &models.Poll{
+		Question:       question,
+		MultipleChoice: input.MultipleChoice,
+		Anonymous:      input.Anonymous,
+		ClosesAt:       input.ClosesAt,
+	}
+	seen := make(map[string]bool)
+	for i, text := range input.Options {
+		text = strings.TrimSpace(text)
+		if text == "" || utf8.RuneCountInString(text) > maxPollOptionLen || seen[text] {
+			return nil, ErrInvalidPoll
+		}
+		seen[text] = true
+		poll.Options = append(poll.Options, models.PollOption{Position: i, Text: text})
+	}
+	return poll, nil
+}
+
+// VotePoll sets the user's votes on a poll to optionIDs, replacing earlier
+// ones; no options takes the user's votes back. The bool reports whether the
+// votes changed.
+func (s *service) VotePoll(userID, messageID uint, optionIDs []uint) (*models.PollChange, bool, error) {
+	message, err := s.pollMessage(userID, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	optionIDs = uniqueIDs(optionIDs)
+	if len(optionIDs) > maxPollOptions {
+		return nil, false, ErrInvalidVote
+	}
+	if len(optionIDs) > 1 {
+		polls, err := s.pollRepo.GetByMessageIDs([]uint{message.ID})
+		if err != nil {
+			return nil, false, err
+		}
+		if poll := polls[message.ID]; poll != nil && !poll.MultipleChoice {
+			return nil, false, ErrInvalidVote
+		}
+	}
+
+	seq, err := s.pollRepo.Vote(message, userID, optionIDs)
+	if errors.Is(err, repository.ErrPollClosed) {
+		return nil, false, ErrPollClosed
+	}
+	if errors.Is(err, repository.ErrPollOption) {
+		return nil, false, ErrInvalidVote
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	change, err := s.pollChange(message, userID, seq)
+	return change, seq != 0, err
+}
+
+// ClosePoll ends voting on a poll before its closing time. Only the poll's
+// creator and room moderators may. The bool reports whether the poll was
+// still open.
+func (s *service) ClosePoll(userID, messageID uint) (*models.PollChange, bool, error) {
+	message, err := s.pollMessage(userID, messageID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if message.UserID != userID {
+		isModerator, err := s.isModerator(userID, message.RoomID)
+		if err != nil {
+			return nil, false, err
+		}
+		if !isModerator {
+			return nil, false, ErrCannotClosePoll
+		}
+	}
+
+	seq, err := s.pollRepo.Close(message, userID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	change, err := s.pollChange(message, userID, seq)
+	return change, seq != 0, err
+}
+
+// closeDuePolls closes the polls whose closing time has passed, each as a
+// change in its room, and publishes their final tallies.
+func (s *service) closeDuePolls() error {
+	for {
+		changes, err := s.pollRepo.CloseDue(time.Now(), scheduledBatchSize)
+		if err != nil {
+			return err
+		}
+
+		if len(changes) > 0 {
+			ids := make([]uint, len(changes))
+			for i, change := range changes {
+				ids[i] = change.MessageID
+			}
+			polls, err := s.loadPolls(0, ids)
+			if err != nil {
+				return err
+			}
+			for i := range changes {
+				changes[i].Poll = polls[changes[i].MessageID]
+				if s.notifier != nil && changes[i].Poll != nil {
+					s.notifier.PublishPollUpdated(&changes[i])
+				}
+			}
+		}
+
+		if len(changes) < scheduledBatchSize {
+			return nil
+		}
+	}
+}
+
+func (s *service) pollMessage(userID, messageID uint) (*models.Message, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	canAccess, err := s.CanUserAccessRoom(userID, message.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+	if message.Type != models.MessageTypePoll {
+		return nil, ErrNotPoll
+	}
+	return message, nil
+}
+
+func (s *service) pollChange(message *models.Message, viewerID uint, seq uint64) (*models.PollChange, error) {
+	polls, err := s.loadPolls(viewerID, []uint{message.ID})
+	if err != nil {
+		return nil, err
+	}
+	return &models.PollChange{
+		RoomID:    message.RoomID,
+		MessageID: message.ID,
+		Poll:      polls[message.ID],
+		Seq:       seq,
+	}, nil
+}
+
+// attachPolls fills in the polls of the poll messages among messages, with
+// their tallies as seen by viewerID.
+func (s *service) attachPolls(viewerID uint, messages []models.Message) error {
+	var ids []uint
+	for _, m := range messages {
+		if m.Type == models.MessageTypePoll && m.Tombstone == nil {
+			ids = append(ids, m.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	polls, err := s.loadPolls(viewerID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		if poll, ok := polls[messages[i].ID]; ok {
+			messages[i].Poll = poll
+		}
+	}
+	return nil
+}
+
+// loadPolls loads the polls of the given messages and tallies their votes.
+// Who voted for what is only given on public polls; MyVotes is filled in
+// for viewerID, which may be 0 for nobody.
+func (s *service) loadPolls(viewerID uint, messageIDs []uint) (map[uint]*models.Poll, error) {
+	polls, err := s.pollRepo.GetByMessageIDs(messageIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	pollIDs := make([]uint, 0, len(polls))
+	byID := make(map[uint]*models.Poll, len(polls))
+	for _, poll := range polls {
+		pollIDs = append(pollIDs, poll.ID)
+		byID[poll.ID] = poll
+	}
+	votes, err := s.pollRepo.Votes(pollIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	voters := make(map[uint]map[uint]bool)
+	options := make(map[uint]*models.PollOption)
+	for _, poll := range polls {
+		voters[poll.ID] = make(map[uint]bool)
+		for i := range poll.Options {
+			options[poll.Options[i].ID] = &poll.Options[i]
+		}
+	}
+	for _, vote := range votes {
+		poll, option := byID[vote.PollID], options[vote.OptionID]
+		if poll == nil || option == nil {
+			continue
+		}
+		option.Votes++
+		if !poll.Anonymous {
+			option.VoterIDs = append(option.VoterIDs, vote.UserID)
+		}
+		if viewerID != 0 && vote.UserID == viewerID {
+			poll.MyVotes = append(poll.MyVotes, vote.OptionID)
+		}
+		voters[poll.ID][vote.UserID] = true
+	}
+
+	now := time.Now()
+	for _, poll := range polls {
+		poll.TotalVoters = int64(len(voters[poll.ID]))
+		poll.Closed = poll.IsClosed(now)
+	}
+	return polls, nil
+}
+
+// uniqueIDs drops repeated IDs, keeping the first of each.
+func uniqueIDs(ids []uint) []uint {
+	seen := make(map[uint]bool, len(ids))
+	unique := make([]uint, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+)
+
+// fakePollRepo holds polls by message ID and closes them like the Postgres
+// repository.
+type fakePollRepo struct {
+	repository.PollRepository
+	messages *fakeMessageRepo
+	polls    map[uint]*models.Poll
+}
+
+func (r *fakePollRepo) CloseDue(now time.Time, limit int) ([]models.PollChange, error) {
+	var changes []models.PollChange
+	for messageID, poll := range r.polls {
+		if len(changes) == limit || poll.ClosedAt != nil || poll.ClosesAt == nil || poll.ClosesAt.After(now) {
+			continue
+		}
+		r.messages.seq++
+		poll.ClosedAt = poll.ClosesAt
+		message := r.messages.messages[messageID]
+		message.UpdatedSeq = r.messages.seq
+		changes = append(changes, models.PollChange{RoomID: message.RoomID, MessageID: messageID, Seq: r.messages.seq})
+	}
+	return changes, nil
+}
+
+func (r *fakePollRepo) GetByMessageIDs(messageIDs []uint) (map[uint]*models.Poll, error) {
+	polls := make(map[uint]*models.Poll)
+	for _, id := range messageIDs {
+		if poll, ok := r.polls[id]; ok {
+			loaded := *poll
+			polls[id] = &loaded
+		}
+	}
+	return polls, nil
+}
+
+func (r *fakePollRepo) Votes(pollIDs []uint) ([]models.PollVote, error) {
+	return nil, nil
+}
+
+func TestDuePollsAreClosedAndPublished(t *testing.T) {
+	s, messages, notifier := newSystemTestService()
+	polls := &fakePollRepo{messages: messages, polls: map[uint]*models.Poll{}}
+	s.pollRepo = polls
+
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+	due := messages.add(&models.Message{UserID: 1, RoomID: 1, Type: models.MessageTypePoll})
+	open := messages.add(&models.Message{UserID: 1, RoomID: 1, Type: models.MessageTypePoll})
+	polls.polls[due.ID] = &models.Poll{ID: 1, MessageID: due.ID, ClosesAt: &past}
+	polls.polls[open.ID] = &models.Poll{ID: 2, MessageID: open.ID, ClosesAt: &future}
+
+	if err := s.closeDuePolls(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.closeDuePolls(); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, notifier.events, "poll 1 true 3")
+}
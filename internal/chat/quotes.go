@@ -0,0 +1,156 @@
+package chat
+
+import (
+	"errors"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+// previewLength is the number of characters of a quoted message shown inline.
+const previewLength = 140
+
+// ForwardMessage copies a message into another room the user belongs to,
+// crediting its original author. Forwarding a forwarded message keeps the
+// original attribution. clientMsgID makes retries safe as in CreateMessage.
+func (s *service) ForwardMessage(userID, messageID, roomID uint, clientMsgID string) (*models.Message, bool, error) {
+	source, err := s.messageRepo.GetByIDWithRelations(messageID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if source.Type == models.MessageTypeSystem {
+		return nil, false, ErrSystemMessage
+	}
+	if source.Type == models.MessageTypePoll {
+		return nil, false, ErrPollMessage
+	}
+
+	// The user must be able to read the original and post to the target
+	for _, id := range []uint{source.RoomID, roomID} {
+		canAccess, err := s.CanUserAccessRoom(userID, id)
+		if err != nil {
+			return nil, false, err
+		}
+		if !canAccess {
+			return nil, false, ErrAccessDenied
+		}
+	}
+
+	attribution := source.ForwardedFrom
+	if attribution == nil {
+		attribution = &models.ForwardAttribution{
+			MessageID: source.ID,
+			UserID:    source.UserID,
+			Username:  source.User.Username,
+			SentAt:    source.CreatedAt,
+		}
+	}
+
+	message := &models.Message{
+		Content:       source.Content,
+		UserID:        userID,
+		RoomID:        roomID,
+		Type:          source.Type,
+		ForwardedFrom: attribution,
+		Format:        source.Format,
+		HTML:          source.HTML,
+		PlainText:     source.PlainText,
+		LinkPreviews:  source.LinkPreviews,
+	}
+	if clientMsgID != "" {
+		message.ClientMsgID = &clientMsgID
+	}
+
+	// Copies share the stored files, which stay charged to their uploader
+	for _, a := range source.Attachments {
+		message.Attachments = append(message.Attachments, models.Attachment{
+			UserID:     a.UserID,
+			StorageKey: a.StorageKey,
+			Filename:   a.Filename,
+			MimeType:   a.MimeType,
+			Size:       a.Size,
+			Checksum:   a.Checksum,
+			Width:      a.Width,
+			Height:     a.Height,
+			Blurhash:   a.Blurhash,
+			Thumbnails: a.Thumbnails,
+			DurationMs: a.DurationMs,
+			Waveform:   a.Waveform,
+		})
+	}
+
+	return s.storeMessage(message)
+}
+
+// replyPreview builds the preview of the message quoted by message.
+func (s *service) replyPreview(message *models.Message) (*models.MessagePreview, error) {
+	quoted, err := s.messageRepo.GetByIDWithDeleted(*message.ReplyToID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return previewOf(message, nil), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return previewOf(message, quoted), nil
+}
+
+// attachReplyPreviews fills in the previews of the messages quoted by messages.
+func (s *service) attachReplyPreviews(messages []models.Message) error {
+	var ids []uint
+	for _, m := range messages {
+		if m.ReplyToID != nil {
+			ids = append(ids, *m.ReplyToID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	quoted, err := s.messageRepo.GetByIDsWithDeleted(ids)
+	if err != nil {
+		return err
+	}
+	byID := make(map[uint]*models.Message, len(quoted))
+	for i := range quoted {
+		byID[quoted[i].ID] = &quoted[i]
+	}
+
+	for i := range messages {
+		if messages[i].ReplyToID != nil {
+			messages[i].ReplyTo = previewOf(&messages[i], byID[*messages[i].ReplyToID])
+		}
+	}
+	return nil
+}
+
+// previewOf builds the preview of quoted as shown inside message. Quotes are
+// only accepted within a room, so everyone who can see message can see
+// quoted; the room is still compared here so a preview never carries another
+// room's content.
+func previewOf(message, quoted *models.Message) *models.MessagePreview {
+	if quoted == nil || quoted.RoomID != message.RoomID {
+		return &models.MessagePreview{ID: *message.ReplyToID, Unavailable: true}
+	}
+
+	preview := &models.MessagePreview{
+		ID:        quoted.ID,
+		UserID:    quoted.UserID,
+		Username:  quoted.User.Username,
+		CreatedAt: &quoted.CreatedAt,
+	}
+	if quoted.Tombstone != nil {
+		preview.Deleted = true
+		return preview
+	}
+
+	snippet := []rune(quoted.PlainText)
+	if len(snippet) > previewLength {
+		preview.Snippet = string(snippet[:previewLength]) + "…"
+	} else {
+		preview.Snippet = quoted.PlainText
+	}
+	return preview
+}
@@ -0,0 +1,139 @@
+package chat
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+	"gorm.io/gorm"
+)
+
+var shortcodePattern = regexp.MustCompile(`^:[a-z0-9_+-]{1,62}:$`)
+
+// AddReaction reacts to a message with an emoji. The bool reports whether the
+// reaction is new; reacting twice with the same emoji is a no-op.
+func (s *service) AddReaction(userID, messageID uint, emoji string) (*models.ReactionChange, bool, error) {
+	message, err := s.reactableMessage(userID, messageID, emoji)
+	if err != nil {
+		return nil, false, err
+	}
+
+	seq, count, err := s.reactionRepo.Add(&models.MessageReaction{
+		MessageID: message.ID,
+		UserID:    userID,
+		Emoji:     emoji,
+	}, s.cfg.MaxReactionEmoji)
+	if errors.Is(err, repository.ErrReactionLimit) {
+		return nil, false, ErrTooManyReactions
+	}
+	// The message may have been deleted since it was checked
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return reactionChange(message, userID, emoji, seq, count), seq != 0, nil
+}
+
+// RemoveReaction takes back one of the user's reactions. The bool reports
+// whether there was a reaction to remove.
+func (s *service) RemoveReaction(userID, messageID uint, emoji string) (*models.ReactionChange, bool, error) {
+	message, err := s.reactableMessage(userID, messageID, emoji)
+	if err != nil {
+		return nil, false, err
+	}
+
+	seq, count, err := s.reactionRepo.Remove(message.ID, userID, emoji)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return reactionChange(message, userID, emoji, seq, count), seq != 0, nil
+}
+
+func (s *service) reactableMessage(userID, messageID uint, emoji string) (*models.Message, error) {
+	if !validEmoji(emoji) {
+		return nil, ErrInvalidEmoji
+	}
+
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	canAccess, err := s.CanUserAccessRoom(userID, message.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+	return message, nil
+}
+
+func reactionChange(message *models.Message, userID uint, emoji string, seq uint64, count int64) *models.ReactionChange {
+	return &models.ReactionChange{
+		RoomID:    message.RoomID,
+		MessageID: message.ID,
+		UserID:    userID,
+		Emoji:     emoji,
+		Count:     count,
+		Seq:       seq,
+	}
+}
+
+// attachReactions fills in the reaction summaries of messages as seen by viewerID.
+func (s *service) attachReactions(viewerID uint, messages []models.Message) error {
+	ids := make([]uint, 0, len(messages))
+	for _, m := range messages {
+		if m.Tombstone == nil {
+			ids = append(ids, m.ID)
+		}
+	}
+
+	summaries, err := s.reactionRepo.Summaries(ids, viewerID)
+	if err != nil {
+		return err
+	}
+	for i := range messages {
+		messages[i].Reactions = summaries[messages[i].ID]
+	}
+	return nil
+}
+
+// validEmoji accepts a :shortcode: of lowercase letters, digits and _+- or
+// a sequence of up to 64 bytes of emoji: symbols, with the joiners,
+// variation selectors, skin tone modifiers and tags that combine them, and
+// digits, # and * only as keycaps.
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > 64 {
+		return false
+	}
+	if shortcodePattern.MatchString(emoji) {
+		return true
+	}
+
+	keycap := strings.ContainsRune(emoji, '\u20E3')
+	for _, r := range emoji {
+		switch {
+		case r < 0x80:
+			if !keycap || !strings.ContainsRune("0123456789#*", r) {
+				return false
+			}
+		case unicode.In(r, unicode.So, unicode.Sm, unicode.Sk):
+		case r == '\u200D', r == '\uFE0E', r == '\uFE0F', r == '\u20E3':
+		case r >= 0xE0020 && r <= 0xE007F:
+		case r == '\u203C', r == '\u2049', r == '\u2139', r == '\u3030', r == '\u303D':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+	"gorm.io/gorm"
+)
+
+func TestValidEmoji(t *testing.T) {
+	tests := map[string]bool{
+		"👍":              true,
+		"👍🏽":             true,
+		"❤️":             true,
+		"👨‍👩‍👧":          true,
+		"🇳🇬":             true,
+		"1️⃣":            true,
+		"#️⃣":            true,
+		"🏴󠁧󠁢󠁳󠁣󠁴󠁿":        true,
+		"‼️":             true,
+		":thumbsup:":     true,
+		":+1:":           true,
+		":party_parrot:": true,
+		"":               false,
+		"lol":            false,
+		"<script>":       false,
+		"1":              false,
+		"::":             false,
+		":Thumbs Up:":    false,
+		"👍 👍":            false,
+		"a👍":             false,
+		"é":              false,
+		"👍\n":            false,
+	}
+	for emoji, want := range tests {
+		if got := validEmoji(emoji); got != want {
+			t.Errorf("validEmoji(%q) = %v, want %v", emoji, got, want)
+		}
+	}
+}
+
+// goneReactionRepo acts as if the message was deleted after the service
+// checked it.
+type goneReactionRepo struct {
+	repository.ReactionRepository
+}
+
+func (goneReactionRepo) Add(reaction *models.MessageReaction, maxDistinct int) (uint64, int64, error) {
+	return 0, 0, gorm.ErrRecordNotFound
+}
+
+func (goneReactionRepo) Remove(messageID, userID uint, emoji string) (uint64, int64, error) {
+	return 0, 0, gorm.ErrRecordNotFound
+}
+
+func TestReactionToMessageDeletedMeanwhile(t *testing.T) {
+	s, messages, _ := newSystemTestService()
+	s.reactionRepo = goneReactionRepo{}
+	message := messages.add(&models.Message{UserID: 2, RoomID: 1, Content: "hi"})
+
+	if _, _, err := s.AddReaction(1, message.ID, "👍"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("AddReaction: err = %v, want ErrMessageNotFound", err)
+	}
+	if _, _, err := s.RemoveReaction(1, message.ID, "👍"); !errors.Is(err, ErrMessageNotFound) {
+		t.Errorf("RemoveReaction: err = %v, want ErrMessageNotFound", err)
+	}
+}
@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+// unreadCountCap bounds how many unread messages are counted per room. Room
+// lists only need to tell "a few" from "a lot".
+const unreadCountCap = 100
+
+// GetUserRooms lists the user's rooms with their newest message and how many
+// messages the user hasn't read yet.
+func (s *service) GetUserRooms(userID uint) ([]models.RoomSummary, error) {
+	rooms, err := s.roomRepo.GetUserRooms(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	activity, err := s.roomRepo.GetActivity(userID, unreadCountCap)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastIDs []uint
+	for _, a := range activity {
+		if a.LastMessageID != nil {
+			lastIDs = append(lastIDs, *a.LastMessageID)
+		}
+	}
+	lastMessages, err := s.messageRepo.GetByIDsWithDeleted(lastIDs)
+	if err != nil {
+		return nil, err
+	}
+	s.signAttachments(lastMessages)
+	byID := make(map[uint]*models.Message, len(lastMessages))
+	for i := range lastMessages {
+		byID[lastMessages[i].ID] = &lastMessages[i]
+	}
+
+	summaries := make([]models.RoomSummary, len(rooms))
+	for i, room := range rooms {
+		a := activity[room.ID]
+		summaries[i] = models.RoomSummary{
+			Room:              room,
+			LastReadMessageID: a.LastReadMessageID,
+			UnreadCount:       a.UnreadCount,
+			UnreadCountCapped: a.UnreadCount >= unreadCountCap,
+		}
+		if a.LastMessageID != nil {
+			summaries[i].LastMessage = byID[*a.LastMessageID]
+		}
+	}
+	return summaries, nil
+}
+
+// MarkRead moves the user's read position in a room forward to messageID.
+// The bool reports whether it moved; marking an older message is a no-op.
+func (s *service) MarkRead(userID, roomID, messageID uint) (*models.ReadPosition, bool, error) {
+	canAccess, err := s.CanUserAccessRoom(userID, roomID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !canAccess {
+		return nil, false, ErrAccessDenied
+	}
+
+	// Deleted messages still hold their place in the timeline
+	message, err := s.messageRepo.GetByIDWithDeleted(messageID)
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && message.RoomID != roomID) {
+		return nil, false, ErrMessageNotInRoom
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	position := &models.ReadPosition{
+		RoomID:    roomID,
+		UserID:    userID,
+		MessageID: message.ID,
+		ReadAt:    time.Now(),
+	}
+	moved, err := s.roomRepo.MarkRead(roomID, userID, message.ID, position.ReadAt)
+	if err != nil {
+		return nil, false, err
+	}
+	return position, moved, nil
+}
+
+// GetReadPositions returns how far each member of a room has read.
+func (s *service) GetReadPositions(userID, roomID uint) ([]models.ReadPosition, error) {
+	canAccess, err := s.CanUserAccessRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+
+	return s.roomRepo.GetReadPositions(roomID)
+}
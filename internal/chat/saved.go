@@ -0,0 +1,103 @@
+package chat
+
+import (
+	"errors"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+// SaveMessage bookmarks a message the user can see, with a private note. The
+// bool reports whether the bookmark is new; saving a message twice returns
+// the existing bookmark unchanged.
+func (s *service) SaveMessage(userID, messageID uint, note string) (*models.SavedItem, bool, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	canAccess, err := s.CanUserAccessRoom(userID, message.RoomID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !canAccess {
+		return nil, false, ErrAccessDenied
+	}
+
+	created, err := s.savedItemRepo.Create(&models.SavedItem{
+		UserID:    userID,
+		MessageID: message.ID,
+		Note:      note,
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	item, err := s.savedItemRepo.GetVisibleByMessage(userID, message.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	s.signSavedItem(item)
+	return item, created, nil
+}
+
+// GetSavedItems returns the user's bookmarks, most recently saved first.
+// Bookmarks of deleted messages and in rooms the user has left are left out.
+func (s *service) GetSavedItems(userID uint, limit, offset int) ([]models.SavedItem, error) {
+	limit, err := pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	items, err := s.savedItemRepo.List(userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		s.signSavedItem(&items[i])
+	}
+	if items == nil {
+		items = []models.SavedItem{}
+	}
+	return items, nil
+}
+
+// UpdateSavedItem replaces the note of one of the user's visible bookmarks.
+func (s *service) UpdateSavedItem(userID, itemID uint, note string) (*models.SavedItem, error) {
+	item, err := s.savedItemRepo.GetVisible(userID, itemID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSavedItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	item.Note = note
+	if err := s.savedItemRepo.UpdateNote(item); err != nil {
+		return nil, err
+	}
+	s.signSavedItem(item)
+	return item, nil
+}
+
+// DeleteSavedItem removes one of the user's bookmarks, including ones hidden
+// because the message or the user's access to it is gone.
+func (s *service) DeleteSavedItem(userID, itemID uint) (*models.SavedItem, error) {
+	item, err := s.savedItemRepo.GetByID(userID, itemID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrSavedItemNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.savedItemRepo.Delete(item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+func (s *service) signSavedItem(item *models.SavedItem) {
+	if item.Message != nil {
+		s.signMessageAttachments(item.Message)
+	}
+}
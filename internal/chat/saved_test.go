@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+)
+
+// listingSavedItemRepo records the limit each listing asks for.
+type listingSavedItemRepo struct {
+	repository.SavedItemRepository
+	limits []int
+}
+
+func (r *listingSavedItemRepo) List(userID uint, limit, offset int) ([]models.SavedItem, error) {
+	r.limits = append(r.limits, limit)
+	return nil, nil
+}
+
+func TestGetSavedItemsLimit(t *testing.T) {
+	s, _, _ := newSystemTestService()
+	saved := &listingSavedItemRepo{}
+	s.savedItemRepo = saved
+
+	for _, limit := range []int{0, -1} {
+		if _, err := s.GetSavedItems(1, limit, 0); !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("GetSavedItems with limit %d: err = %v, want ErrInvalidLimit", limit, err)
+		}
+	}
+	for _, limit := range []int{20, 1000} {
+		items, err := s.GetSavedItems(1, limit, 0)
+		if err != nil || items == nil {
+			t.Fatalf("GetSavedItems with limit %d = %v, %v", limit, items, err)
+		}
+	}
+	if len(saved.limits) != 2 || saved.limits[0] != 20 || saved.limits[1] != maxPageSize {
+		t.Errorf("listed with limits %v, want [20 %d]", saved.limits, maxPageSize)
+	}
+}
@@ -0,0 +1,309 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+	"gorm.io/gorm"
+)
+
+const (
+	scheduledBatchSize   = 50
+	maxScheduledAttempts = 5
+)
+
+// ScheduleMessage stores a message to be sent to a room at sendAt. Scheduled
+// messages cannot carry attachments: unsent uploads are purged before most
+// schedules would come due.
+func (s *service) ScheduleMessage(userID, roomID uint, req ScheduleMessageRequest) (*models.ScheduledJob, error) {
+	canAccess, err := s.CanUserAccessRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+
+	job := &models.ScheduledJob{
+		UserID:            userID,
+		Kind:              models.ScheduledMessage,
+		Status:            models.ScheduledPending,
+		RunAt:             req.SendAt,
+		RoomID:            roomID,
+		Content:           req.Content,
+		Format:            models.MessageFormat(req.Format),
+		AlsoSendToChannel: req.AlsoSendToChannel,
+	}
+	if req.ParentID != 0 {
+		job.ParentID = &req.ParentID
+	}
+	if req.ReplyToID != 0 {
+		job.ReplyToID = &req.ReplyToID
+	}
+	if err := checkScheduledContent(job); err != nil {
+		return nil, err
+	}
+	return job, s.createScheduled(job)
+}
+
+// RemindMe schedules a reminder about a message the user can see.
+func (s *service) RemindMe(userID, messageID uint, remindAt time.Time, note string) (*models.ScheduledJob, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	canAccess, err := s.CanUserAccessRoom(userID, message.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+
+	job := &models.ScheduledJob{
+		UserID:    userID,
+		Kind:      models.ScheduledReminder,
+		Status:    models.ScheduledPending,
+		RunAt:     remindAt,
+		RoomID:    message.RoomID,
+		MessageID: &message.ID,
+		Note:      note,
+	}
+	return job, s.createScheduled(job)
+}
+
+func (s *service) createScheduled(job *models.ScheduledJob) error {
+	if !job.RunAt.After(time.Now()) {
+		return ErrInvalidSchedule
+	}
+
+	err := s.scheduledRepo.Create(job, s.cfg.MaxScheduled)
+	if errors.Is(err, repository.ErrTooManyScheduled) {
+		return ErrTooManyScheduled
+	}
+	return err
+}
+
+// GetScheduled returns the user's scheduled messages and reminders that have
+// not fired yet, or failed to, soonest first.
+func (s *service) GetScheduled(userID uint, limit, offset int) ([]models.ScheduledJob, error) {
+	limit, err := pageLimit(limit)
+	if err != nil {
+		return nil, err
+	}
+	jobs, err := s.scheduledRepo.List(userID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	if jobs == nil {
+		jobs = []models.ScheduledJob{}
+	}
+	return jobs, nil
+}
+
+// UpdateScheduled changes a scheduled message or reminder that has not fired
+// yet. A failed one is retried at its new time, if the user is below their
+// limit of pending jobs.
+func (s *service) UpdateScheduled(userID, jobID uint, req UpdateScheduledRequest) (*models.ScheduledJob, error) {
+	job, err := s.scheduledRepo.GetByID(userID, jobID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrScheduledNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if req.RunAt != nil {
+		job.RunAt = *req.RunAt
+	}
+	if job.Kind == models.ScheduledMessage {
+		if req.Content != nil {
+			job.Content = *req.Content
+		}
+		if req.Format != nil {
+			job.Format = models.MessageFormat(*req.Format)
+		}
+		if err := checkScheduledContent(job); err != nil {
+			return nil, err
+		}
+	} else if req.Note != nil {
+		job.Note = *req.Note
+	}
+	if !job.RunAt.After(time.Now()) {
+		return nil, ErrInvalidSchedule
+	}
+
+	job.Status = models.ScheduledPending
+	job.Attempts = 0
+	job.Error = ""
+	updated, err := s.scheduledRepo.Update(job, s.cfg.MaxScheduled)
+	if errors.Is(err, repository.ErrTooManyScheduled) {
+		return nil, ErrTooManyScheduled
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !updated {
+		return nil, ErrScheduledNotFound
+	}
+	return job, nil
+}
+
+// CancelScheduled deletes a scheduled message or reminder that has not fired.
+func (s *service) CancelScheduled(userID, jobID uint) error {
+	deleted, err := s.scheduledRepo.Delete(userID, jobID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrScheduledNotFound
+	}
+	return nil
+}
+
+// RunScheduledJobs fires the scheduled messages and reminders that are due
+// and returns how many it fired. Messages are sent as if the user had sent
+// them then and published to the room; reminders, and messages that could
+// not be sent, are published to the user. Polls whose closing time has come
+// are closed and published too.
+func (s *service) RunScheduledJobs() (int, error) {
+	if err := s.closeDuePolls(); err != nil {
+		return 0, err
+	}
+
+	fired := 0
+	for {
+		jobs, err := s.scheduledRepo.FireDue(time.Now(), scheduledBatchSize, s.fireJob)
+		if err != nil {
+			return fired, err
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			if job.Status == models.ScheduledPending {
+				continue
+			}
+			fired++
+			if s.notifier == nil {
+				continue
+			}
+			// A retry finding its message deleted since has nothing to show
+			if job.Kind == models.ScheduledMessage && job.Status == models.ScheduledSent && job.Message.Tombstone == nil {
+				s.notifier.PublishMessage(job.Message)
+			}
+			s.notifier.PublishScheduledJob(job)
+		}
+
+		if len(jobs) < scheduledBatchSize {
+			return fired, nil
+		}
+	}
+}
+
+// fireJob sends a scheduled message or loads a reminder's message, and
+// records the outcome on job. Errors that may pass are retried later, a few
+// times; the rest fail the job.
+func (s *service) fireJob(job *models.ScheduledJob) {
+	var err error
+	switch job.Kind {
+	case models.ScheduledMessage:
+		err = s.sendScheduledMessage(job)
+	case models.ScheduledReminder:
+		err = s.loadReminder(job)
+	default:
+		err = fmt.Errorf("unknown scheduled job kind %q", job.Kind)
+	}
+
+	switch {
+	case err == nil:
+		job.Status = models.ScheduledSent
+	case isRequestError(err):
+		job.Status = models.ScheduledFailed
+		job.Error = err.Error()
+	default:
+		log.Printf("Failed to fire scheduled job %d: %v", job.ID, err)
+		job.Attempts++
+		job.Error = err.Error()
+		if job.Attempts >= maxScheduledAttempts {
+			job.Status = models.ScheduledFailed
+			return
+		}
+		job.RunAt = time.Now().Add(time.Duration(job.Attempts) * time.Minute)
+	}
+}
+
+// sendScheduledMessage sends the message of job. The job's ID is used as the
+// client message ID, so firing a job twice sends it once.
+func (s *service) sendScheduledMessage(job *models.ScheduledJob) error {
+	input := models.MessageInput{
+		Content:           job.Content,
+		Format:            job.Format,
+		ClientMsgID:       fmt.Sprintf("scheduled-%d", job.ID),
+		AlsoSendToChannel: job.AlsoSendToChannel,
+	}
+	if job.ParentID != nil {
+		input.ParentID = *job.ParentID
+	}
+	if job.ReplyToID != nil {
+		input.ReplyToID = *job.ReplyToID
+	}
+
+	message, _, err := s.CreateMessage(job.UserID, job.RoomID, input)
+	if err != nil {
+		return err
+	}
+	job.MessageID = &message.ID
+	job.Message = message
+	return nil
+}
+
+// loadReminder loads the message a reminder is about, if the user can still
+// see it.
+func (s *service) loadReminder(job *models.ScheduledJob) error {
+	canAccess, err := s.CanUserAccessRoom(job.UserID, job.RoomID)
+	if err != nil {
+		return err
+	}
+	if !canAccess {
+		return ErrAccessDenied
+	}
+
+	if _, err := s.getMessage(*job.MessageID); err != nil {
+		return err
+	}
+	job.Message, err = s.loadMessage(*job.MessageID)
+	return err
+}
+
+// checkScheduledContent validates a scheduled message's content as
+// CreateMessage will when it is sent.
+func checkScheduledContent(job *models.ScheduledJob) error {
+	if strings.TrimSpace(job.Content) == "" {
+		return ErrEmptyMessage
+	}
+	message := &models.Message{Content: job.Content, Format: job.Format}
+	if err := renderContent(message); err != nil {
+		return err
+	}
+	job.Format = message.Format
+	return nil
+}
+
+// isRequestError reports whether err is about the request itself, so trying
+// again will not help.
+func isRequestError(err error) bool {
+	for _, target := range []error{
+		ErrAccessDenied, ErrMessageNotFound, ErrInvalidParent, ErrInvalidReplyTo, ErrEmptyMessage, ErrInvalidFormat,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
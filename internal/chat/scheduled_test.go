@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+)
+
+// listingScheduledRepo records the limit each listing asks for.
+type listingScheduledRepo struct {
+	repository.ScheduledJobRepository
+	limits []int
+}
+
+func (r *listingScheduledRepo) List(userID uint, limit, offset int) ([]models.ScheduledJob, error) {
+	r.limits = append(r.limits, limit)
+	return nil, nil
+}
+
+func TestGetScheduledLimit(t *testing.T) {
+	s, _, _ := newSystemTestService()
+	scheduled := &listingScheduledRepo{}
+	s.scheduledRepo = scheduled
+
+	for _, limit := range []int{0, -1} {
+		if _, err := s.GetScheduled(1, limit, 0); !errors.Is(err, ErrInvalidLimit) {
+			t.Errorf("GetScheduled with limit %d: err = %v, want ErrInvalidLimit", limit, err)
+		}
+	}
+	for _, limit := range []int{20, 1000} {
+		jobs, err := s.GetScheduled(1, limit, 0)
+		if err != nil || jobs == nil {
+			t.Fatalf("GetScheduled with limit %d = %v, %v", limit, jobs, err)
+		}
+	}
+	if len(scheduled.limits) != 2 || scheduled.limits[0] != 20 || scheduled.limits[1] != maxPageSize {
+		t.Errorf("listed with limits %v, want [20 %d]", scheduled.limits, maxPageSize)
+	}
+}
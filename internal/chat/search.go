@@ -0,0 +1,168 @@
+package chat
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+const (
+	defaultSearchSize = 20
+	maxSearchSize     = 50
+)
+
+// SearchPage is a page of search results, best match first. NextCursor is
+// empty on the last page.
+type SearchPage struct {
+	Results    []models.SearchHit `json:"results"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+}
+
+// Search finds messages in the rooms the user belongs to. The query mixes
+// words and "quoted phrases" with from:user, in:room, before:date,
+// after:date and has:file filters. Dates are YYYY-MM-DD in UTC; before and
+// after exclude the date itself.
+func (s *service) Search(userID uint, rawQuery, cursor string, limit int) (*SearchPage, error) {
+	query, err := parseSearchQuery(rawQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	var after *models.SearchCursor
+	if cursor != "" {
+		position, err := decodeSearchCursor(cursor)
+		if err != nil {
+			return nil, err
+		}
+		after = &position
+	}
+
+	if limit <= 0 {
+		limit = defaultSearchSize
+	}
+	if limit > maxSearchSize {
+		limit = maxSearchSize
+	}
+
+	hits, next, err := s.messageRepo.Search(userID, query, after, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Results: hits}
+	if next != nil {
+		page.NextCursor = encodeSearchCursor(*next)
+	}
+	for i := range page.Results {
+		s.signMessageAttachments(&page.Results[i].Message)
+	}
+	return page, nil
+}
+
+// parseSearchQuery splits a search into its text and filters. Text keeps
+// quotes and operators websearch_to_tsquery understands; unknown key:value
+// terms are searched as text.
+func parseSearchQuery(raw string) (models.SearchQuery, error) {
+	var query models.SearchQuery
+	var text []string
+
+	for _, term := range splitSearchTerms(raw) {
+		key, value, found := strings.Cut(term, ":")
+		value = strings.Trim(value, `"`)
+		if !found || value == "" {
+			text = append(text, term)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "from":
+			query.From = append(query.From, strings.TrimPrefix(value, "@"))
+		case "in":
+			query.In = append(query.In, strings.TrimPrefix(value, "#"))
+		case "before":
+			day, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return query, ErrInvalidSearch
+			}
+			query.Before = &day
+		case "after":
+			day, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return query, ErrInvalidSearch
+			}
+			end := day.AddDate(0, 0, 1).Add(-time.Nanosecond)
+			query.After = &end
+		case "has":
+			if strings.ToLower(value) != "file" {
+				return query, ErrInvalidSearch
+			}
+			query.HasFile = true
+		default:
+			text = append(text, term)
+		}
+	}
+
+	query.Text = strings.Join(text, " ")
+	if query.Text == "" && len(query.From) == 0 && len(query.In) == 0 &&
+		query.Before == nil && query.After == nil && !query.HasFile {
+		return query, ErrInvalidSearch
+	}
+	return query, nil
+}
+
+// splitSearchTerms splits a query on spaces outside double quotes.
+func splitSearchTerms(raw string) []string {
+	var terms []string
+	var term strings.Builder
+	quoted := false
+
+	for _, r := range raw {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			term.WriteRune(r)
+		case unicode.IsSpace(r) && !quoted:
+			if term.Len() > 0 {
+				terms = append(terms, term.String())
+				term.Reset()
+			}
+		default:
+			term.WriteRune(r)
+		}
+	}
+	if term.Len() > 0 {
+		terms = append(terms, term.String())
+	}
+	return terms
+}
+
+func encodeSearchCursor(position models.SearchCursor) string {
+	raw := strconv.FormatFloat(position.Rank, 'g', -1, 64) + "/" + strconv.FormatUint(uint64(position.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeSearchCursor(cursor string) (models.SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return models.SearchCursor{}, ErrInvalidCursor
+	}
+	rank, id, found := strings.Cut(string(raw), "/")
+	if !found {
+		return models.SearchCursor{}, ErrInvalidCursor
+	}
+
+	position := models.SearchCursor{}
+	if position.Rank, err = strconv.ParseFloat(rank, 64); err != nil {
+		return models.SearchCursor{}, ErrInvalidCursor
+	}
+	parsed, err := strconv.ParseUint(id, 10, 32)
+	if err != nil {
+		return models.SearchCursor{}, ErrInvalidCursor
+	}
+	position.ID = uint(parsed)
+	return position, nil
+}
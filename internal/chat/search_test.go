@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+// searchRepo answers every search with one hit, as if the rest of a full
+// page had been deleted before it was loaded.
+type searchRepo struct {
+	fakeMessageRepo
+	after *models.SearchCursor
+}
+
+func (r *searchRepo) Search(userID uint, query models.SearchQuery, after *models.SearchCursor, limit int) ([]models.SearchHit, *models.SearchCursor, error) {
+	r.after = after
+	hits := []models.SearchHit{{Message: models.Message{ID: 9}, Rank: 0.5}}
+	return hits, &models.SearchCursor{Rank: 0.25, ID: 7}, nil
+}
+
+func TestSearchCursorSurvivesDeletedHits(t *testing.T) {
+	repo := &searchRepo{}
+	s := &service{messageRepo: repo}
+
+	page, err := s.Search(1, "hello", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Results) != 1 || page.NextCursor == "" {
+		t.Fatalf("page with a deleted hit has %d results and cursor %q, want 1 and a cursor", len(page.Results), page.NextCursor)
+	}
+
+	if _, err := s.Search(1, "hello", page.NextCursor, 2); err != nil {
+		t.Fatal(err)
+	}
+	if repo.after == nil || *repo.after != (models.SearchCursor{Rank: 0.25, ID: 7}) {
+		t.Fatalf("next page searched after %+v, want the last row matched", repo.after)
+	}
+}
@@ -2,34 +2,153 @@ package chat
 
 import (
 	"errors"
+	"io"
+	"strings"
+	"time"
 
+	"github.com/Shobayosamuel/tap-me/config"
 	"github.com/Shobayosamuel/tap-me/internal/models"
 	"github.com/Shobayosamuel/tap-me/internal/repository"
+	"github.com/Shobayosamuel/tap-me/internal/storage"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAccessDenied       = errors.New("access denied")
+	ErrMessageNotFound    = errors.New("message not found")
+	ErrNotMessageAuthor   = errors.New("only the author can edit this message")
+	ErrEditWindowExpired  = errors.New("message can no longer be edited")
+	ErrModeratorRequired  = errors.New("only room moderators and admins can do this")
+	ErrAdminRequired      = errors.New("only room admins can do this")
+	ErrNotRoomMember      = errors.New("user is not a member of the room")
+	ErrOwnRole            = errors.New("admins cannot change their own role")
+	ErrCannotDelete       = errors.New("only the author or a room moderator can delete this message")
+	ErrInvalidEmoji       = errors.New("invalid emoji")
+	ErrTooManyReactions   = errors.New("message has too many different reactions")
+	ErrInvalidParent      = errors.New("parent message is not in this room")
+	ErrInvalidReplyTo     = errors.New("quoted message is not in this room")
+	ErrMessageNotInRoom   = errors.New("message is not in this room")
+	ErrInvalidCursor      = errors.New("invalid cursor")
+	ErrInvalidSeq         = errors.New("seq is ahead of the room")
+	ErrInvalidSearch      = errors.New("invalid search query")
+	ErrInvalidLimit       = errors.New("limit must be at least 1")
+	ErrEmptyMessage       = errors.New("message needs content or an attachment")
+	ErrInvalidFormat      = errors.New("format must be plain or markdown")
+	ErrInvalidAttachment  = errors.New("attachments must be your own unsent uploads")
+	ErrAttachmentNotFound = errors.New("attachment not found")
+	ErrFileTooLarge       = errors.New("file is too large")
+	ErrQuotaExceeded      = errors.New("storage quota exceeded")
+	ErrInvalidFileURL     = errors.New("file URL is invalid or expired")
+	ErrInvalidImage       = errors.New("image could not be processed")
+	ErrInvalidVoice       = errors.New("voice notes must be Ogg/Opus or WebM audio")
+	ErrVoiceTooLong       = errors.New("voice note is too long")
+	ErrVoiceNotAlone      = errors.New("a voice note must be the message's only attachment")
+	ErrSystemMessage      = errors.New("system messages cannot be edited, forwarded or pinned")
+	ErrTooManyPins        = errors.New("room has reached its pin limit")
+	ErrSavedItemNotFound  = errors.New("saved item not found")
+	ErrScheduledNotFound  = errors.New("scheduled message or reminder not found")
+	ErrInvalidSchedule    = errors.New("scheduled time must be in the future")
+	ErrTooManyScheduled   = errors.New("too many pending scheduled messages and reminders")
+	ErrInvalidPoll        = errors.New("polls need a question, 2 to 10 distinct options, a future closing time and no attachments")
+	ErrNotPoll            = errors.New("message is not a poll")
+	ErrPollMessage        = errors.New("polls cannot be edited or forwarded")
+	ErrInvalidVote        = errors.New("vote for one option of the poll, or several if it allows multiple choice")
+	ErrPollClosed         = errors.New("poll is closed")
+	ErrCannotClosePoll    = errors.New("only the poll's creator or a room moderator can close it")
 )
 
 type Service interface {
 	CreateRoom(userID uint, req CreateRoomRequest) (*models.Room, error)
-	GetUserRooms(userID uint) ([]models.Room, error)
-	GetRoomMessages(userID, roomID uint, limit, offset int) ([]models.Message, error)
+	GetUserRooms(userID uint) ([]models.RoomSummary, error)
+	GetRoomMessages(userID, roomID uint, req MessagePageRequest) (*MessagePage, error)
 	JoinRoom(userID, roomID uint) error
 	LeaveRoom(userID, roomID uint) error
-	CreateMessage(userID, roomID uint, content string) (*models.Message, error)
+	UpdateRoom(userID, roomID uint, req UpdateRoomRequest) (*models.Room, error)
+	SetMemberRole(userID, roomID, memberID uint, role models.MemberRole) error
+	CreateMessage(userID, roomID uint, input models.MessageInput) (*models.Message, bool, error)
 	CanUserAccessRoom(userID, roomID uint) (bool, error)
 	GetRoomMembers(roomID uint) ([]models.User, error)
+	EditMessage(userID, messageID uint, content string) (*models.Message, bool, error)
+	GetMessageRevisions(userID, messageID uint) ([]models.MessageRevision, error)
+	DeleteMessage(userID, messageID uint) (*models.Message, error)
+	PurgeDeletedMessages() (int64, error)
+	AddReaction(userID, messageID uint, emoji string) (*models.ReactionChange, bool, error)
+	RemoveReaction(userID, messageID uint, emoji string) (*models.ReactionChange, bool, error)
+	GetThread(userID, messageID uint, limit, offset int) (*models.Message, []models.Message, error)
+	ForwardMessage(userID, messageID, roomID uint, clientMsgID string) (*models.Message, bool, error)
+	GetUnreadMentions(userID uint, limit, offset int) ([]models.MessageMention, error)
+	MarkMentionsRead(userID uint, messageIDs []uint) (int64, error)
+	MarkRead(userID, roomID, messageID uint) (*models.ReadPosition, bool, error)
+	GetReadPositions(userID, roomID uint) ([]models.ReadPosition, error)
+	Sync(userID, roomID uint, since uint64, limit int) (*models.SyncResult, error)
+	Search(userID uint, query, cursor string, limit int) (*SearchPage, error)
+	UploadAttachment(userID uint, filename string, size int64, r io.Reader, voice bool) (*models.Attachment, error)
+	MaxUploadBytes() int64
+	GetAttachment(userID, attachmentID uint) (*models.Attachment, error)
+	OpenAttachment(attachmentID uint, thumb int, expires, signature string) (*File, error)
+	PinMessage(userID, messageID uint) (*models.Message, bool, error)
+	UnpinMessage(userID, messageID uint) (*models.Message, bool, error)
+	GetPinnedMessages(userID, roomID uint) ([]models.Message, error)
+	SaveMessage(userID, messageID uint, note string) (*models.SavedItem, bool, error)
+	GetSavedItems(userID uint, limit, offset int) ([]models.SavedItem, error)
+	UpdateSavedItem(userID, itemID uint, note string) (*models.SavedItem, error)
+	DeleteSavedItem(userID, itemID uint) (*models.SavedItem, error)
+	ScheduleMessage(userID, roomID uint, req ScheduleMessageRequest) (*models.ScheduledJob, error)
+	RemindMe(userID, messageID uint, remindAt time.Time, note string) (*models.ScheduledJob, error)
+	GetScheduled(userID uint, limit, offset int) ([]models.ScheduledJob, error)
+	UpdateScheduled(userID, jobID uint, req UpdateScheduledRequest) (*models.ScheduledJob, error)
+	CancelScheduled(userID, jobID uint) error
+	RunScheduledJobs() (int, error)
+	VotePoll(userID, messageID uint, optionIDs []uint) (*models.PollChange, bool, error)
+	ClosePoll(userID, messageID uint) (*models.PollChange, bool, error)
+	SetNotifier(notifier Notifier)
 }
 
 type service struct {
-	roomRepo    repository.RoomRepository
-	messageRepo repository.MessageRepository
-	userRepo    repository.UserRepository
+	roomRepo       repository.RoomRepository
+	messageRepo    repository.MessageRepository
+	userRepo       repository.UserRepository
+	reactionRepo   repository.ReactionRepository
+	mentionRepo    repository.MentionRepository
+	attachmentRepo repository.AttachmentRepository
+	savedItemRepo  repository.SavedItemRepository
+	scheduledRepo  repository.ScheduledJobRepository
+	pollRepo       repository.PollRepository
+	store          storage.BlobStore
+	signer         *storage.URLSigner
+	presence       Presence
+	unfurler       Unfurler
+	notifier       Notifier
+	unfurls        chan *models.Message
+	cfg            config.ChatConfig
 }
 
-func NewService(roomRepo repository.RoomRepository, messageRepo repository.MessageRepository, userRepo repository.UserRepository) Service {
-	return &service{
-		roomRepo:    roomRepo,
-		messageRepo: messageRepo,
-		userRepo:    userRepo,
+func NewService(roomRepo repository.RoomRepository, messageRepo repository.MessageRepository, userRepo repository.UserRepository, reactionRepo repository.ReactionRepository, mentionRepo repository.MentionRepository, attachmentRepo repository.AttachmentRepository, savedItemRepo repository.SavedItemRepository, scheduledRepo repository.ScheduledJobRepository, pollRepo repository.PollRepository, store storage.BlobStore, signer *storage.URLSigner, presence Presence, unfurler Unfurler, cfg config.ChatConfig) Service {
+	s := &service{
+		roomRepo:       roomRepo,
+		messageRepo:    messageRepo,
+		userRepo:       userRepo,
+		reactionRepo:   reactionRepo,
+		mentionRepo:    mentionRepo,
+		attachmentRepo: attachmentRepo,
+		savedItemRepo:  savedItemRepo,
+		scheduledRepo:  scheduledRepo,
+		pollRepo:       pollRepo,
+		store:          store,
+		signer:         signer,
+		presence:       presence,
+		unfurler:       unfurler,
+		unfurls:        make(chan *models.Message, unfurlQueueSize),
+		cfg:            cfg,
+	}
+
+	// Link previews are fetched in the background, unless disabled
+	if unfurler != nil {
+		for i := 0; i < unfurlWorkers; i++ {
+			go s.unfurlWorker()
+		}
 	}
+	return s
 }
 
 func (s *service) CreateRoom(userID uint, req CreateRoomRequest) (*models.Room, error) {
@@ -52,23 +171,6 @@ func (s *service) CreateRoom(userID uint, req CreateRoomRequest) (*models.Room,
 	return room, nil
 }
 
-func (s *service) GetUserRooms(userID uint) ([]models.Room, error) {
-	return s.roomRepo.GetUserRooms(userID)
-}
-
-func (s *service) GetRoomMessages(userID, roomID uint, limit, offset int) ([]models.Message, error) {
-	// Check if user can access room
-	canAccess, err := s.CanUserAccessRoom(userID, roomID)
-	if err != nil {
-		return nil, err
-	}
-	if !canAccess {
-		return nil, errors.New("access denied")
-	}
-
-	return s.messageRepo.GetRoomMessages(roomID, limit, offset)
-}
-
 func (s *service) JoinRoom(userID, roomID uint) error {
 	// Check if room exists
 	room, err := s.roomRepo.GetByID(roomID)
@@ -81,37 +183,274 @@ func (s *service) JoinRoom(userID, roomID uint) error {
 		return errors.New("cannot join private room")
 	}
 
+	isMember, err := s.CanUserAccessRoom(userID, roomID)
+	if err != nil || isMember {
+		return err
+	}
+
 	// Add user as member
-	return s.roomRepo.AddMember(roomID, userID, models.RoleMember)
+	if err := s.roomRepo.AddMember(roomID, userID, models.RoleMember); err != nil {
+		return err
+	}
+	s.postSystemMessage(roomID, &models.SystemEvent{Action: models.SystemMemberJoined, ActorID: userID})
+	return nil
 }
 
 func (s *service) LeaveRoom(userID, roomID uint) error {
-	return s.roomRepo.RemoveMember(roomID, userID)
+	isMember, err := s.CanUserAccessRoom(userID, roomID)
+	if err != nil {
+		return err
+	}
+	if !isMember {
+		return ErrAccessDenied
+	}
+
+	if err := s.roomRepo.RemoveMember(roomID, userID); err != nil {
+		return err
+	}
+	s.postSystemMessage(roomID, &models.SystemEvent{Action: models.SystemMemberLeft, ActorID: userID})
+	return nil
 }
 
-func (s *service) CreateMessage(userID, roomID uint, content string) (*models.Message, error) {
+// UpdateRoom changes a room's name and description. Only admins may. A
+// rename is recorded in the timeline.
+func (s *service) UpdateRoom(userID, roomID uint, req UpdateRoomRequest) (*models.Room, error) {
+	isAdmin, err := s.isAdmin(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !isAdmin {
+		return nil, ErrAdminRequired
+	}
+
+	room, err := s.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, err
+	}
+	oldName := room.Name
+	if req.Name != nil {
+		room.Name = *req.Name
+	}
+	if req.Description != nil {
+		room.Description = *req.Description
+	}
+	if err := s.roomRepo.Update(room); err != nil {
+		return nil, err
+	}
+
+	if room.Name != oldName {
+		s.postSystemMessage(roomID, &models.SystemEvent{
+			Action:  models.SystemRoomRenamed,
+			ActorID: userID,
+			OldName: oldName,
+			NewName: room.Name,
+		})
+	}
+	return room, nil
+}
+
+// SetMemberRole changes the role of a member of the room. Only admins may,
+// and not their own, so a room cannot lose its last admin by accident.
+func (s *service) SetMemberRole(userID, roomID, memberID uint, role models.MemberRole) error {
+	isAdmin, err := s.isAdmin(userID, roomID)
+	if err != nil {
+		return err
+	}
+	if !isAdmin {
+		return ErrAdminRequired
+	}
+	if memberID == userID {
+		return ErrOwnRole
+	}
+
+	current, err := s.roomRepo.GetMemberRole(roomID, memberID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotRoomMember
+	}
+	if err != nil || current == role {
+		return err
+	}
+
+	member, err := s.userRepo.GetByID(memberID)
+	if err != nil {
+		return err
+	}
+	if err := s.roomRepo.UpdateMemberRole(roomID, memberID, role); err != nil {
+		return err
+	}
+
+	event := targetEvent(models.SystemRoleChanged, userID, member)
+	event.Role = role
+	s.postSystemMessage(roomID, event)
+	return nil
+}
+
+// CreateMessage stores a new message and reports whether it was created. It
+// returns false with the original message when input.ClientMsgID repeats an
+// earlier send.
+func (s *service) CreateMessage(userID, roomID uint, input models.MessageInput) (*models.Message, bool, error) {
 	// Check if user can access room
 	canAccess, err := s.CanUserAccessRoom(userID, roomID)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 	if !canAccess {
-		return nil, errors.New("access denied")
+		return nil, false, ErrAccessDenied
 	}
 
 	message := &models.Message{
-		Content: content,
+		Content: input.Content,
 		UserID:  userID,
 		RoomID:  roomID,
 		Type:    models.MessageTypeText,
+		Format:  input.Format,
+	}
+	if input.Poll != nil {
+		if len(input.AttachmentIDs) > 0 {
+			return nil, false, ErrInvalidPoll
+		}
+		message.Poll, err = newPoll(input.Poll)
+		if err != nil {
+			return nil, false, err
+		}
+		message.Type = models.MessageTypePoll
+		message.Content = message.Poll.Question
+		message.Format = models.MessageFormatPlain
+	}
+	if err := renderContent(message); err != nil {
+		return nil, false, err
+	}
+	if input.ClientMsgID != "" {
+		message.ClientMsgID = &input.ClientMsgID
 	}
 
-	if err := s.messageRepo.Create(message); err != nil {
-		return nil, err
+	if len(input.AttachmentIDs) > 0 {
+		message.AttachmentIDs, message.Type, err = s.sentAttachments(userID, input.AttachmentIDs)
+		if err != nil {
+			return nil, false, err
+		}
+	} else if strings.TrimSpace(message.Content) == "" {
+		return nil, false, ErrEmptyMessage
 	}
 
-	// Load user and room data
-	return s.messageRepo.GetByIDWithRelations(message.ID)
+	if input.ParentID != 0 {
+		parent, err := s.getMessage(input.ParentID)
+		if errors.Is(err, ErrMessageNotFound) || (err == nil && parent.RoomID != roomID) {
+			return nil, false, ErrInvalidParent
+		}
+		if err != nil {
+			return nil, false, err
+		}
+
+		// Replies to replies join the same flat thread
+		rootID := parent.ID
+		if parent.ThreadRootID != nil {
+			rootID = *parent.ThreadRootID
+		}
+		message.ParentID = &parent.ID
+		message.ThreadRootID = &rootID
+		message.ShowInChannel = input.AlsoSendToChannel
+	}
+
+	if input.ReplyToID != 0 {
+		quoted, err := s.getMessage(input.ReplyToID)
+		if errors.Is(err, ErrMessageNotFound) || (err == nil && quoted.RoomID != roomID) {
+			return nil, false, ErrInvalidReplyTo
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		message.ReplyToID = &quoted.ID
+	}
+
+	message.Mentions, err = s.resolveMentions(userID, roomID, message.PlainText)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return s.storeMessage(message)
+}
+
+// storeMessage saves a new message and reloads it with everything clients
+// need to render it. The mentions it was stored with are kept so they can be
+// notified. A retry of a message deleted since returns its tombstone.
+func (s *service) storeMessage(message *models.Message) (*models.Message, bool, error) {
+	created, err := s.messageRepo.CreateIdempotent(message)
+	if errors.Is(err, repository.ErrAttachmentUnavailable) {
+		return nil, false, ErrInvalidAttachment
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if message.DeletedAt.Valid {
+		return message, false, nil
+	}
+	mentions := message.Mentions
+
+	message, err = s.loadMessage(message.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	message.Mentions = mentions
+	if created {
+		s.queueUnfurl(message)
+	}
+
+	// Replies carry their root so thread counters can be broadcast
+	if message.ThreadRootID != nil {
+		message.ThreadRoot, err = s.messageRepo.GetByIDWithDeleted(*message.ThreadRootID)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+	return message, created, nil
+}
+
+// GetThread returns a thread's root message and a page of its replies, oldest
+// first. messageID may be the root or any reply in the thread.
+func (s *service) GetThread(userID, messageID uint, limit, offset int) (*models.Message, []models.Message, error) {
+	message, err := s.messageRepo.GetByIDWithDeleted(messageID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	canAccess, err := s.CanUserAccessRoom(userID, message.RoomID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !canAccess {
+		return nil, nil, ErrAccessDenied
+	}
+
+	root := message
+	if message.ThreadRootID != nil {
+		root, err = s.messageRepo.GetByIDWithDeleted(*message.ThreadRootID)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	replies, err := s.messageRepo.GetThreadReplies(root.ID, limit, offset)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	all := append([]models.Message{*root}, replies...)
+	if err := s.attachReactions(userID, all); err != nil {
+		return nil, nil, err
+	}
+	if err := s.attachPolls(userID, all); err != nil {
+		return nil, nil, err
+	}
+	if err := s.attachReplyPreviews(all); err != nil {
+		return nil, nil, err
+	}
+	s.signAttachments(all)
+	*root = all[0]
+	return root, all[1:], nil
 }
 
 func (s *service) CanUserAccessRoom(userID, roomID uint) (bool, error) {
@@ -122,4 +461,224 @@ func (s *service) GetRoomMembers(roomID uint) ([]models.User, error) {
 	return s.roomRepo.GetMembers(roomID)
 }
 
-func (s *service) CreateCall()
\ No newline at end of file
+// EditMessage replaces a message's content, keeping the old content as a
+// revision. Only the author may edit, and only within the configured window.
+// The bool reports whether the content changed, in which case the edit is
+// published.
+func (s *service) EditMessage(userID, messageID uint, content string) (*models.Message, bool, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if message.Type == models.MessageTypeSystem {
+		return nil, false, ErrSystemMessage
+	}
+	if message.Type == models.MessageTypePoll {
+		return nil, false, ErrPollMessage
+	}
+	if message.UserID != userID {
+		return nil, false, ErrNotMessageAuthor
+	}
+
+	// Authors who left the room lose the right to edit
+	canAccess, err := s.CanUserAccessRoom(userID, message.RoomID)
+	if err != nil {
+		return nil, false, err
+	}
+	if !canAccess {
+		return nil, false, ErrAccessDenied
+	}
+
+	window := time.Duration(s.cfg.EditWindowMinutes) * time.Minute
+	if window > 0 && time.Since(message.CreatedAt) > window {
+		return nil, false, ErrEditWindowExpired
+	}
+
+	if message.Content == content {
+		loaded, err := s.loadMessage(message.ID)
+		return loaded, false, err
+	}
+
+	now := time.Now()
+	message.Content = content
+	message.EditedAt = &now
+	if err := renderContent(message); err != nil {
+		return nil, false, err
+	}
+	message.LinkPreviews = keepLinkPreviews(message.LinkPreviews, content)
+
+	err = s.messageRepo.Edit(message, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, false, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	s.queueUnfurl(message)
+
+	loaded, err := s.loadMessage(message.ID)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.notifier != nil {
+		s.notifier.PublishMessageEdited(loaded)
+	}
+	return loaded, true, nil
+}
+
+// GetMessageRevisions returns a message's earlier versions, oldest first, to
+// moderators and admins of its room.
+func (s *service) GetMessageRevisions(userID, messageID uint) ([]models.MessageRevision, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	isModerator, err := s.isModerator(userID, message.RoomID)
+	if err != nil {
+		return nil, err
+	}
+	if !isModerator {
+		return nil, ErrModeratorRequired
+	}
+
+	return s.messageRepo.GetRevisions(message.ID)
+}
+
+// DeleteMessage soft-deletes a message, publishes the deletion and returns
+// its tombstone. Authors can delete their own messages; moderators and admins
+// can delete any message in their room.
+func (s *service) DeleteMessage(userID, messageID uint) (*models.Message, error) {
+	message, err := s.getMessage(messageID)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := false
+	if message.UserID == userID {
+		allowed, err = s.CanUserAccessRoom(userID, message.RoomID)
+	} else {
+		allowed, err = s.isModerator(userID, message.RoomID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, ErrCannotDelete
+	}
+
+	err = s.messageRepo.SoftDelete(message, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	deleted, err := s.messageRepo.GetByIDWithDeleted(message.ID)
+	if err != nil {
+		return nil, err
+	}
+	if s.notifier != nil {
+		s.notifier.PublishMessageDeleted(deleted)
+	}
+
+	// Thread counters no longer count the reply
+	if deleted.ThreadRootID != nil {
+		root, err := s.messageRepo.GetByIDWithDeleted(*deleted.ThreadRootID)
+		if err != nil {
+			return nil, err
+		}
+		if s.notifier != nil {
+			s.notifier.PublishThreadUpdated(root)
+		}
+	}
+
+	// Moderators removing someone else's message leave a trace
+	if message.UserID != userID && message.Type != models.MessageTypeSystem {
+		author, err := s.userRepo.GetByID(message.UserID)
+		if err != nil {
+			return nil, err
+		}
+		event := targetEvent(models.SystemMessageRemoved, userID, author)
+		event.MessageID = &message.ID
+		s.postSystemMessage(message.RoomID, event)
+	}
+
+	return deleted, nil
+}
+
+// PurgeDeletedMessages hard-deletes messages whose retention period after
+// deletion has passed, along with their files and uploads that were never
+// sent.
+func (s *service) PurgeDeletedMessages() (int64, error) {
+	retention := time.Duration(s.cfg.DeletedRetentionHours) * time.Hour
+	purged, unreferenced, err := s.messageRepo.PurgeDeleted(time.Now().Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	s.deleteBlobs(unreferenced)
+
+	if err := s.purgeOrphanUploads(); err != nil {
+		return purged, err
+	}
+	return purged, nil
+}
+
+// loadMessage loads a live message with its author, room, attachments, poll
+// and quote preview.
+func (s *service) loadMessage(messageID uint) (*models.Message, error) {
+	message, err := s.messageRepo.GetByIDWithRelations(messageID)
+	if err != nil {
+		return nil, err
+	}
+	s.signMessageAttachments(message)
+	if message.Type == models.MessageTypePoll {
+		polls, err := s.loadPolls(0, []uint{message.ID})
+		if err != nil {
+			return nil, err
+		}
+		message.Poll = polls[message.ID]
+	}
+	if message.ReplyToID != nil {
+		message.ReplyTo, err = s.replyPreview(message)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return message, nil
+}
+
+func (s *service) getMessage(messageID uint) (*models.Message, error) {
+	message, err := s.messageRepo.GetByID(messageID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrMessageNotFound
+	}
+	return message, err
+}
+
+// isModerator reports whether the user is a moderator or admin of the room.
+func (s *service) isModerator(userID, roomID uint) (bool, error) {
+	role, err := s.roomRepo.GetMemberRole(roomID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return role == models.RoleAdmin || role == models.RoleModerator, nil
+}
+
+// isAdmin reports whether the user is an admin of the room.
+func (s *service) isAdmin(userID, roomID uint) (bool, error) {
+	role, err := s.roomRepo.GetMemberRole(roomID, userID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return role == models.RoleAdmin, nil
+}
+
+func (s *service) CreateCall()
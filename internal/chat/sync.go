@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+const (
+	defaultSyncSize = 200
+	maxSyncSize     = 500
+)
+
+// Sync returns the messages of a room created or changed after the sequence
+// number since, oldest change first, so a client that missed events can
+// catch up without gaps. Messages are returned as they are now, with deleted
+// ones as tombstones.
+func (s *service) Sync(userID, roomID uint, since uint64, limit int) (*models.SyncResult, error) {
+	canAccess, err := s.CanUserAccessRoom(userID, roomID)
+	if err != nil {
+		return nil, err
+	}
+	if !canAccess {
+		return nil, ErrAccessDenied
+	}
+
+	if limit <= 0 {
+		limit = defaultSyncSize
+	}
+	if limit > maxSyncSize {
+		limit = maxSyncSize
+	}
+
+	// Every change up to the room's current seq has committed, so reading
+	// up to it leaves no holes for changes still in flight
+	room, err := s.roomRepo.GetByID(roomID)
+	if err != nil {
+		return nil, err
+	}
+	result := &models.SyncResult{RoomID: roomID, Messages: []models.Message{}, Seq: room.LastSeq}
+	if since >= room.LastSeq {
+		if since > room.LastSeq {
+			return nil, ErrInvalidSeq
+		}
+		return result, nil
+	}
+
+	messages, err := s.messageRepo.GetChangesSince(roomID, since, room.LastSeq, limit+1)
+	if err != nil {
+		return nil, err
+	}
+	if len(messages) > limit {
+		messages = messages[:limit]
+		result.HasMore = true
+		result.Seq = messages[limit-1].UpdatedSeq
+	}
+
+	if err := s.attachReactions(userID, messages); err != nil {
+		return nil, err
+	}
+	if err := s.attachPolls(userID, messages); err != nil {
+		return nil, err
+	}
+	if err := s.attachReplyPreviews(messages); err != nil {
+		return nil, err
+	}
+	s.signAttachments(messages)
+	result.Messages = messages
+	return result, nil
+}
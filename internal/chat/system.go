@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"log"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+// postSystemMessage records a room event in the room's timeline as a system
+// message from its actor, and publishes it. Events about a message quote it.
+// The change that caused the event has already happened, so failing to
+// record it is logged rather than returned.
+func (s *service) postSystemMessage(roomID uint, event *models.SystemEvent) {
+	message := &models.Message{
+		UserID:    event.ActorID,
+		RoomID:    roomID,
+		Type:      models.MessageTypeSystem,
+		Format:    models.MessageFormatPlain,
+		System:    event,
+		ReplyToID: event.MessageID,
+	}
+	message, _, err := s.storeMessage(message)
+	if err != nil {
+		log.Printf("Failed to record %s in room %d: %v", event.Action, roomID, err)
+		return
+	}
+	if s.notifier != nil {
+		s.notifier.PublishMessage(message)
+	}
+}
+
+// targetEvent builds an event whose actor acted on another user.
+func targetEvent(action models.SystemAction, actorID uint, target *models.User) *models.SystemEvent {
+	return &models.SystemEvent{
+		Action:     action,
+		ActorID:    actorID,
+		TargetID:   &target.ID,
+		TargetName: target.Username,
+	}
+}
@@ -0,0 +1,253 @@
+package chat
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/Shobayosamuel/tap-me/internal/repository"
+	"gorm.io/gorm"
+)
+
+// fakeMessageRepo keeps messages in memory and numbers their changes like
+// the Postgres repository. Methods the tests don't reach are left nil.
+type fakeMessageRepo struct {
+	repository.MessageRepository
+	messages map[uint]*models.Message
+	seq      uint64
+	nextID   uint
+}
+
+func newFakeMessageRepo() *fakeMessageRepo {
+	return &fakeMessageRepo{messages: map[uint]*models.Message{}}
+}
+
+func (r *fakeMessageRepo) add(message *models.Message) *models.Message {
+	r.nextID++
+	r.seq++
+	message.ID = r.nextID
+	message.Seq, message.UpdatedSeq = r.seq, r.seq
+	stored := *message
+	r.messages[message.ID] = &stored
+	return message
+}
+
+func (r *fakeMessageRepo) CreateIdempotent(message *models.Message) (bool, error) {
+	if message.ClientMsgID != nil {
+		for _, stored := range r.messages {
+			if stored.ClientMsgID != nil && *stored.ClientMsgID == *message.ClientMsgID &&
+				stored.UserID == message.UserID && stored.RoomID == message.RoomID {
+				*message = *stored
+				message.AfterFind(nil)
+				return false, nil
+			}
+		}
+	}
+	r.add(message)
+	return true, nil
+}
+
+func (r *fakeMessageRepo) GetByIDWithDeleted(id uint) (*models.Message, error) {
+	message, ok := r.messages[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	found := *message
+	return &found, nil
+}
+
+func (r *fakeMessageRepo) GetByID(id uint) (*models.Message, error) {
+	message, err := r.GetByIDWithDeleted(id)
+	if err == nil && message.DeletedAt.Valid {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return message, err
+}
+
+func (r *fakeMessageRepo) GetByIDWithRelations(id uint) (*models.Message, error) {
+	return r.GetByID(id)
+}
+
+func (r *fakeMessageRepo) SoftDelete(message *models.Message, deletedBy uint) error {
+	stored := r.messages[message.ID]
+	if stored.DeletedAt.Valid {
+		return gorm.ErrRecordNotFound
+	}
+	r.seq++
+	stored.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	stored.UpdatedSeq = r.seq
+	if stored.ThreadRootID != nil {
+		root := r.messages[*stored.ThreadRootID]
+		root.ReplyCount--
+		root.UpdatedSeq = r.seq
+	}
+	return nil
+}
+
+func (r *fakeMessageRepo) Edit(message *models.Message, editedBy uint) error {
+	r.seq++
+	message.UpdatedSeq = r.seq
+	stored := *message
+	r.messages[message.ID] = &stored
+	return nil
+}
+
+func (r *fakeMessageRepo) Pin(message *models.Message, pinnedBy uint, maxPins int) (bool, error) {
+	r.seq++
+	now := time.Now()
+	stored := r.messages[message.ID]
+	stored.PinnedAt, stored.PinnedBy, stored.UpdatedSeq = &now, &pinnedBy, r.seq
+	return true, nil
+}
+
+func (r *fakeMessageRepo) Unpin(message *models.Message) (bool, error) {
+	r.seq++
+	stored := r.messages[message.ID]
+	stored.PinnedAt, stored.PinnedBy, stored.UpdatedSeq = nil, nil, r.seq
+	return true, nil
+}
+
+// fakeRoomRepo makes every user a moderator of every room.
+type fakeRoomRepo struct {
+	repository.RoomRepository
+}
+
+func (fakeRoomRepo) IsUserMember(roomID, userID uint) (bool, error) {
+	return true, nil
+}
+
+func (fakeRoomRepo) GetMemberRole(roomID, userID uint) (models.MemberRole, error) {
+	return models.RoleModerator, nil
+}
+
+type fakeUserRepo struct {
+	repository.UserRepository
+}
+
+func (fakeUserRepo) GetByID(id uint) (*models.User, error) {
+	return &models.User{ID: id, Username: fmt.Sprintf("user%d", id)}, nil
+}
+
+// recordingNotifier notes what was published, in order, with its seq.
+type recordingNotifier struct {
+	events []string
+}
+
+func (n *recordingNotifier) PublishMessage(message *models.Message) {
+	n.events = append(n.events, fmt.Sprintf("message %d", message.Seq))
+}
+
+func (n *recordingNotifier) PublishMessageUpdated(message *models.Message) {
+	n.events = append(n.events, fmt.Sprintf("updated %d", message.UpdatedSeq))
+}
+
+func (n *recordingNotifier) PublishMessageEdited(message *models.Message) {
+	n.events = append(n.events, fmt.Sprintf("edited %d", message.UpdatedSeq))
+}
+
+func (n *recordingNotifier) PublishMessageDeleted(message *models.Message) {
+	n.events = append(n.events, fmt.Sprintf("deleted %d", message.UpdatedSeq))
+}
+
+func (n *recordingNotifier) PublishMessagePinned(message *models.Message, pinned bool) {
+	n.events = append(n.events, fmt.Sprintf("pinned %v %d", pinned, message.UpdatedSeq))
+}
+
+func (n *recordingNotifier) PublishThreadUpdated(root *models.Message) {
+	n.events = append(n.events, fmt.Sprintf("thread %d %d", root.ReplyCount, root.UpdatedSeq))
+}
+
+func (n *recordingNotifier) PublishScheduledJob(job *models.ScheduledJob) {
+	n.events = append(n.events, fmt.Sprintf("job %d", job.ID))
+}
+
+func (n *recordingNotifier) PublishPollUpdated(change *models.PollChange) {
+	n.events = append(n.events, fmt.Sprintf("poll %d %v %d", change.MessageID, change.Poll.Closed, change.Seq))
+}
+
+func newSystemTestService() (*service, *fakeMessageRepo, *recordingNotifier) {
+	messages := newFakeMessageRepo()
+	notifier := &recordingNotifier{}
+	return &service{
+		messageRepo: messages,
+		roomRepo:    fakeRoomRepo{},
+		userRepo:    fakeUserRepo{},
+		notifier:    notifier,
+	}, messages, notifier
+}
+
+func expectEvents(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("published %q, want %q", got, want)
+	}
+}
+
+func TestPinPublishedBeforeItsSystemMessage(t *testing.T) {
+	s, messages, notifier := newSystemTestService()
+	message := messages.add(&models.Message{UserID: 2, RoomID: 1, Content: "hi"})
+
+	if _, _, err := s.PinMessage(1, message.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.UnpinMessage(1, message.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, notifier.events, "pinned true 2", "message 3", "pinned false 4", "message 5")
+}
+
+func TestModeratorDeletePublishedBeforeItsSystemMessage(t *testing.T) {
+	s, messages, notifier := newSystemTestService()
+	other := messages.add(&models.Message{UserID: 2, RoomID: 1, Content: "spam"})
+	own := messages.add(&models.Message{UserID: 1, RoomID: 1, Content: "oops"})
+
+	if _, err := s.DeleteMessage(1, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.DeleteMessage(1, own.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, notifier.events, "deleted 3", "message 4", "deleted 5")
+}
+
+func TestDeletedReplyUpdatesThread(t *testing.T) {
+	s, messages, notifier := newSystemTestService()
+	root := messages.add(&models.Message{UserID: 1, RoomID: 1, Content: "root", ReplyCount: 1})
+	reply := messages.add(&models.Message{UserID: 1, RoomID: 1, Content: "reply", ThreadRootID: &root.ID})
+
+	if _, err := s.DeleteMessage(1, reply.ID); err != nil {
+		t.Fatal(err)
+	}
+	expectEvents(t, notifier.events, "deleted 3", "thread 0 3")
+}
+
+func TestRetryOfDeletedMessageReturnsTombstone(t *testing.T) {
+	s, messages, _ := newSystemTestService()
+	clientMsgID := "retry-1"
+	original := messages.add(&models.Message{UserID: 1, RoomID: 1, Content: "hi", ClientMsgID: &clientMsgID})
+	if _, err := s.DeleteMessage(1, original.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	message, created, err := s.storeMessage(&models.Message{UserID: 1, RoomID: 1, Content: "hi", ClientMsgID: &clientMsgID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created || message.ID != original.ID || message.Tombstone == nil || message.Content != "" {
+		t.Fatalf("retry answered created %v with %+v, want the original's tombstone", created, message)
+	}
+}
+
+func TestOnlyChangedEditsArePublished(t *testing.T) {
+	s, messages, notifier := newSystemTestService()
+	message := messages.add(&models.Message{UserID: 1, RoomID: 1, Content: "hi"})
+
+	if _, changed, err := s.EditMessage(1, message.ID, "hi"); err != nil || changed {
+		t.Fatalf("unchanged edit: changed = %v, err = %v", changed, err)
+	}
+	if _, changed, err := s.EditMessage(1, message.ID, "hello"); err != nil || !changed {
+		t.Fatalf("edit: changed = %v, err = %v", changed, err)
+	}
+	expectEvents(t, notifier.events, "edited 2")
+}
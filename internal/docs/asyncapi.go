@@ -0,0 +1,78 @@
+package docs
+
+import (
+	"strings"
+
+	"github.com/Shobayosamuel/tap-me/internal/ws"
+)
+
+// AsyncAPI builds an AsyncAPI 2.6 document for the WebSocket protocol from
+// the command and event payload types registered in the ws package.
+func AsyncAPI() map[string]interface{} {
+	registry := newSchemaRegistry()
+	messages := map[string]interface{}{}
+
+	refs := func(specs []ws.EventSpec) []interface{} {
+		var out []interface{}
+		for _, spec := range specs {
+			name := string(spec.Type)
+			messages[name] = map[string]interface{}{
+				"name":    name,
+				"summary": spec.Summary,
+				"payload": map[string]interface{}{
+					"allOf": []interface{}{
+						registry.schemaOf(spec.Payload),
+						map[string]interface{}{
+							"required":   []string{"type"},
+							"properties": map[string]interface{}{"type": map[string]interface{}{"const": name}},
+						},
+					},
+				},
+			}
+			out = append(out, map[string]interface{}{"$ref": "#/components/messages/" + name})
+		}
+		return out
+	}
+
+	return map[string]interface{}{
+		"asyncapi":           "2.6.0",
+		"defaultContentType": "application/json",
+		"info": map[string]interface{}{
+			"title":   "tap-me chat protocol",
+			"version": ws.SupportedProtocols[0],
+			"description": "Request a version with the Sec-WebSocket-Protocol header or the `protocol` query " +
+				"parameter. Supported versions: " + strings.Join(ws.SupportedProtocols, ", ") + ". " +
+				"Unsupported versions are closed with code 4400 and deprecated ones with 4410; " +
+				"the close reason explains why.",
+		},
+		"channels": map[string]interface{}{
+			"/ws": map[string]interface{}{
+				"bindings": map[string]interface{}{
+					"ws": map[string]interface{}{
+						"method": "GET",
+						"query": map[string]interface{}{
+							"type":     "object",
+							"required": []string{"token"},
+							"properties": map[string]interface{}{
+								"token":    map[string]interface{}{"type": "string", "description": "Access token"},
+								"protocol": map[string]interface{}{"type": "string", "enum": ws.SupportedProtocols},
+							},
+						},
+					},
+				},
+				"publish": map[string]interface{}{
+					"summary": "Commands sent by the client",
+					"message": map[string]interface{}{"oneOf": refs(ws.Commands)},
+				},
+				"subscribe": map[string]interface{}{
+					"summary": "Events sent by the server",
+					"message": map[string]interface{}{"oneOf": refs(ws.Events)},
+				},
+			},
+		},
+		"components": map[string]interface{}{
+			"messages": messages,
+			"schemas":  registry.components,
+		},
+	}
+}
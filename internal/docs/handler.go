@@ -0,0 +1,57 @@
+package docs
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>tap-me API docs</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = function () {
+      SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>`
+
+type Handler struct {
+	once     sync.Once
+	spec     map[string]interface{}
+	asyncAPI map[string]interface{}
+}
+
+func NewHandler() *Handler {
+	return &Handler{}
+}
+
+func (h *Handler) OpenAPI(c *gin.Context) {
+	h.build()
+	c.JSON(http.StatusOK, h.spec)
+}
+
+func (h *Handler) AsyncAPI(c *gin.Context) {
+	h.build()
+	c.JSON(http.StatusOK, h.asyncAPI)
+}
+
+func (h *Handler) build() {
+	h.once.Do(func() {
+		h.spec = Spec()
+		h.asyncAPI = AsyncAPI()
+	})
+}
+
+func (h *Handler) UI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerUIPage))
+}
@@ -0,0 +1,916 @@
+package docs
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Shobayosamuel/tap-me/internal/auth"
+	"github.com/Shobayosamuel/tap-me/internal/chat"
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// operation documents a single route. Request and response bodies are given as
+// Go values and converted to schemas by reflection, so the spec follows the
+// DTOs and models instead of being maintained by hand.
+type operation struct {
+	Method      string
+	Path        string // gin syntax, e.g. /api/chat/rooms/:roomId/messages
+	Tag         string
+	Summary     string
+	Description string
+	Secured     bool
+	Query       []queryParam
+	Request     interface{}
+	Responses   []response
+}
+
+type queryParam struct {
+	Name        string
+	Type        string
+	Description string
+	Required    bool
+}
+
+type response struct {
+	Status      int
+	Description string
+	Body        interface{}
+}
+
+// field is one property of an ad-hoc response envelope; handlers reply with
+// gin.H{"room": room} and similar, which have no named Go type.
+type field struct {
+	Name  string
+	Value interface{}
+}
+
+type object []field
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// fileUpload stands for a multipart/form-data request carrying one file in
+// the "file" field, along with any other form fields.
+type fileUpload struct {
+	Fields []queryParam
+}
+
+type messageBody struct {
+	Message string `json:"message"`
+}
+
+func ok(status int, description string, body interface{}) response {
+	return response{Status: status, Description: description, Body: body}
+}
+
+func fail(status int, description string) response {
+	return response{Status: status, Description: description, Body: errorBody{}}
+}
+
+// operations is the list of every documented route. CheckRoutes compares it
+// against the router at startup, so a new route fails fast until it is added here.
+var operations = []operation{
+	{
+		Method:  http.MethodPost,
+		Path:    "/auth/register",
+		Tag:     "auth",
+		Summary: "Register a new user",
+		Request: auth.RegisterRequest{},
+		Responses: []response{
+			ok(http.StatusCreated, "User registered", object{
+				{"message", ""},
+				{"tokens", auth.TokenResponse{}},
+				{"user", auth.UserResponse{}},
+			}),
+			fail(http.StatusBadRequest, "Invalid payload or user already exists"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/auth/login",
+		Tag:     "auth",
+		Summary: "Log in with username and password",
+		Request: auth.LoginRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Login successful", object{
+				{"message", ""},
+				{"tokens", auth.TokenResponse{}},
+				{"user", auth.UserResponse{}},
+			}),
+			fail(http.StatusBadRequest, "Invalid payload"),
+			fail(http.StatusUnauthorized, "Incorrect credentials"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/auth/refresh",
+		Tag:     "auth",
+		Summary: "Exchange a refresh token for a new token pair",
+		Request: auth.RefreshTokenRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Token refreshed", object{
+				{"message", ""},
+				{"tokens", auth.TokenResponse{}},
+			}),
+			fail(http.StatusBadRequest, "Invalid payload"),
+			fail(http.StatusUnauthorized, "Invalid refresh token"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/ws",
+		Tag:     "websocket",
+		Summary: "Open the chat WebSocket",
+		Description: "Upgrades the connection to a WebSocket. HTTP headers are hard to set from " +
+			"browsers, so the access token is passed in the query string. The message protocol " +
+			"is described by the AsyncAPI document at /asyncapi.json.",
+		Query: []queryParam{
+			{Name: "token", Type: "string", Description: "Access token", Required: true},
+			{Name: "protocol", Type: "string", Description: "Protocol version, as an alternative to the Sec-WebSocket-Protocol header"},
+		},
+		Responses: []response{
+			{Status: http.StatusSwitchingProtocols, Description: "Connection upgraded"},
+			fail(http.StatusUnauthorized, "Missing or invalid token"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/profile",
+		Tag:     "auth",
+		Summary: "Get the current user's profile",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Current user", object{{"user", auth.UserResponse{}}}),
+		},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/mentions",
+		Tag:         "mentions",
+		Summary:     "List the user's unread mentions",
+		Description: "Mentions in deleted messages and in rooms the user has left are left out.",
+		Secured:     true,
+		Query: []queryParam{
+			{Name: "limit", Type: "integer", Description: "Maximum number of mentions (default 50)"},
+			{Name: "offset", Type: "integer", Description: "Number of newest mentions to skip"},
+		},
+		Responses: []response{
+			ok(http.StatusOK, "Unread mentions, newest first", object{{"mentions", []models.MessageMention{}}}),
+		},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/mentions/read",
+		Tag:         "mentions",
+		Summary:     "Mark mentions as read",
+		Description: "Marks the mentions in the listed messages, or all unread mentions if message_ids is empty.",
+		Secured:     true,
+		Request:     chat.MarkMentionsReadRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Number of mentions marked", object{{"marked", int64(0)}}),
+			fail(http.StatusBadRequest, "Invalid payload"),
+		},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/saved",
+		Tag:         "saved",
+		Summary:     "List the user's saved messages",
+		Description: "Saved items of deleted messages and in rooms the user has left are left out.",
+		Secured:     true,
+		Query: []queryParam{
+			{Name: "limit", Type: "integer", Description: "Maximum number of saved items (default 50, at most 100)"},
+			{Name: "offset", Type: "integer", Description: "Number of most recently saved items to skip"},
+		},
+		Responses: []response{
+			ok(http.StatusOK, "Saved items, most recently saved first", object{{"saved_items", []models.SavedItem{}}}),
+			fail(http.StatusBadRequest, "Limit is below 1"),
+		},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/saved",
+		Tag:         "saved",
+		Summary:     "Save a message",
+		Description: "Bookmarks a message with a private note. Saving a message again returns the existing saved item unchanged.",
+		Secured:     true,
+		Request:     chat.SaveMessageRequest{},
+		Responses: []response{
+			ok(http.StatusCreated, "Message saved", object{{"saved_item", models.SavedItem{}}}),
+			ok(http.StatusOK, "Message was already saved", object{{"saved_item", models.SavedItem{}}}),
+			fail(http.StatusBadRequest, "Invalid payload"),
+			fail(http.StatusForbidden, "Not a member of the message's room"),
+			fail(http.StatusNotFound, "Message not found"),
+		},
+	},
+	{
+		Method:  http.MethodPatch,
+		Path:    "/api/saved/:id",
+		Tag:     "saved",
+		Summary: "Change a saved item's note",
+		Secured: true,
+		Request: chat.UpdateSavedItemRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Note changed", object{{"saved_item", models.SavedItem{}}}),
+			fail(http.StatusBadRequest, "Invalid payload"),
+			fail(http.StatusNotFound, "Saved item not found"),
+		},
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/api/saved/:id",
+		Tag:     "saved",
+		Summary: "Remove a saved item",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Saved item removed", object{{"message", ""}}),
+			fail(http.StatusNotFound, "Saved item not found"),
+		},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/scheduled",
+		Tag:         "scheduled",
+		Summary:     "List the user's scheduled messages and reminders",
+		Description: "Lists the ones that have not fired yet, and the ones that failed to, soonest first. Failed ones carry the reason in error.",
+		Secured:     true,
+		Query: []queryParam{
+			{Name: "limit", Type: "integer", Description: "Maximum number of items (default 50, at most 100)"},
+			{Name: "offset", Type: "integer", Description: "Number of soonest items to skip"},
+		},
+		Responses: []response{
+			ok(http.StatusOK, "Scheduled messages and reminders", object{{"scheduled", []models.ScheduledJob{}}}),
+			fail(http.StatusBadRequest, "Limit is below 1"),
+		},
+	},
+	{
+		Method:      http.MethodPatch,
+		Path:        "/api/scheduled/:id",
+		Tag:         "scheduled",
+		Summary:     "Change a scheduled message or reminder",
+		Description: "Changes the fields that are set. A failed item is retried at its new time, which must be in the future.",
+		Secured:     true,
+		Request:     chat.UpdateScheduledRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Item changed", object{{"scheduled", models.ScheduledJob{}}}),
+			fail(http.StatusBadRequest, "Invalid payload or time in the past"),
+			fail(http.StatusNotFound, "Not found, or already fired"),
+		},
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/api/scheduled/:id",
+		Tag:     "scheduled",
+		Summary: "Cancel a scheduled message or reminder",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Cancelled", object{{"message", ""}}),
+			fail(http.StatusNotFound, "Not found, or already fired"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/chat/rooms",
+		Tag:     "chat",
+		Summary: "Create a room",
+		Secured: true,
+		Request: chat.CreateRoomRequest{},
+		Responses: []response{
+			ok(http.StatusCreated, "Room created", object{{"room", models.Room{}}}),
+			fail(http.StatusBadRequest, "Invalid payload"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/rooms",
+		Tag:     "chat",
+		Summary: "List the rooms the current user belongs to",
+		Description: "Each room comes with its newest message and the number of messages from others after the user's read position, system messages aside. " +
+			"Counts stop at 100; unread_count_capped says when there are more.",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Rooms", object{{"rooms", []models.RoomSummary{}}}),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/search",
+		Tag:     "chat",
+		Summary: "Search messages in the user's rooms",
+		Description: "q mixes words, \"quoted phrases\", -excluded words and OR with the filters from:username, in:room (name or ID), " +
+			"before:YYYY-MM-DD, after:YYYY-MM-DD and has:file. Results are ranked; snippets are HTML-escaped with matches in <mark> tags.",
+		Secured: true,
+		Query: []queryParam{
+			{Name: "q", Type: "string", Description: "Search query"},
+			{Name: "limit", Type: "integer", Description: "Maximum number of results (default 20, at most 50)"},
+			{Name: "cursor", Type: "string", Description: "next_cursor from an earlier page"},
+		},
+		Responses: []response{
+			ok(http.StatusOK, "Matching messages, best first", chat.SearchPage{}),
+			fail(http.StatusBadRequest, "Empty or invalid query, or invalid cursor"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/chat/attachments",
+		Tag:     "chat",
+		Summary: "Upload a file to send in a message",
+		Description: "The content type is detected from the file. JPEG, PNG, GIF and WebP images have EXIF, GPS and other metadata " +
+			"removed and come back with their dimensions, a blurhash placeholder and thumbnails. Voice notes come back with " +
+			"duration_ms and a waveform of 64 levels from 0 to 100, and are sent as a voice message on their own. Send the upload by listing its ID in a message's attachment_ids; " +
+			"uploads that are never sent are removed after a while. Attachment URLs are signed and expire, " +
+			"so they can be used in <img> tags without an access token.",
+		Secured: true,
+		Request: fileUpload{Fields: []queryParam{
+			{Name: "voice", Type: "boolean", Description: "Store the file as a voice note; it must be Ogg/Opus or WebM audio"},
+		}},
+		Responses: []response{
+			ok(http.StatusCreated, "File stored", object{{"attachment", models.Attachment{}}}),
+			fail(http.StatusBadRequest, "Missing file, an image that could not be decoded, or an invalid or too long voice note"),
+			fail(http.StatusRequestEntityTooLarge, "File is larger than the upload limit, or would take the user past their storage quota"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/attachments/:id",
+		Tag:     "chat",
+		Summary: "Get an attachment with a fresh download URL",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Attachment", object{{"attachment", models.Attachment{}}}),
+			fail(http.StatusBadRequest, "Invalid attachment ID"),
+			fail(http.StatusForbidden, "Not a member of the message's room"),
+			fail(http.StatusNotFound, "Attachment not found"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/files/:id",
+		Tag:     "chat",
+		Summary: "Download a file through a signed URL",
+		Description: "Attachment url fields point here. The signature stands in for the access token. " +
+			"Images are served inline, other files as downloads.",
+		Query: []queryParam{
+			{Name: "expires", Type: "integer", Description: "Expiry as a Unix timestamp", Required: true},
+			{Name: "signature", Type: "string", Description: "URL signature", Required: true},
+			{Name: "thumb", Type: "integer", Description: "Width of the thumbnail to download instead of the original"},
+		},
+		Responses: []response{
+			{Status: http.StatusOK, Description: "File contents"},
+			fail(http.StatusBadRequest, "Invalid attachment ID or thumbnail size"),
+			fail(http.StatusForbidden, "Invalid or expired signature"),
+			fail(http.StatusNotFound, "File not found or its message was deleted"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/rooms/:roomId/messages",
+		Tag:     "chat",
+		Summary: "Get a room's message history",
+		Description: "Without an anchor the newest messages are returned. Pass at most one of cursor, before, after and around; " +
+			"around centres the page on a message, for jumping to it. Follow prev_cursor for older messages and next_cursor for newer ones.",
+		Secured: true,
+		Query: []queryParam{
+			{Name: "limit", Type: "integer", Description: "Maximum number of messages (default 50, at most 100)"},
+			{Name: "cursor", Type: "string", Description: "prev_cursor or next_cursor from an earlier page"},
+			{Name: "before", Type: "integer", Description: "Return messages older than this message"},
+			{Name: "after", Type: "integer", Description: "Return messages newer than this message"},
+			{Name: "around", Type: "integer", Description: "Return this message with the messages around it"},
+		},
+		Responses: []response{
+			ok(http.StatusOK, "Messages, oldest first", chat.MessagePage{}),
+			fail(http.StatusBadRequest, "Invalid room ID, cursor or anchor"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/rooms/:roomId/sync",
+		Tag:     "chat",
+		Summary: "Get everything that changed in a room after a sequence number",
+		Description: "Every change to a room (new message, edit, deletion, reaction, thread reply) takes the room's next seq, " +
+			"which WebSocket events carry. A client that sees a gap syncs from the last seq it has; " +
+			"messages come back as they are now, ordered by their latest change. Sync again from seq while has_more is set.",
+		Secured: true,
+		Query: []queryParam{
+			{Name: "since", Type: "integer", Description: "Last seq the client has seen (default 0)"},
+			{Name: "limit", Type: "integer", Description: "Maximum number of messages (default 200, at most 500)"},
+		},
+		Responses: []response{
+			ok(http.StatusOK, "Changed messages", models.SyncResult{}),
+			fail(http.StatusBadRequest, "Invalid room ID, or since is ahead of the room"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/chat/rooms/:roomId/messages",
+		Tag:     "chat",
+		Summary: "Send a message to a room",
+		Description: "The message is also delivered to the room's live WebSocket subscribers. " +
+			"Resending a client_msg_id returns the original message with 200 instead of posting it again. " +
+			"Set parent_id to reply in a thread; replies stay out of the timeline unless also_send_to_channel is set. " +
+			"Set reply_to_id to quote an earlier message of the room inline. " +
+			"List uploads in attachment_ids to send them; content may then be empty. " +
+			"Set format to markdown to have content rendered; the sanitized result is returned as html. " +
+			"Set poll to send a poll, whose question becomes the content; polls take 2 to 10 options and no attachments. " +
+			"Previews of the first three links are fetched afterwards and arrive in a message_updated event.",
+		Secured: true,
+		Request: chat.SendMessageRequest{},
+		Responses: []response{
+			ok(http.StatusCreated, "Message sent", object{{"message", models.Message{}}}),
+			ok(http.StatusOK, "Retry of an earlier send", object{{"message", models.Message{}}}),
+			fail(http.StatusBadRequest, "Invalid room ID, payload, parent, quoted message or attachments"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/chat/rooms/:roomId/join",
+		Tag:     "chat",
+		Summary: "Join a public room",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Joined", messageBody{}),
+			fail(http.StatusBadRequest, "Invalid room ID or private room"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/chat/rooms/:roomId/leave",
+		Tag:     "chat",
+		Summary: "Leave a room",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Left", messageBody{}),
+			fail(http.StatusBadRequest, "Invalid room ID"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+		},
+	},
+	{
+		Method:      http.MethodPatch,
+		Path:        "/api/chat/rooms/:roomId",
+		Tag:         "chat",
+		Summary:     "Rename a room or change its description",
+		Description: "Only the fields present are changed. Renames are recorded in the room's timeline as a system message.",
+		Secured:     true,
+		Request:     chat.UpdateRoomRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Updated room", object{{"room", models.Room{}}}),
+			fail(http.StatusBadRequest, "Invalid room ID or payload"),
+			fail(http.StatusForbidden, "Not an admin of the room"),
+		},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/chat/rooms/:roomId/members/:userId/role",
+		Tag:         "chat",
+		Summary:     "Change a member's role",
+		Description: "Admins can change the role of other members. The change is recorded in the room's timeline as a system message.",
+		Secured:     true,
+		Request:     chat.SetMemberRoleRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Role updated", messageBody{}),
+			fail(http.StatusBadRequest, "Invalid room ID, user ID or role, or the admin's own role"),
+			fail(http.StatusForbidden, "Not an admin of the room"),
+			fail(http.StatusNotFound, "User is not a member of the room"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/rooms/:roomId/online",
+		Tag:     "chat",
+		Summary: "List users currently connected to a room",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Online users", object{{"online_users", []models.User{}}}),
+			fail(http.StatusBadRequest, "Invalid room ID"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/rooms/:roomId/read",
+		Tag:     "chat",
+		Summary: "Get how far each member has read",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Read positions of members who have read anything", object{{"read_positions", []models.ReadPosition{}}}),
+			fail(http.StatusBadRequest, "Invalid room ID"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+		},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/chat/rooms/:roomId/read",
+		Tag:         "chat",
+		Summary:     "Mark a room as read up to a message",
+		Description: "The read position only moves forward; marking an older message is a no-op. Other members are sent a read_position event.",
+		Secured:     true,
+		Request:     chat.MarkReadRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Read position as requested", object{{"read_position", models.ReadPosition{}}}),
+			fail(http.StatusBadRequest, "Invalid room ID, payload, or message not in the room"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+		},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/chat/rooms/:roomId/scheduled",
+		Tag:         "scheduled",
+		Summary:     "Schedule a message",
+		Description: "Sends the message to the room at send_at, as the user. Scheduled messages cannot carry attachments.",
+		Secured:     true,
+		Request:     chat.ScheduleMessageRequest{},
+		Responses: []response{
+			ok(http.StatusCreated, "Message scheduled", object{{"scheduled", models.ScheduledJob{}}}),
+			fail(http.StatusBadRequest, "Invalid payload or time in the past"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+			fail(http.StatusConflict, "Too many pending scheduled messages and reminders"),
+		},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/chat/messages/:id/reminders",
+		Tag:         "scheduled",
+		Summary:     "Set a reminder about a message",
+		Description: "A reminder event is sent to the user's connections at remind_at, unless the message is deleted or the user left its room by then.",
+		Secured:     true,
+		Request:     chat.CreateReminderRequest{},
+		Responses: []response{
+			ok(http.StatusCreated, "Reminder set", object{{"scheduled", models.ScheduledJob{}}}),
+			fail(http.StatusBadRequest, "Invalid payload or time in the past"),
+			fail(http.StatusForbidden, "Not a member of the message's room"),
+			fail(http.StatusNotFound, "Message not found"),
+			fail(http.StatusConflict, "Too many pending scheduled messages and reminders"),
+		},
+	},
+	{
+		Method:      http.MethodPatch,
+		Path:        "/api/chat/messages/:id",
+		Tag:         "chat",
+		Summary:     "Edit a message",
+		Description: "Only the author can edit, within the configured edit window. Room subscribers receive a message_edited event when the content changed.",
+		Secured:     true,
+		Request:     chat.EditMessageRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Edited message", object{{"message", models.Message{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID or payload"),
+			fail(http.StatusForbidden, "Not the author"),
+			fail(http.StatusNotFound, "Message not found"),
+			fail(http.StatusConflict, "Edit window has expired"),
+		},
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/api/chat/messages/:id",
+		Tag:         "chat",
+		Summary:     "Delete a message",
+		Description: "Authors can delete their own messages; room moderators and admins can delete any. The message stays in history as a tombstone until it is purged.",
+		Secured:     true,
+		Responses: []response{
+			ok(http.StatusOK, "Tombstone of the deleted message", object{{"message", models.Message{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID"),
+			fail(http.StatusForbidden, "Not the author or a moderator"),
+			fail(http.StatusNotFound, "Message not found"),
+		},
+	},
+	{
+		Method:      http.MethodGet,
+		Path:        "/api/chat/messages/:id/thread",
+		Tag:         "chat",
+		Summary:     "Get a message's thread",
+		Description: "The id may be the thread's root or any reply in it.",
+		Secured:     true,
+		Query: []queryParam{
+			{Name: "limit", Type: "integer", Description: "Maximum number of replies (default 50)"},
+			{Name: "offset", Type: "integer", Description: "Number of oldest replies to skip"},
+		},
+		Responses: []response{
+			ok(http.StatusOK, "Root message and replies, oldest first", object{{"root", models.Message{}}, {"replies", []models.Message{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+			fail(http.StatusNotFound, "Message not found"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/chat/messages/:id/forward",
+		Tag:     "chat",
+		Summary: "Forward a message to another room",
+		Description: "The copy credits the original author in forwarded_from. The user must belong to both rooms. " +
+			"Resending a client_msg_id returns the earlier copy with 200.",
+		Secured: true,
+		Request: chat.ForwardMessageRequest{},
+		Responses: []response{
+			ok(http.StatusCreated, "Message forwarded", object{{"message", models.Message{}}}),
+			ok(http.StatusOK, "Retry of an earlier forward", object{{"message", models.Message{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID or payload"),
+			fail(http.StatusForbidden, "Not a member of the source or target room"),
+			fail(http.StatusNotFound, "Message not found"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/rooms/:roomId/pins",
+		Tag:     "chat",
+		Summary: "List a room's pinned messages",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Pinned messages, most recently pinned first", object{{"messages", []models.Message{}}}),
+			fail(http.StatusBadRequest, "Invalid room ID"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+		},
+	},
+	{
+		Method:  http.MethodGet,
+		Path:    "/api/chat/messages/:id/revisions",
+		Tag:     "chat",
+		Summary: "List a message's earlier versions",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Revisions, oldest first", object{{"revisions", []models.MessageRevision{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID"),
+			fail(http.StatusForbidden, "Not a moderator or admin of the room"),
+			fail(http.StatusNotFound, "Message not found"),
+		},
+	},
+	{
+		Method:      http.MethodPut,
+		Path:        "/api/chat/messages/:id/poll/votes",
+		Tag:         "chat",
+		Summary:     "Vote on a poll",
+		Description: "Replaces the user's votes; an empty option_ids takes them back. Changes are broadcast as poll_updated.",
+		Secured:     true,
+		Request:     chat.PollVoteRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Poll with its new tallies and the user's votes", object{{"poll", models.Poll{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID or options, or the message is not a poll"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+			fail(http.StatusNotFound, "Message not found"),
+			fail(http.StatusConflict, "Poll is closed"),
+		},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/chat/messages/:id/poll/close",
+		Tag:         "chat",
+		Summary:     "Close a poll early",
+		Description: "Only the poll's creator or a room moderator can close it. Closing a closed poll is a no-op.",
+		Secured:     true,
+		Responses: []response{
+			ok(http.StatusOK, "Poll with its final tallies", object{{"poll", models.Poll{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID, or the message is not a poll"),
+			fail(http.StatusForbidden, "Neither the poll's creator nor a room moderator"),
+			fail(http.StatusNotFound, "Message not found"),
+		},
+	},
+	{
+		Method:      http.MethodPost,
+		Path:        "/api/chat/messages/:id/reactions",
+		Tag:         "chat",
+		Summary:     "React to a message",
+		Description: "The emoji is an emoji sequence or a :shortcode:. Reacting twice with the same emoji is a no-op. A message accepts a limited number of distinct emoji.",
+		Secured:     true,
+		Request:     chat.ReactionRequest{},
+		Responses: []response{
+			ok(http.StatusOK, "Reaction with the emoji's new count", object{{"reaction", models.ReactionChange{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID or emoji"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+			fail(http.StatusNotFound, "Message not found"),
+			fail(http.StatusConflict, "Too many distinct emoji on the message"),
+		},
+	},
+	{
+		Method:  http.MethodDelete,
+		Path:    "/api/chat/messages/:id/reactions/:emoji",
+		Tag:     "chat",
+		Summary: "Remove a reaction",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Reaction with the emoji's new count", object{{"reaction", models.ReactionChange{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID or emoji"),
+			fail(http.StatusForbidden, "Not a member of the room"),
+			fail(http.StatusNotFound, "Message not found"),
+		},
+	},
+	{
+		Method:  http.MethodPost,
+		Path:    "/api/chat/messages/:id/pin",
+		Tag:     "chat",
+		Summary: "Pin a message to its room",
+		Description: "Pinning a pinned message is a no-op. Otherwise the room gets a message_pinned event and a system message recording it. " +
+			"A room holds a limited number of pins.",
+		Secured: true,
+		Responses: []response{
+			ok(http.StatusOK, "Pinned message", object{{"message", models.Message{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID or system message"),
+			fail(http.StatusForbidden, "Not a moderator or admin of the room"),
+			fail(http.StatusNotFound, "Message not found"),
+			fail(http.StatusConflict, "The room has reached its pin limit"),
+		},
+	},
+	{
+		Method:      http.MethodDelete,
+		Path:        "/api/chat/messages/:id/pin",
+		Tag:         "chat",
+		Summary:     "Unpin a message",
+		Description: "Unpinning a message that is not pinned is a no-op. Otherwise the room gets a message_unpinned event and a system message recording it.",
+		Secured:     true,
+		Responses: []response{
+			ok(http.StatusOK, "Unpinned message", object{{"message", models.Message{}}}),
+			fail(http.StatusBadRequest, "Invalid message ID or system message"),
+			fail(http.StatusForbidden, "Not a moderator or admin of the room"),
+			fail(http.StatusNotFound, "Message not found"),
+		},
+	},
+}
+
+var pathParam = regexp.MustCompile(`:([A-Za-z0-9_]+)`)
+
+// openAPIPath converts gin's :param syntax into OpenAPI's {param}.
+func openAPIPath(path string) string {
+	return pathParam.ReplaceAllString(path, "{$1}")
+}
+
+// Spec builds the OpenAPI 3 document for the HTTP API.
+func Spec() map[string]interface{} {
+	registry := newSchemaRegistry()
+	paths := map[string]interface{}{}
+
+	for _, op := range operations {
+		item, _ := paths[openAPIPath(op.Path)].(map[string]interface{})
+		if item == nil {
+			item = map[string]interface{}{}
+			paths[openAPIPath(op.Path)] = item
+		}
+		item[strings.ToLower(op.Method)] = op.build(registry)
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "tap-me API",
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": registry.components,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]interface{}{
+					"type":         "http",
+					"scheme":       "bearer",
+					"bearerFormat": "JWT",
+				},
+			},
+		},
+	}
+}
+
+func (op operation) build(registry *schemaRegistry) map[string]interface{} {
+	out := map[string]interface{}{
+		"summary":     op.Summary,
+		"tags":        []string{op.Tag},
+		"operationId": operationID(op),
+	}
+	if op.Description != "" {
+		out["description"] = op.Description
+	}
+	if op.Secured {
+		out["security"] = []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+	}
+
+	var params []interface{}
+	for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+		// IDs are numeric; anything else (e.g. an emoji) is a string
+		schema := map[string]interface{}{"type": "string"}
+		if match[1] == "id" || strings.HasSuffix(match[1], "Id") {
+			schema = map[string]interface{}{"type": "integer", "minimum": 1}
+		}
+		params = append(params, map[string]interface{}{
+			"name":     match[1],
+			"in":       "path",
+			"required": true,
+			"schema":   schema,
+		})
+	}
+	for _, q := range op.Query {
+		param := map[string]interface{}{
+			"name":   q.Name,
+			"in":     "query",
+			"schema": map[string]interface{}{"type": q.Type},
+		}
+		if q.Description != "" {
+			param["description"] = q.Description
+		}
+		if q.Required {
+			param["required"] = true
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		out["parameters"] = params
+	}
+
+	if upload, isUpload := op.Request.(fileUpload); isUpload {
+		properties := map[string]interface{}{"file": map[string]interface{}{"type": "string", "format": "binary"}}
+		for _, f := range upload.Fields {
+			properties[f.Name] = map[string]interface{}{"type": f.Type, "description": f.Description}
+		}
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"multipart/form-data": map[string]interface{}{"schema": map[string]interface{}{
+					"type":       "object",
+					"required":   []string{"file"},
+					"properties": properties,
+				}},
+			},
+		}
+	} else if op.Request != nil {
+		out["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": bodySchema(registry, op.Request)},
+			},
+		}
+	}
+
+	responses := map[string]interface{}{}
+	for _, r := range op.Responses {
+		resp := map[string]interface{}{"description": r.Description}
+		if r.Body != nil {
+			resp["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": bodySchema(registry, r.Body)},
+			}
+		}
+		responses[fmt.Sprint(r.Status)] = resp
+	}
+	if op.Secured {
+		responses[fmt.Sprint(http.StatusUnauthorized)] = map[string]interface{}{
+			"description": "Missing or invalid access token",
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": registry.schemaOf(errorBody{})},
+			},
+		}
+	}
+	out["responses"] = responses
+
+	return out
+}
+
+func bodySchema(registry *schemaRegistry, body interface{}) map[string]interface{} {
+	obj, isObject := body.(object)
+	if !isObject {
+		return registry.schemaOf(body)
+	}
+
+	properties := map[string]interface{}{}
+	for _, f := range obj {
+		properties[f.Name] = registry.schemaOf(f.Value)
+	}
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func operationID(op operation) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(op.Method))
+	for _, part := range strings.Split(op.Path, "/") {
+		part = strings.TrimPrefix(part, ":")
+		if part == "" {
+			continue
+		}
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+// CheckRoutes reports every /auth and /api route registered on the router that
+// has no matching operation in the spec.
+func CheckRoutes(routes gin.RoutesInfo) error {
+	documented := make(map[string]bool, len(operations))
+	for _, op := range operations {
+		documented[op.Method+" "+op.Path] = true
+	}
+
+	var missing []string
+	for _, route := range routes {
+		if !strings.HasPrefix(route.Path, "/auth/") && !strings.HasPrefix(route.Path, "/api/") {
+			continue
+		}
+		if !documented[route.Method+" "+route.Path] {
+			missing = append(missing, route.Method+" "+route.Path)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	sort.Strings(missing)
+	return fmt.Errorf("routes missing from OpenAPI spec: %s", strings.Join(missing, ", "))
+}
@@ -0,0 +1,28 @@
+package docs
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestCheckRoutesReportsUndocumented(t *testing.T) {
+	routes := gin.RoutesInfo{
+		{Method: http.MethodGet, Path: "/api/mentions"},
+		{Method: http.MethodGet, Path: "/api/undocumented"},
+		{Method: http.MethodGet, Path: "/files/:id"},
+	}
+
+	err := CheckRoutes(routes)
+	if err == nil {
+		t.Fatal("expected an error for an undocumented route")
+	}
+	if !strings.Contains(err.Error(), "GET /api/undocumented") {
+		t.Errorf("error %q does not name the undocumented route", err)
+	}
+	if strings.Contains(err.Error(), "/api/mentions") || strings.Contains(err.Error(), "/files/") {
+		t.Errorf("error %q names routes that are documented or not checked", err)
+	}
+}
@@ -0,0 +1,192 @@
+package docs
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaRegistry turns Go types into JSON Schema objects. Named structs are
+// emitted once under components/schemas and referenced everywhere else, which
+// keeps recursive models (Room -> Message -> Room) finite.
+type schemaRegistry struct {
+	components map[string]interface{}
+}
+
+func newSchemaRegistry() *schemaRegistry {
+	return &schemaRegistry{components: make(map[string]interface{})}
+}
+
+func (r *schemaRegistry) schemaOf(v interface{}) map[string]interface{} {
+	return r.schemaFor(reflect.TypeOf(v))
+}
+
+func (r *schemaRegistry) schemaFor(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		name := componentName(t)
+		if _, ok := r.components[name]; !ok {
+			// Reserve the name before walking fields so self-references resolve.
+			r.components[name] = map[string]interface{}{}
+			r.components[name] = r.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	case t.Kind() == reflect.Struct:
+		return r.structSchema(t)
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": r.schemaFor(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": r.schemaFor(t.Elem())}
+	}
+	return map[string]interface{}{}
+}
+
+func (r *schemaRegistry) structSchema(t reflect.Type) map[string]interface{} {
+	properties := map[string]interface{}{}
+	var required []string
+	r.collectFields(t, properties, &required)
+
+	schema := map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (r *schemaRegistry) collectFields(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		name, omitted := jsonName(field)
+		if omitted {
+			continue
+		}
+
+		// Embedded structs without a json name are flattened, like encoding/json does.
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				r.collectFields(ft, properties, required)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := r.schemaFor(field.Type)
+		if _, isRef := prop["$ref"]; !isRef {
+			applyBinding(prop, field.Tag.Get("binding"))
+		}
+		properties[name] = prop
+
+		if hasRule(field.Tag.Get("binding"), "required") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func jsonName(field reflect.StructField) (string, bool) {
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	return name, false
+}
+
+func componentName(t reflect.Type) string {
+	pkg := t.PkgPath()
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if pkg == "" || pkg == "docs" {
+		return name
+	}
+	return strings.ToUpper(pkg[:1]) + pkg[1:] + name
+}
+
+// applyBinding maps the gin/validator rules we use on DTOs onto JSON Schema
+// keywords so the documented constraints match what the handlers enforce.
+func applyBinding(prop map[string]interface{}, binding string) {
+	if binding == "" {
+		return
+	}
+	isString := prop["type"] == "string"
+	isArray := prop["type"] == "array"
+	for _, rule := range strings.Split(binding, ",") {
+		key, value, _ := strings.Cut(rule, "=")
+		switch key {
+		case "min", "max":
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				continue
+			}
+			switch {
+			case isString && key == "min":
+				prop["minLength"] = n
+			case isString:
+				prop["maxLength"] = n
+			case isArray && key == "min":
+				prop["minItems"] = n
+			case isArray:
+				prop["maxItems"] = n
+			case key == "min":
+				prop["minimum"] = n
+			default:
+				prop["maximum"] = n
+			}
+		case "email":
+			prop["format"] = "email"
+		case "url":
+			prop["format"] = "uri"
+		case "oneof":
+			var values []interface{}
+			for _, v := range strings.Fields(value) {
+				values = append(values, v)
+			}
+			prop["enum"] = values
+		}
+	}
+}
+
+func hasRule(binding, rule string) bool {
+	for _, r := range strings.Split(binding, ",") {
+		if r == rule {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,249 @@
+// Package markdown renders the Markdown subset messages may use: bold,
+// italic, inline code, fenced code blocks, links, block quotes and lists.
+//
+// The output is built only from the tags listed here, with all text and
+// attributes escaped, so it is safe to insert into a page as is. Raw HTML in
+// the source is shown as text. Two things differ from CommonMark to suit
+// chat: a newline inside a paragraph is a line break, and a block quote ends
+// at the first line without a ">".
+package markdown
+
+import (
+	"regexp"
+	"strings"
+)
+
+// maxDepth bounds how far quotes, lists and emphasis may nest, so hostile
+// input cannot recurse without limit.
+const maxDepth = 8
+
+// Document is a rendered message.
+type Document struct {
+	// HTML is the sanitized rendering.
+	HTML string
+
+	// Text is the content without formatting, for search, previews and
+	// notifications.
+	Text string
+}
+
+// Render parses source and renders it.
+func Render(source string) *Document {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+
+	r := &renderer{}
+	r.blocks(parseBlocks(strings.Split(source, "\n"), 0), true)
+	return &Document{
+		HTML: strings.TrimSpace(r.html.String()),
+		Text: strings.TrimSpace(r.text.String()),
+	}
+}
+
+var (
+	fencePattern   = regexp.MustCompile("^( {0,3})(`{3,}|~{3,})[ \t]*([^`]*)$")
+	quotePattern   = regexp.MustCompile(`^ {0,3}> ?`)
+	listPattern    = regexp.MustCompile(`^( {0,3})([-*+]|[0-9]{1,9}[.)])( +|$)`)
+	languageFilter = regexp.MustCompile(`^[A-Za-z0-9_+#.-]{1,32}$`)
+)
+
+type blockKind int
+
+const (
+	paragraphBlock blockKind = iota
+	codeBlock
+	quoteBlock
+	listBlock
+)
+
+type block struct {
+	kind     blockKind
+	text     string     // paragraph or code content
+	language string     // code blocks
+	children []*block   // quotes
+	items    [][]*block // lists
+	ordered  bool
+	start    string // first number of an ordered list
+	loose    bool   // list items separated by blank lines
+}
+
+// parseBlocks splits lines into blocks.
+func parseBlocks(lines []string, depth int) []*block {
+	var blocks []*block
+	for i := 0; i < len(lines); {
+		line := expandTabs(lines[i])
+		switch {
+		case isBlank(line):
+			i++
+		case fencePattern.MatchString(line):
+			var b *block
+			b, i = parseFence(lines, i)
+			blocks = append(blocks, b)
+		case depth < maxDepth && quotePattern.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && quotePattern.MatchString(expandTabs(lines[i])); i++ {
+				l := expandTabs(lines[i])
+				quoted = append(quoted, l[len(quotePattern.FindString(l)):])
+			}
+			blocks = append(blocks, &block{kind: quoteBlock, children: parseBlocks(quoted, depth+1)})
+		case depth < maxDepth && listPattern.MatchString(line):
+			var b *block
+			b, i = parseList(lines, i, depth)
+			blocks = append(blocks, b)
+		default:
+			var paragraph []string
+			for ; i < len(lines); i++ {
+				l := expandTabs(lines[i])
+				if isBlank(l) || (len(paragraph) > 0 && startsBlock(l, depth)) {
+					break
+				}
+				paragraph = append(paragraph, strings.TrimSpace(l))
+			}
+			blocks = append(blocks, &block{kind: paragraphBlock, text: strings.Join(paragraph, "\n")})
+		}
+	}
+	return blocks
+}
+
+// parseFence reads the fenced code block starting at lines[i]. A block left
+// open runs to the end of the message.
+func parseFence(lines []string, i int) (*block, int) {
+	m := fencePattern.FindStringSubmatch(expandTabs(lines[i]))
+	indent, fence := len(m[1]), m[2]
+	b := &block{kind: codeBlock}
+	if info := strings.Fields(m[3]); len(info) > 0 && languageFilter.MatchString(info[0]) {
+		b.language = info[0]
+	}
+
+	var code []string
+	for i++; i < len(lines); i++ {
+		line := expandTabs(lines[i])
+		if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, fence) &&
+			strings.Trim(trimmed, fence[:1]) == "" && len(line)-len(strings.TrimLeft(line, " ")) < 4 {
+			i++
+			break
+		}
+		code = append(code, trimIndent(line, indent))
+	}
+	b.text = strings.Join(code, "\n")
+	return b, i
+}
+
+// parseList reads the list starting at lines[i]. Lines indented past an
+// item's marker belong to the item; so do unindented lines continuing its
+// text.
+func parseList(lines []string, i, depth int) (*block, int) {
+	first := listPattern.FindStringSubmatch(expandTabs(lines[i]))
+	marker := first[2]
+	b := &block{kind: listBlock, ordered: isOrdered(marker)}
+	if b.ordered {
+		b.start = strings.TrimLeft(marker[:len(marker)-1], "0")
+		if b.start == "" {
+			b.start = "0"
+		}
+	}
+
+	for i < len(lines) {
+		line := expandTabs(lines[i])
+		m := listPattern.FindStringSubmatch(line)
+		if m == nil || !sameList(marker, m[2]) {
+			break
+		}
+		contentIndent := len(m[0])
+		if m[3] == "" {
+			contentIndent++
+		}
+		item := []string{line[len(m[0]):]}
+		i++
+
+		for i < len(lines) {
+			line := expandTabs(lines[i])
+			if isBlank(line) {
+				next := i
+				for next < len(lines) && isBlank(lines[next]) {
+					next++
+				}
+				if next < len(lines) && indentOf(expandTabs(lines[next])) >= contentIndent {
+					// A blank line inside an item
+					item = append(item, "")
+					b.loose = true
+					i = next
+					continue
+				}
+				if next < len(lines) {
+					if m := listPattern.FindStringSubmatch(expandTabs(lines[next])); m != nil && sameList(marker, m[2]) {
+						// A blank line between items
+						b.loose = true
+						i = next
+					}
+				}
+				break
+			}
+			if indentOf(line) >= contentIndent {
+				item = append(item, line[contentIndent:])
+				i++
+				continue
+			}
+			if startsBlock(line, depth) || isBlank(item[len(item)-1]) {
+				break
+			}
+			item = append(item, strings.TrimSpace(line))
+			i++
+		}
+		b.items = append(b.items, parseBlocks(item, depth+1))
+
+		if i < len(lines) && isBlank(lines[i]) {
+			break
+		}
+	}
+	return b, i
+}
+
+// startsBlock reports whether line begins a block that interrupts a
+// paragraph.
+func startsBlock(line string, depth int) bool {
+	if fencePattern.MatchString(line) {
+		return true
+	}
+	return depth < maxDepth && (quotePattern.MatchString(line) || listPattern.MatchString(line))
+}
+
+func isOrdered(marker string) bool {
+	return marker[0] >= '0' && marker[0] <= '9'
+}
+
+// sameList reports whether an item with marker b continues a list started
+// with marker a: both bullets of the same character, or both numbered with
+// the same delimiter.
+func sameList(a, b string) bool {
+	if isOrdered(a) != isOrdered(b) {
+		return false
+	}
+	return a[len(a)-1] == b[len(b)-1]
+}
+
+func isBlank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+func indentOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// trimIndent removes up to n leading spaces.
+func trimIndent(line string, n int) string {
+	for n > 0 && strings.HasPrefix(line, " ") {
+		line = line[1:]
+		n--
+	}
+	return line
+}
+
+// expandTabs turns tabs in a line's indentation into four spaces each.
+func expandTabs(line string) string {
+	indent := len(line) - len(strings.TrimLeft(line, " \t"))
+	if !strings.Contains(line[:indent], "\t") {
+		return line
+	}
+	return strings.ReplaceAll(line[:indent], "\t", "    ") + line[indent:]
+}
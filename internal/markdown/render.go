@@ -0,0 +1,409 @@
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// renderer writes the HTML and the plain text of a document side by side.
+type renderer struct {
+	html strings.Builder
+	text strings.Builder
+}
+
+// blocks renders a sequence of blocks. Outside of loose lists, paragraphs in
+// list items are not wrapped in <p>.
+func (r *renderer) blocks(blocks []*block, wrap bool) {
+	for i, b := range blocks {
+		if i > 0 {
+			r.text.WriteString("\n")
+		}
+		switch b.kind {
+		case paragraphBlock:
+			if wrap {
+				r.html.WriteString("<p>")
+			}
+			r.inline(b.text, 0, false)
+			if wrap {
+				r.html.WriteString("</p>")
+			}
+		case codeBlock:
+			r.html.WriteString("<pre><code")
+			if b.language != "" {
+				r.html.WriteString(` class="language-` + html.EscapeString(b.language) + `"`)
+			}
+			r.html.WriteString(">" + html.EscapeString(b.text) + "</code></pre>")
+			r.text.WriteString(b.text)
+		case quoteBlock:
+			r.html.WriteString("<blockquote>")
+			r.blocks(b.children, true)
+			r.html.WriteString("</blockquote>")
+		case listBlock:
+			tag := "ul"
+			if b.ordered {
+				tag = "ol"
+			}
+			r.html.WriteString("<" + tag)
+			if b.ordered && b.start != "" && b.start != "1" {
+				r.html.WriteString(` start="` + b.start + `"`)
+			}
+			r.html.WriteString(">")
+			for j, item := range b.items {
+				if j > 0 {
+					r.text.WriteString("\n")
+				}
+				r.html.WriteString("<li>")
+				r.blocks(item, b.loose)
+				r.html.WriteString("</li>")
+			}
+			r.html.WriteString("</" + tag + ">")
+		}
+		r.html.WriteString("\n")
+	}
+}
+
+// inline renders the spans of a paragraph. Inside a link, nested links and
+// bare URLs are left as text.
+func (r *renderer) inline(s string, depth int, inLink bool) {
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			r.lineBreak()
+			i += 2
+			continue
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			r.write(s[i+1 : i+2])
+			i += 2
+			continue
+		case c == '\n':
+			r.lineBreak()
+			i++
+			continue
+		case c == '`':
+			if end, ok := r.codeSpan(s, i); ok {
+				i = end
+				continue
+			}
+			n := runLength(s, i)
+			r.write(s[i : i+n])
+			i += n
+			continue
+		case c == '*' || c == '_':
+			if end, ok := r.emphasis(s, i, depth); ok {
+				i = end
+				continue
+			}
+			n := runLength(s, i)
+			r.write(s[i : i+n])
+			i += n
+			continue
+		case c == '[' && !inLink:
+			if end, ok := r.link(s, i, depth); ok {
+				i = end
+				continue
+			}
+		case c == '<' && !inLink:
+			if end, ok := r.autolink(s, i); ok {
+				i = end
+				continue
+			}
+		case c == 'h' && !inLink && (i == 0 || !isWordByte(s[i-1])):
+			if end, ok := r.bareURL(s, i); ok {
+				i = end
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		r.write(s[i : i+size])
+		i += size
+	}
+}
+
+// codeSpan renders the code span opening at s[i], returning where it ends.
+// It closes at the next backtick run of the same length.
+func (r *renderer) codeSpan(s string, i int) (int, bool) {
+	n := runLength(s, i)
+	for j := i + n; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(s, j)
+		if m != n {
+			j += m
+			continue
+		}
+		code := strings.ReplaceAll(s[i+n:j], "\n", " ")
+		if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+			code = code[1 : len(code)-1]
+		}
+		r.html.WriteString("<code>" + html.EscapeString(code) + "</code>")
+		r.text.WriteString(code)
+		return j + m, true
+	}
+	return 0, false
+}
+
+// emphasis renders the emphasis opening at s[i]: ** or __ for bold, * or _
+// for italics. A run of three or more opens italics around the rest, so
+// ***both*** is bold inside italics. Underscores only count at word edges,
+// keeping snake_case intact.
+func (r *renderer) emphasis(s string, i, depth int) (int, bool) {
+	if depth >= maxDepth {
+		return 0, false
+	}
+	c := s[i]
+	n := runLength(s, i)
+	k := 1
+	if n == 2 {
+		k = 2
+	}
+
+	// Openers must be followed by text, and underscores must start a word
+	after := i + n
+	if after >= len(s) || isSpace(s[after]) {
+		return 0, false
+	}
+	if c == '_' && i > 0 && isWordByte(s[i-1]) {
+		return 0, false
+	}
+
+	start := i + k
+	for j := start; j < len(s); {
+		switch s[j] {
+		case '\\':
+			j += 2
+			continue
+		case '`':
+			if end, ok := closeRun(s, j); ok {
+				j = end
+				continue
+			}
+		}
+		if s[j] != c {
+			j++
+			continue
+		}
+		// A run of two closes bold only, leaving *a **b** c* as italics
+		m := runLength(s, j)
+		closer := j + m - k
+		if m >= k && (k == 2 || m != 2) && j > start && !isSpace(s[j-1]) &&
+			(c != '_' || j+m >= len(s) || !isWordByte(s[j+m])) {
+			tag := "em"
+			if k == 2 {
+				tag = "strong"
+			}
+			r.html.WriteString("<" + tag + ">")
+			r.inline(s[start:closer], depth+1, false)
+			r.html.WriteString("</" + tag + ">")
+			return closer + k, true
+		}
+		j += m
+	}
+	return 0, false
+}
+
+// link renders a [label](url) link opening at s[i]. Links to anything but
+// http, https and mailto URLs keep their label as plain text.
+func (r *renderer) link(s string, i, depth int) (int, bool) {
+	// Find the matching bracket, skipping code spans and escapes
+	level := 0
+	labelEnd := -1
+	for j := i; j < len(s) && labelEnd < 0; j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			if end, ok := closeRun(s, j); ok {
+				j = end - 1
+			}
+		case '[':
+			level++
+		case ']':
+			level--
+			if level == 0 {
+				labelEnd = j
+			}
+		}
+	}
+	if labelEnd < 0 || labelEnd+1 >= len(s) || s[labelEnd+1] != '(' {
+		return 0, false
+	}
+
+	// The destination may hold balanced parentheses, then an optional title
+	parens := 0
+	destEnd := -1
+	for j := labelEnd + 2; j < len(s) && destEnd < 0; j++ {
+		switch s[j] {
+		case '(':
+			parens++
+		case ')':
+			if parens == 0 {
+				destEnd = j
+			}
+			parens--
+		case ' ', '\n':
+			destEnd = j
+		}
+	}
+	if destEnd < 0 {
+		return 0, false
+	}
+	end := destEnd
+	if s[end] != ')' {
+		paren := strings.IndexByte(s[end:], ')')
+		if paren < 0 || !isTitle(strings.TrimSpace(s[end:end+paren])) {
+			return 0, false
+		}
+		end += paren
+	}
+
+	label := s[i+1 : labelEnd]
+	href, ok := safeURL(s[labelEnd+2 : destEnd])
+	if !ok {
+		r.inline(label, depth+1, true)
+		return end + 1, true
+	}
+	r.openLink(href)
+	r.inline(label, depth+1, true)
+	r.html.WriteString("</a>")
+	return end + 1, true
+}
+
+// autolink renders a <https://…> link opening at s[i].
+func (r *renderer) autolink(s string, i int) (int, bool) {
+	end := strings.IndexByte(s[i:], '>')
+	if end < 0 {
+		return 0, false
+	}
+	inner := s[i+1 : i+end]
+	if strings.ContainsAny(inner, " \n<") {
+		return 0, false
+	}
+	href, ok := safeURL(inner)
+	if !ok {
+		return 0, false
+	}
+	r.openLink(href)
+	r.write(inner)
+	r.html.WriteString("</a>")
+	return i + end + 1, true
+}
+
+// bareURL turns an http or https URL in the text into a link. Trailing
+// punctuation, and closing parentheses that were not opened in the URL, are
+// left out.
+func (r *renderer) bareURL(s string, i int) (int, bool) {
+	if !strings.HasPrefix(s[i:], "http://") && !strings.HasPrefix(s[i:], "https://") {
+		return 0, false
+	}
+	end := i
+	for end < len(s) && !isSpace(s[end]) && s[end] != '<' && s[end] != '>' {
+		end++
+	}
+	for end > i {
+		last := s[end-1]
+		if strings.IndexByte(".,;:!?'\"*_", last) >= 0 ||
+			(last == ')' && strings.Count(s[i:end], "(") < strings.Count(s[i:end], ")")) {
+			end--
+			continue
+		}
+		break
+	}
+	raw := s[i:end]
+	href, ok := safeURL(raw)
+	if !ok || !strings.Contains(raw, "://") || len(raw) <= len("https://") {
+		return 0, false
+	}
+	r.openLink(href)
+	r.write(raw)
+	r.html.WriteString("</a>")
+	return end, true
+}
+
+func (r *renderer) openLink(href string) {
+	r.html.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow noopener noreferrer" target="_blank">`)
+}
+
+func (r *renderer) lineBreak() {
+	r.html.WriteString("<br>\n")
+	r.text.WriteString("\n")
+}
+
+// write adds literal text, escaped.
+func (r *renderer) write(s string) {
+	r.html.WriteString(html.EscapeString(s))
+	r.text.WriteString(s)
+}
+
+// safeURL returns raw as a link target if it is an absolute http, https or
+// mailto URL.
+func safeURL(raw string) (string, bool) {
+	raw = strings.TrimSpace(raw)
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		if u.Host == "" {
+			return "", false
+		}
+	case "mailto":
+		if u.Opaque == "" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return u.String(), true
+}
+
+// closeRun returns the end of the code span opening at s[i], if it closes.
+func closeRun(s string, i int) (int, bool) {
+	n := runLength(s, i)
+	for j := i + n; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		m := runLength(s, j)
+		if m == n {
+			return j + m, true
+		}
+		j += m
+	}
+	return 0, false
+}
+
+func isTitle(s string) bool {
+	return len(s) >= 2 && (s[0] == '"' && s[len(s)-1] == '"' || s[0] == '\'' && s[len(s)-1] == '\'')
+}
+
+// runLength counts the repeats of the byte at s[i].
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+// isWordByte reports whether c is part of a word. Bytes of multi-byte
+// characters count, so underscores next to letters of any script are
+// treated as inside a word.
+func isWordByte(c byte) bool {
+	return c >= utf8.RuneSelf || c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
@@ -0,0 +1,88 @@
+package markdown
+
+import (
+	"regexp"
+	"testing"
+)
+
+const linkAttrs = `rel="nofollow noopener noreferrer" target="_blank"`
+
+func TestRenderEscapes(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"script tag", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"inline html", "a <img src=x onerror=alert(1)> b", "<p>a &lt;img src=x onerror=alert(1)&gt; b</p>"},
+		{"javascript link", "[click](javascript:alert(1))", "<p>click</p>"},
+		{"mixed case javascript link", "[click](JaVaScRiPt:alert(1))", "<p>click</p>"},
+		{"data link", "[click](data:text/html;base64,PHNjcmlwdD4=)", "<p>click</p>"},
+		{"vbscript link", "[x](vbscript:msgbox)", "<p>x</p>"},
+		{"javascript autolink", "<javascript:alert(1)>", "<p>&lt;javascript:alert(1)&gt;</p>"},
+		{"quote in link text", `[x" onmouseover="alert(1)](https://ex.com)`,
+			`<p><a href="https://ex.com" ` + linkAttrs + `>x&#34; onmouseover=&#34;alert(1)</a></p>`},
+		{"quote in link url", `[x](https://ex.com/"onmouseover="alert(1))`,
+			`<p><a href="https://ex.com/%22onmouseover=%22alert%281%29" ` + linkAttrs + `>x</a></p>`},
+		{"tag in link url", "[x](https://ex.com/<script>)",
+			`<p><a href="https://ex.com/%3Cscript%3E" ` + linkAttrs + `>x</a></p>`},
+		{"tag in link text", "[<b>x</b>](https://ex.com)",
+			`<p><a href="https://ex.com" ` + linkAttrs + `>&lt;b&gt;x&lt;/b&gt;</a></p>`},
+		{"quote after bare url", `https://ex.com/"><script>`,
+			`<p><a href="https://ex.com/" ` + linkAttrs + `>https://ex.com/</a>&#34;&gt;&lt;script&gt;</p>`},
+		{"ampersand in autolink", "<https://ex.com/a?b=1&c=2>",
+			`<p><a href="https://ex.com/a?b=1&amp;c=2" ` + linkAttrs + `>https://ex.com/a?b=1&amp;c=2</a></p>`},
+		{"mailto link", "[m](mailto:a@b.c)", `<p><a href="mailto:a@b.c" ` + linkAttrs + `>m</a></p>`},
+		{"entities", `&amp; &lt; "q" 's'`, "<p>&amp;amp; &amp;lt; &#34;q&#34; &#39;s&#39;</p>"},
+		{"nested emphasis", "**bold *and italic* text**", "<p><strong>bold <em>and italic</em> text</strong></p>"},
+		{"triple emphasis", "***both***", "<p><em><strong>both</strong></em></p>"},
+		{"strong inside em", "*a **b** c*", "<p><em>a <strong>b</strong> c</em></p>"},
+		{"intraword underscores", "snake_case_name", "<p>snake_case_name</p>"},
+		{"code span", "`<b>code</b>`", "<p><code>&lt;b&gt;code&lt;/b&gt;</code></p>"},
+		{"code span with backtick", "``a ` b``", "<p><code>a ` b</code></p>"},
+		{"code block", "```html\n<script>x</script>\n```",
+			`<pre><code class="language-html">&lt;script&gt;x&lt;/script&gt;</code></pre>`},
+		{"code block bad language", "```\" onload=\"x\n1\n```", "<pre><code>1</code></pre>"},
+		{"blockquote", "> quote <i>", "<blockquote><p>quote &lt;i&gt;</p>\n</blockquote>"},
+		{"ordered list start", "3) three", "<ol start=\"3\"><li>three\n</li></ol>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Render(tt.source).HTML; got != tt.want {
+				t.Errorf("Render(%q)\n got  %q\n want %q", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+// allowedTag matches every tag the renderer may emit, anchored at a '<'.
+var allowedTag = regexp.MustCompile(`^<(?:/?(?:p|em|strong|code|pre|blockquote|ul|li|ol|a)>|br>|code class="language-[^"<>&]+">|ol start="[0-9]+">|a href="(?i:https?://|mailto:)[^"<>]*" ` + linkAttrs + `>)`)
+
+func FuzzRender(f *testing.F) {
+	for _, seed := range []string{
+		"<script>alert(1)</script>",
+		"[x](JaVaScRiPt:alert(1))",
+		`[x" y="](https://ex.com/"z)`,
+		"**a *b* c** `<i>` ~~d~~",
+		"```go\n<x>\n```",
+		"> - [a](https://a.b)\n> 2. <https://c.d>",
+		"https://ex.com/\"><img>",
+	} {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, source string) {
+		html := Render(source).HTML
+		for i := 0; i < len(html); i++ {
+			if html[i] != '<' {
+				continue
+			}
+			if !allowedTag.MatchString(html[i:]) {
+				end := i + 40
+				if end > len(html) {
+					end = len(html)
+				}
+				t.Fatalf("Render(%q) emitted unexpected markup at %d: %q", source, i, html[i:end])
+			}
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"testing"
+)
+
+func TestBlurhash(t *testing.T) {
+	// The DC component is the image's average colour, four base 83 digits
+	// after the size flag and maximum
+	tests := []struct {
+		colour color.NRGBA
+		dc     string
+	}{
+		{color.NRGBA{255, 255, 255, 255}, "TSUA"},
+		{color.NRGBA{255, 0, 0, 255}, "TI:j"},
+		{color.NRGBA{0, 0, 0, 255}, "0000"},
+	}
+	for _, tt := range tests {
+		img := image.NewNRGBA(image.Rect(0, 0, 32, 24))
+		draw.Draw(img, img.Bounds(), image.NewUniform(tt.colour), image.Point{}, draw.Src)
+		hash := Blurhash(img, 4, 3)
+		if hash[0] != 'L' || hash[2:6] != tt.dc {
+			t.Errorf("Blurhash(%v) = %q, want size flag L and DC %q", tt.colour, hash, tt.dc)
+		}
+	}
+
+	// Black has no light to spread: every AC component encodes as zero
+	// ("fQ") under the smallest maximum ("0")
+	black := image.NewNRGBA(image.Rect(0, 0, 32, 24))
+	draw.Draw(black, black.Bounds(), image.NewUniform(color.NRGBA{A: 255}), image.Point{}, draw.Src)
+	if got, want := Blurhash(black, 4, 3), "L00000"+strings.Repeat("fQ", 11); got != want {
+		t.Errorf("Blurhash(black) = %q, want %q", got, want)
+	}
+}
+
+func TestBlurhashLength(t *testing.T) {
+	img := testImage(32, 32)
+	for x := 1; x <= 9; x++ {
+		for y := 1; y <= 9; y++ {
+			hash := Blurhash(img, x, y)
+			if want := 4 + 2*x*y; len(hash) != want {
+				t.Errorf("Blurhash with %dx%d components has length %d, want %d", x, y, len(hash), want)
+			}
+			if strings.Trim(hash, base83) != "" {
+				t.Errorf("Blurhash %q has characters outside base 83", hash)
+			}
+		}
+	}
+}
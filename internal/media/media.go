@@ -0,0 +1,162 @@
+// Package media prepares uploaded media for chat. Images have their metadata
+// stripped and get thumbnails and blurhash placeholders; voice notes are
+// validated and get their duration and waveform.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif" // register decoders for image.Decode
+	"image/jpeg"
+	"image/png"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// maxPixels bounds the images that are decoded, so a small file claiming
+// huge dimensions cannot exhaust memory.
+const maxPixels = 40_000_000
+
+// ThumbnailSizes are the longest-side sizes thumbnails are rendered at.
+// Only sizes smaller than the image itself are produced.
+var ThumbnailSizes = []int{160, 320, 640, 1280}
+
+var (
+	ErrUnsupported = errors.New("unsupported image format")
+	ErrTooLarge    = errors.New("image dimensions are too large")
+)
+
+// Image is an uploaded image ready to be stored.
+type Image struct {
+	Data       []byte // the image with its metadata removed
+	Width      int
+	Height     int
+	Blurhash   string
+	Thumbnails []Thumbnail
+}
+
+// Thumbnail is a downscaled copy of an image.
+type Thumbnail struct {
+	Data     []byte
+	MimeType string
+	Width    int
+	Height   int
+}
+
+// Process strips EXIF, GPS and other metadata from an image of the given
+// MIME type and renders its thumbnails. Images are only re-encoded when their
+// EXIF orientation has to be applied to the pixels, keeping an RGB colour
+// profile; otherwise metadata is cut out without touching the image data.
+func Process(data []byte, mimeType string) (*Image, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+	if "image/"+format != mimeType {
+		return nil, ErrUnsupported
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	var cleaned []byte
+	switch format {
+	case "jpeg":
+		if orientation := jpegOrientation(data); orientation > 1 {
+			img = orient(img, orientation)
+			var buf bytes.Buffer
+			if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+				return nil, err
+			}
+			// The profile goes straight after the encoder's SOI
+			encoded, icc := buf.Bytes(), jpegICC(data)
+			cleaned = make([]byte, 0, len(encoded)+len(icc))
+			cleaned = append(append(append(cleaned, encoded[:2]...), icc...), encoded[2:]...)
+		} else {
+			cleaned, err = stripJPEG(data)
+		}
+	case "png":
+		cleaned, err = stripPNG(data)
+	case "webp":
+		cleaned, err = stripWebP(data)
+	case "gif":
+		// GIF has no EXIF; comments are the only metadata and are harmless
+		cleaned = data
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	result := &Image{
+		Data:     cleaned,
+		Width:    bounds.Dx(),
+		Height:   bounds.Dy(),
+		Blurhash: Blurhash(scale(img, 32, xdraw.ApproxBiLinear), 4, 3),
+	}
+	for _, size := range ThumbnailSizes {
+		if size >= result.Width && size >= result.Height {
+			break
+		}
+		thumb, err := thumbnail(img, size)
+		if err != nil {
+			return nil, err
+		}
+		result.Thumbnails = append(result.Thumbnails, *thumb)
+	}
+	return result, nil
+}
+
+// thumbnail renders img with its longest side at size pixels. Opaque images
+// become JPEGs; ones with transparency stay PNGs to keep it.
+func thumbnail(img image.Image, size int) (*Thumbnail, error) {
+	small := scale(img, size, xdraw.CatmullRom)
+	bounds := small.Bounds()
+	thumb := &Thumbnail{Width: bounds.Dx(), Height: bounds.Dy()}
+
+	var buf bytes.Buffer
+	if opaque(img) {
+		thumb.MimeType = "image/jpeg"
+		if err := jpeg.Encode(&buf, small, &jpeg.Options{Quality: 80}); err != nil {
+			return nil, err
+		}
+	} else {
+		thumb.MimeType = "image/png"
+		if err := png.Encode(&buf, small); err != nil {
+			return nil, err
+		}
+	}
+	thumb.Data = buf.Bytes()
+	return thumb, nil
+}
+
+// scale resizes img so its longest side is size pixels, keeping its aspect
+// ratio.
+func scale(img image.Image, size int, scaler xdraw.Scaler) *image.NRGBA {
+	bounds := img.Bounds()
+	width, height := size, size
+	if bounds.Dx() > bounds.Dy() {
+		height = max(1, bounds.Dy()*size/bounds.Dx())
+	} else {
+		width = max(1, bounds.Dx()*size/bounds.Dy())
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	scaler.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
+
+func opaque(img image.Image) bool {
+	o, ok := img.(interface{ Opaque() bool })
+	return ok && o.Opaque()
+}
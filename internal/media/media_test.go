@@ -0,0 +1,56 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"testing"
+)
+
+func TestProcessAppliesOrientation(t *testing.T) {
+	data := testJPEG(t, testImage(300, 200), exifSegment(6), iccSegment("RGB "))
+
+	result, err := Process(data, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Width != 200 || result.Height != 300 {
+		t.Errorf("size %dx%d, want 200x300", result.Width, result.Height)
+	}
+	if bytes.Contains(result.Data, []byte("Exif")) || bytes.Contains(result.Data, gpsMarker) {
+		t.Error("re-encoded image still has its EXIF data")
+	}
+	if !bytes.Contains(result.Data, iccMarker) {
+		t.Error("re-encoded image lost its ICC profile")
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(result.Data))
+	if err != nil {
+		t.Fatalf("re-encoded image does not decode: %v", err)
+	}
+	if config.Width != 200 || config.Height != 300 {
+		t.Errorf("re-encoded image is %dx%d, want 200x300", config.Width, config.Height)
+	}
+	if len(result.Thumbnails) != 1 || result.Thumbnails[0].Width != 106 || result.Thumbnails[0].Height != 160 {
+		t.Errorf("got %d thumbnails, want one of 106x160", len(result.Thumbnails))
+	}
+}
+
+func TestProcessDropsNonRGBProfile(t *testing.T) {
+	data := testJPEG(t, testImage(40, 20), exifSegment(3), iccSegment("CMYK"))
+
+	result, err := Process(data, "image/jpeg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(result.Data, iccMarker) {
+		t.Error("re-encoded RGB image kept a CMYK profile")
+	}
+}
+
+func TestProcessRejectsMismatchedType(t *testing.T) {
+	data := testPNG(t, testImage(4, 4))
+	if _, err := Process(data, "image/jpeg"); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("Process(png as jpeg) = %v, want ErrUnsupported", err)
+	}
+}
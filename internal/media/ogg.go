@@ -0,0 +1,87 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+const opusSampleRate = 48000
+
+// parseOgg reads an Ogg file holding a single Opus stream. The duration
+// comes from the granule position of the last page, which counts 48 kHz
+// samples including the pre-skip announced in the OpusHead header.
+func parseOgg(data []byte) (*audioStream, error) {
+	var (
+		packets   []int
+		partial   int
+		serial    uint32
+		granule   int64 = -1
+		preSkip   int64
+		firstPage = true
+	)
+
+	pos := 0
+	for pos < len(data) {
+		if len(data)-pos < 27 || string(data[pos:pos+4]) != "OggS" {
+			return nil, errMalformed
+		}
+		pageGranule := int64(binary.LittleEndian.Uint64(data[pos+6:]))
+		pageSerial := binary.LittleEndian.Uint32(data[pos+14:])
+		segments := int(data[pos+26])
+		body := pos + 27 + segments
+		if body > len(data) {
+			return nil, errMalformed
+		}
+		lacing := data[pos+27 : body]
+
+		if firstPage {
+			serial = pageSerial
+		} else if pageSerial != serial {
+			// Only a single audio stream is accepted
+			return nil, errMalformed
+		}
+
+		end := body
+		for _, l := range lacing {
+			end += int(l)
+		}
+		if end > len(data) {
+			return nil, errMalformed
+		}
+
+		offset := body
+		for _, l := range lacing {
+			partial += int(l)
+			if l < 255 {
+				if len(packets) == 0 {
+					start := offset + int(l) - partial
+					head := data[start : start+partial]
+					if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+						return nil, errMalformed
+					}
+					preSkip = int64(binary.LittleEndian.Uint16(head[10:]))
+				}
+				packets = append(packets, partial)
+				partial = 0
+			}
+			offset += int(l)
+		}
+
+		if pageGranule != -1 {
+			granule = pageGranule
+		}
+		firstPage = false
+		pos = end
+	}
+
+	// The first two packets are the OpusHead and OpusTags headers
+	if len(packets) < 3 || granule <= preSkip {
+		return nil, errMalformed
+	}
+	samples := granule - preSkip
+	return &audioStream{
+		duration: time.Duration(samples) * time.Second / opusSampleRate,
+		packets:  packets[2:],
+	}, nil
+}
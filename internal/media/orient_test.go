@@ -0,0 +1,68 @@
+package media
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestOrient(t *testing.T) {
+	// Stored as
+	//   a b c
+	//   d e f
+	// and shown as the rows below for each orientation
+	tests := []struct {
+		orientation int
+		want        []string
+	}{
+		{1, []string{"abc", "def"}},
+		{2, []string{"cba", "fed"}},
+		{3, []string{"fed", "cba"}},
+		{4, []string{"def", "abc"}},
+		{5, []string{"ad", "be", "cf"}},
+		{6, []string{"da", "eb", "fc"}},
+		{7, []string{"fc", "eb", "da"}},
+		{8, []string{"cf", "be", "ad"}},
+	}
+
+	src := image.NewNRGBA(image.Rect(0, 0, 3, 2))
+	for i, label := range "abcdef" {
+		src.Set(i%3, i/3, color.NRGBA{R: uint8(label), A: 255})
+	}
+	for _, tt := range tests {
+		img := orient(src, tt.orientation)
+		bounds := img.Bounds()
+		if bounds.Dx() != len(tt.want[0]) || bounds.Dy() != len(tt.want) {
+			t.Errorf("orientation %d: size %dx%d, want %dx%d", tt.orientation, bounds.Dx(), bounds.Dy(), len(tt.want[0]), len(tt.want))
+			continue
+		}
+
+		var got []string
+		for y := 0; y < bounds.Dy(); y++ {
+			row := make([]byte, bounds.Dx())
+			for x := range row {
+				row[x] = color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA).R
+			}
+			got = append(got, string(row))
+		}
+		for y := range got {
+			if got[y] != tt.want[y] {
+				t.Errorf("orientation %d: rows %q, want %q", tt.orientation, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestJPEGOrientation(t *testing.T) {
+	img := testImage(4, 4)
+	for orientation := 0; orientation <= 8; orientation++ {
+		data := testJPEG(t, img, xmpSegment(), exifSegment(orientation))
+		if got := jpegOrientation(data); got != orientation {
+			t.Errorf("jpegOrientation = %d, want %d", got, orientation)
+		}
+	}
+	if got := jpegOrientation(testJPEG(t, img, exifSegment(9))); got != 0 {
+		t.Errorf("jpegOrientation with an invalid tag = %d, want 0", got)
+	}
+}
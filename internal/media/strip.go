@@ -0,0 +1,239 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+var errMalformed = errors.New("malformed image")
+
+// JPEG markers whose segments are kept: JFIF, the ICC colour profile and
+// Adobe's colour transform flag. Every other APPn segment (EXIF, XMP, IPTC
+// and vendor data) and comments are dropped.
+const (
+	markerSOI   = 0xD8
+	markerSOS   = 0xDA
+	markerAPP0  = 0xE0
+	markerAPP2  = 0xE2
+	markerAPP14 = 0xEE
+	markerAPP15 = 0xEF
+	markerCOM   = 0xFE
+)
+
+// stripJPEG removes metadata segments from a JPEG, leaving the entropy-coded
+// image data as it was.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil, errMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	pos := 2
+	for {
+		if pos+4 > len(data) || data[pos] != 0xFF {
+			return nil, errMalformed
+		}
+		marker := data[pos+1]
+		if marker == 0xFF {
+			// fill byte
+			pos++
+			continue
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, errMalformed
+		}
+
+		if marker == markerSOS {
+			// The scan and everything after it is image data
+			out.Write(data[pos:])
+			return out.Bytes(), nil
+		}
+
+		metadata := marker == markerCOM ||
+			(marker >= markerAPP0 && marker <= markerAPP15 &&
+				marker != markerAPP0 && marker != markerAPP2 && marker != markerAPP14)
+		if !metadata {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+}
+
+// jpegOrientation returns the EXIF orientation (1-8) of a JPEG, or 0 if it
+// has none.
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+		return 0
+	}
+
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if marker == markerSOS || length < 2 || end > len(data) {
+			return 0
+		}
+		segment := data[pos+4 : end]
+		if marker == markerAPP0+1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return exifOrientation(segment[6:])
+		}
+		pos = end
+	}
+	return 0
+}
+
+// jpegICC returns the APP2 segments carrying a JPEG's ICC profile, or nil if
+// it has none. Only RGB profiles are returned: jpeg.Encode writes RGB images,
+// which a CMYK or grey profile would misdescribe.
+func jpegICC(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != markerSOI {
+		return nil
+	}
+
+	var icc []byte
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		end := pos + 2 + length
+		if marker == markerSOS || length < 2 || end > len(data) {
+			break
+		}
+		if segment := data[pos+4 : end]; marker == markerAPP2 && bytes.HasPrefix(segment, []byte("ICC_PROFILE\x00")) {
+			icc = append(icc, data[pos:end]...)
+		}
+		pos = end
+	}
+
+	// The first chunk holds the profile header: a 12-byte tag and two
+	// chunk numbers, then the colour space at offset 16 of the profile
+	const colourSpace = 4 + 14 + 16
+	if len(icc) < colourSpace+4 || string(icc[colourSpace:colourSpace+4]) != "RGB " {
+		return nil
+	}
+	return icc
+}
+
+// exifOrientation reads the orientation tag from the first IFD of a TIFF
+// structure.
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd+2 > len(tiff) {
+		return 0
+	}
+	entries := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			orientation := int(order.Uint16(tiff[entry+8:]))
+			if orientation < 1 || orientation > 8 {
+				return 0
+			}
+			return orientation
+		}
+	}
+	return 0
+}
+
+// PNG chunks that are kept: the ones needed to render the image, colour
+// information and APNG animation. Text chunks and eXIf are dropped.
+var pngChunks = map[string]bool{
+	"IHDR": true, "PLTE": true, "IDAT": true, "IEND": true,
+	"tRNS": true, "gAMA": true, "cHRM": true, "sRGB": true, "iCCP": true, "sBIT": true,
+	"acTL": true, "fcTL": true, "fdAT": true,
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// stripPNG removes metadata chunks from a PNG.
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, errMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+	pos := len(pngSignature)
+	for pos < len(data) {
+		if pos+12 > len(data) {
+			return nil, errMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		end := pos + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+		if pngChunks[string(data[pos+4:pos+8])] {
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+	return out.Bytes(), nil
+}
+
+// VP8X feature flags announcing metadata chunks.
+const (
+	webpFlagEXIF = 0x08
+	webpFlagXMP  = 0x04
+)
+
+// stripWebP removes the EXIF and XMP chunks from a WebP and clears the flags
+// announcing them.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errMalformed
+	}
+
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:12])
+	pos := 12
+	for pos < len(data) {
+		if pos+8 > len(data) {
+			return nil, errMalformed
+		}
+		fourCC := string(data[pos : pos+4])
+		length := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := pos + 8 + length + length%2
+		if length < 0 || end > len(data) {
+			return nil, errMalformed
+		}
+
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[pos:end]...)
+			if length > 0 {
+				chunk[8] &^= webpFlagEXIF | webpFlagXMP
+			}
+			out.Write(chunk)
+		default:
+			out.Write(data[pos:end])
+		}
+		pos = end
+	}
+
+	cleaned := out.Bytes()
+	binary.LittleEndian.PutUint32(cleaned[4:], uint32(len(cleaned)-8))
+	return cleaned, nil
+}
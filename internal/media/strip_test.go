@@ -0,0 +1,329 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// Metadata the fixtures carry. Each marker appears only in its own segment
+// or chunk, so finding it in stripped output means the segment survived.
+var (
+	gpsMarker = []byte("GPSLatitude:51.5007N")
+	xmpMarker = []byte("<x:xmpmeta>")
+	iccMarker = []byte("tap-me test profile")
+)
+
+func testImage(w, h int) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x * 40), G: uint8(y * 40), B: 200, A: 255})
+		}
+	}
+	return img
+}
+
+// exifTIFF builds a big-endian TIFF structure whose first IFD holds an
+// orientation tag, or none if orientation is 0, followed by GPS data.
+func exifTIFF(orientation int) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	if orientation == 0 {
+		tiff = append(tiff, 0, 0)
+	} else {
+		tiff = append(tiff, 0, 1)
+		tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+		tiff = binary.BigEndian.AppendUint16(tiff, 3) // SHORT
+		tiff = binary.BigEndian.AppendUint32(tiff, 1)
+		tiff = binary.BigEndian.AppendUint16(tiff, uint16(orientation))
+		tiff = append(tiff, 0, 0)
+	}
+	tiff = append(tiff, 0, 0, 0, 0) // no next IFD
+	return append(tiff, gpsMarker...)
+}
+
+// iccProfile builds a profile header with the given colour space. Only the
+// header matters here; decoders do not apply the profile.
+func iccProfile(colourSpace string) []byte {
+	profile := make([]byte, 128)
+	copy(profile[16:], colourSpace)
+	copy(profile[36:], "acsp")
+	return append(profile, iccMarker...)
+}
+
+func jpegSegment(marker byte, payload []byte) []byte {
+	segment := []byte{0xFF, marker}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG encodes img and inserts segments after its SOI marker.
+func testJPEG(t testing.TB, img image.Image, segments ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	data := append([]byte(nil), encoded[:2]...)
+	for _, segment := range segments {
+		data = append(data, segment...)
+	}
+	return append(data, encoded[2:]...)
+}
+
+func exifSegment(orientation int) []byte {
+	return jpegSegment(markerAPP0+1, append([]byte("Exif\x00\x00"), exifTIFF(orientation)...))
+}
+
+func xmpSegment() []byte {
+	return jpegSegment(markerAPP0+1, append([]byte("http://ns.adobe.com/xap/1.0/\x00"), xmpMarker...))
+}
+
+func iccSegment(colourSpace string) []byte {
+	return jpegSegment(markerAPP2, append([]byte("ICC_PROFILE\x00\x01\x01"), iccProfile(colourSpace)...))
+}
+
+func pngChunk(kind string, payload []byte) []byte {
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	chunk = append(chunk, kind...)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// testPNG encodes img and inserts chunks after its IHDR chunk.
+func testPNG(t testing.TB, img image.Image, chunks ...[]byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	encoded := buf.Bytes()
+	ihdrEnd := len(pngSignature) + 12 + 13
+	data := append([]byte(nil), encoded[:ihdrEnd]...)
+	for _, chunk := range chunks {
+		data = append(data, chunk...)
+	}
+	return append(data, encoded[ihdrEnd:]...)
+}
+
+// webpLossless is a 1x1 lossless VP8L bitstream.
+var webpLossless = []byte("\x2f\x00\x00\x00\x10\x07\x10\x11\x11\x88\x88\xfe\x07\x00")
+
+func webpChunk(fourCC string, payload []byte) []byte {
+	chunk := append([]byte(fourCC), binary.LittleEndian.AppendUint32(nil, uint32(len(payload)))...)
+	chunk = append(chunk, payload...)
+	if len(payload)%2 == 1 {
+		chunk = append(chunk, 0)
+	}
+	return chunk
+}
+
+// testWebP builds an extended 1x1 WebP holding the given chunks around its
+// image data, with the VP8X flags announcing them.
+func testWebP(flags byte, before, after [][]byte) []byte {
+	vp8x := webpChunk("VP8X", []byte{flags, 0, 0, 0, 0, 0, 0, 0, 0, 0})
+	body := append([]byte("WEBP"), vp8x...)
+	for _, chunk := range before {
+		body = append(body, chunk...)
+	}
+	body = append(body, webpChunk("VP8L", webpLossless)...)
+	for _, chunk := range after {
+		body = append(body, chunk...)
+	}
+	return append(append([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...), body...)
+}
+
+// Flags of the extended WebP header besides the metadata ones.
+const webpFlagICC = 0x20
+
+func TestStrip(t *testing.T) {
+	img := testImage(8, 6)
+	tests := []struct {
+		name    string
+		strip   func([]byte) ([]byte, error)
+		data    []byte
+		keepICC bool
+	}{
+		{
+			name:    "jpeg",
+			strip:   stripJPEG,
+			data:    testJPEG(t, img, jpegSegment(markerAPP0, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")), exifSegment(1), xmpSegment(), iccSegment("RGB "), jpegSegment(markerCOM, gpsMarker)),
+			keepICC: true,
+		},
+		{
+			name:  "jpeg with fill bytes",
+			strip: stripJPEG,
+			data:  testJPEG(t, img, []byte{0xFF, 0xFF}, exifSegment(1), []byte{0xFF}, xmpSegment()),
+		},
+		{
+			name:  "png",
+			strip: stripPNG,
+			data: testPNG(t, img,
+				pngChunk("iCCP", append([]byte("icc\x00\x00"), iccMarker...)),
+				pngChunk("eXIf", exifTIFF(1)),
+				pngChunk("tEXt", append([]byte("Comment\x00"), gpsMarker...)),
+				pngChunk("iTXt", append([]byte("XML:com.adobe.xmp\x00\x00\x00\x00\x00"), xmpMarker...)),
+			),
+			keepICC: true,
+		},
+		{
+			name:  "webp",
+			strip: stripWebP,
+			data: testWebP(webpFlagICC|webpFlagEXIF|webpFlagXMP,
+				[][]byte{webpChunk("ICCP", iccProfile("RGB "))},
+				[][]byte{webpChunk("EXIF", exifTIFF(1)), webpChunk("XMP ", append([]byte{' '}, xmpMarker...))},
+			),
+			keepICC: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := image.Decode(bytes.NewReader(tt.data)); err != nil {
+				t.Fatalf("fixture does not decode: %v", err)
+			}
+
+			cleaned, err := tt.strip(tt.data)
+			if err != nil {
+				t.Fatalf("strip: %v", err)
+			}
+			for _, marker := range [][]byte{gpsMarker, xmpMarker, []byte("Exif"), []byte("eXIf")} {
+				if bytes.Contains(cleaned, marker) {
+					t.Errorf("stripped image still contains %q", marker)
+				}
+			}
+			if tt.keepICC && !bytes.Contains(cleaned, iccMarker) {
+				t.Error("stripped image lost its ICC profile")
+			}
+
+			decoded, _, err := image.Decode(bytes.NewReader(cleaned))
+			if err != nil {
+				t.Fatalf("stripped image does not decode: %v", err)
+			}
+			original, _, _ := image.Decode(bytes.NewReader(tt.data))
+			if decoded.Bounds() != original.Bounds() {
+				t.Errorf("stripped image is %v, want %v", decoded.Bounds(), original.Bounds())
+			}
+		})
+	}
+}
+
+func TestStripWebPHeader(t *testing.T) {
+	data := testWebP(webpFlagICC|webpFlagEXIF|webpFlagXMP,
+		[][]byte{webpChunk("ICCP", iccProfile("RGB "))},
+		[][]byte{webpChunk("EXIF", exifTIFF(1))},
+	)
+	cleaned, err := stripWebP(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := binary.LittleEndian.Uint32(cleaned[4:]); int(size) != len(cleaned)-8 {
+		t.Errorf("RIFF size = %d, want %d", size, len(cleaned)-8)
+	}
+	if flags := cleaned[20]; flags != webpFlagICC {
+		t.Errorf("VP8X flags = %#x, want only ICC (%#x)", flags, webpFlagICC)
+	}
+}
+
+func TestStripMalformed(t *testing.T) {
+	jpg := testJPEG(t, testImage(4, 4), exifSegment(1))
+	pngData := testPNG(t, testImage(4, 4))
+	webp := testWebP(0, nil, nil)
+	tests := []struct {
+		name  string
+		strip func([]byte) ([]byte, error)
+		data  []byte
+	}{
+		{"jpeg without SOI", stripJPEG, jpg[2:]},
+		{"jpeg cut in a segment", stripJPEG, jpg[:10]},
+		{"jpeg cut before the scan", stripJPEG, jpg[:2+len(exifSegment(1))]},
+		{"png without signature", stripPNG, pngData[1:]},
+		{"png cut in a chunk", stripPNG, pngData[:len(pngData)-3]},
+		{"webp without header", stripWebP, webp[:11]},
+		{"webp cut in a chunk", stripWebP, webp[:len(webp)-3]},
+	}
+	for _, tt := range tests {
+		if _, err := tt.strip(tt.data); !errors.Is(err, errMalformed) {
+			t.Errorf("%s: err = %v, want errMalformed", tt.name, err)
+		}
+	}
+}
+
+func TestJPEGICC(t *testing.T) {
+	img := testImage(4, 4)
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"rgb", testJPEG(t, img, exifSegment(6), iccSegment("RGB ")), true},
+		{"cmyk", testJPEG(t, img, iccSegment("CMYK")), false},
+		{"none", testJPEG(t, img, exifSegment(6)), false},
+		{"other app2", testJPEG(t, img, jpegSegment(markerAPP2, []byte("MPF\x00"))), false},
+	}
+	for _, tt := range tests {
+		icc := jpegICC(tt.data)
+		if got := bytes.Contains(icc, iccMarker); got != tt.want {
+			t.Errorf("%s: jpegICC kept the profile = %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.want && !bytes.Equal(icc, iccSegment("RGB ")) {
+			t.Errorf("%s: jpegICC = %q, want the whole APP2 segment", tt.name, icc)
+		}
+	}
+}
+
+func FuzzStripJPEG(f *testing.F) {
+	f.Add(testJPEG(f, testImage(4, 4), exifSegment(6), xmpSegment(), iccSegment("RGB ")))
+	f.Add(testJPEG(f, testImage(2, 2), []byte{0xFF}, jpegSegment(markerCOM, nil)))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		jpegOrientation(data)
+		jpegICC(data)
+		cleaned, err := stripJPEG(data)
+		if err != nil {
+			return
+		}
+		again, err := stripJPEG(cleaned)
+		if err != nil || !bytes.Equal(again, cleaned) {
+			t.Fatalf("stripping %q twice gave %q, %v", cleaned, again, err)
+		}
+	})
+}
+
+func FuzzStripPNG(f *testing.F) {
+	f.Add(testPNG(f, testImage(4, 4), pngChunk("eXIf", exifTIFF(1)), pngChunk("iCCP", iccMarker)))
+	f.Add(pngSignature)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cleaned, err := stripPNG(data)
+		if err != nil {
+			return
+		}
+		again, err := stripPNG(cleaned)
+		if err != nil || !bytes.Equal(again, cleaned) {
+			t.Fatalf("stripping %q twice gave %q, %v", cleaned, again, err)
+		}
+	})
+}
+
+func FuzzStripWebP(f *testing.F) {
+	f.Add(testWebP(webpFlagEXIF|webpFlagXMP, nil, [][]byte{webpChunk("EXIF", exifTIFF(1)), webpChunk("XMP ", xmpMarker)}))
+	f.Add(append([]byte("RIFF\x04\x00\x00\x00WEBP"), webpChunk("VP8X", nil)...))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		cleaned, err := stripWebP(data)
+		if err != nil {
+			return
+		}
+		if size := binary.LittleEndian.Uint32(cleaned[4:]); int(size) != len(cleaned)-8 {
+			t.Fatalf("RIFF size = %d, want %d", size, len(cleaned)-8)
+		}
+		again, err := stripWebP(cleaned)
+		if err != nil || !bytes.Equal(again, cleaned) {
+			t.Fatalf("stripping %q twice gave %q, %v", cleaned, again, err)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"time"
+)
+
+// WaveformLength is the number of samples in a voice note's waveform.
+const WaveformLength = 64
+
+var ErrInvalidAudio = errors.New("voice notes must be Ogg/Opus or WebM audio")
+
+// Audio describes a voice note.
+type Audio struct {
+	MimeType string
+	Duration time.Duration
+	// Waveform holds WaveformLength values from 0 to 100. It is derived
+	// from the sizes of the compressed audio packets, which grow with
+	// loudness and detail, so it needs no audio decoder; constant bitrate
+	// recordings come out flat.
+	Waveform []int
+}
+
+// ProbeVoice checks that data is an Ogg/Opus or WebM audio-only recording
+// and reads its duration and waveform from the container.
+func ProbeVoice(data []byte) (*Audio, error) {
+	var (
+		stream *audioStream
+		err    error
+		mime   string
+	)
+	switch {
+	case bytes.HasPrefix(data, []byte("OggS")):
+		stream, err = parseOgg(data)
+		mime = "audio/ogg"
+	case bytes.HasPrefix(data, []byte("\x1A\x45\xDF\xA3")):
+		stream, err = parseWebM(data)
+		mime = "audio/webm"
+	default:
+		return nil, ErrInvalidAudio
+	}
+	if err != nil || stream.duration <= 0 || len(stream.packets) == 0 {
+		return nil, ErrInvalidAudio
+	}
+
+	return &Audio{
+		MimeType: mime,
+		Duration: stream.duration,
+		Waveform: waveform(stream.packets, WaveformLength),
+	}, nil
+}
+
+// audioStream is what the container parsers extract: the stream's length
+// and the size of each compressed audio packet in order.
+type audioStream struct {
+	duration time.Duration
+	packets  []int
+}
+
+// waveform averages the packet sizes into n buckets and scales them to
+// 0-100 between the quietest and loudest bucket.
+func waveform(packets []int, n int) []int {
+	sums := make([]float64, n)
+	counts := make([]int, n)
+	for i, size := range packets {
+		bucket := i * n / len(packets)
+		sums[bucket] += float64(size)
+		counts[bucket]++
+	}
+
+	// Short notes have fewer packets than buckets; repeat the last value
+	levels := make([]float64, n)
+	low, high := math.Inf(1), math.Inf(-1)
+	for i := range levels {
+		if counts[i] > 0 {
+			levels[i] = sums[i] / float64(counts[i])
+		} else if i > 0 {
+			levels[i] = levels[i-1]
+		}
+		low = math.Min(low, levels[i])
+		high = math.Max(high, levels[i])
+	}
+
+	out := make([]int, n)
+	if high > low {
+		for i, level := range levels {
+			out[i] = int(math.Round(100 * (level - low) / (high - low)))
+		}
+	}
+	return out
+}
@@ -0,0 +1,321 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+// oggCRC is the Ogg page checksum: CRC-32 with polynomial 0x04C11DB7, fed
+// most significant bit first.
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for _, b := range page {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04C11DB7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// oggStream muxes packets into pages of at most maxSegments lacing values,
+// letting packets run on into the next page as an encoder would. granules[i]
+// is the granule position once packet i is complete.
+func oggStream(serial uint32, packets [][]byte, granules []int64, maxSegments int) []byte {
+	type segment struct {
+		data   []byte
+		packet int
+		last   bool
+	}
+	var segments []segment
+	for i, packet := range packets {
+		for len(packet) >= 255 {
+			segments = append(segments, segment{packet[:255], i, false})
+			packet = packet[255:]
+		}
+		segments = append(segments, segment{packet, i, true})
+	}
+
+	var out []byte
+	continued := false
+	for seq := uint32(0); len(segments) > 0; seq++ {
+		n := min(maxSegments, len(segments))
+		onPage := segments[:n]
+		segments = segments[n:]
+
+		var flags byte
+		if continued {
+			flags |= 0x01
+		}
+		if seq == 0 {
+			flags |= 0x02
+		}
+		if len(segments) == 0 {
+			flags |= 0x04
+		}
+		granule := int64(-1)
+		var lacing, body []byte
+		for _, s := range onPage {
+			lacing = append(lacing, byte(len(s.data)))
+			body = append(body, s.data...)
+			if s.last {
+				granule = granules[s.packet]
+			}
+		}
+		continued = !onPage[n-1].last
+
+		header := append([]byte("OggS"), 0, flags)
+		header = binary.LittleEndian.AppendUint64(header, uint64(granule))
+		header = binary.LittleEndian.AppendUint32(header, serial)
+		header = binary.LittleEndian.AppendUint32(header, seq)
+		header = append(header, 0, 0, 0, 0, byte(n))
+		page := append(append(header, lacing...), body...)
+		binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+		out = append(out, page...)
+	}
+	return out
+}
+
+// Opus fixture timing: 50 packets of 20 ms after a 312 sample pre-skip.
+const (
+	testPreSkip = 312
+	testFrames  = 50
+	testFrame   = 960
+)
+
+// testPackets returns compressed audio packets whose sizes rise and fall,
+// including one too long for a single lacing value.
+func testPackets() [][]byte {
+	packets := make([][]byte, testFrames)
+	for i := range packets {
+		size := 20 + i%10*10
+		if i == 25 {
+			size = 600
+		}
+		packets[i] = make([]byte, size)
+		for j := range packets[i] {
+			packets[i][j] = byte(i + j)
+		}
+	}
+	return packets
+}
+
+// testOpus builds a mono Ogg/Opus recording of the given 20 ms packets.
+func testOpus(serial uint32, audio [][]byte) []byte {
+	head := []byte("OpusHead\x01\x01")
+	head = binary.LittleEndian.AppendUint16(head, testPreSkip)
+	head = binary.LittleEndian.AppendUint32(head, opusSampleRate)
+	head = append(head, 0, 0, 0)
+	tags := append([]byte("OpusTags\x04\x00\x00\x00test"), 0, 0, 0, 0)
+
+	packets := append([][]byte{head, tags}, audio...)
+	granules := make([]int64, len(packets))
+	for i := 2; i < len(packets); i++ {
+		granules[i] = testPreSkip + int64(i-1)*testFrame
+	}
+	return oggStream(serial, packets, granules, 16)
+}
+
+// ebml encodes an element with an eight-byte size, or an unknown size if
+// payload is nil.
+func ebml(id uint64, payload []byte) []byte {
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	if payload == nil {
+		return append(out, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	}
+	size := binary.BigEndian.AppendUint64(nil, uint64(len(payload)))
+	size[0] = 0x01
+	return append(append(out, size...), payload...)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+func webmTrack(trackType byte, codec string) []byte {
+	return ebml(ebmlTrackEntry, concat(
+		ebml(0xD7, []byte{1}), // TrackNumber
+		ebml(ebmlTrackType, []byte{trackType}),
+		ebml(ebmlCodecID, []byte(codec)),
+	))
+}
+
+// testWebM builds a WebM recording the way a browser streams it: the
+// segment and clusters have unknown sizes and info carries no duration.
+// Its blocks are 20 ms apart in two clusters, the last at 980 ms.
+func testWebM(info []byte, tracks ...[]byte) []byte {
+	out := concat(
+		ebml(ebmlHeader, ebml(ebmlDocType, []byte("webm"))),
+		ebml(ebmlSegment, nil),
+		ebml(ebmlInfo, concat(ebml(ebmlTimecodeScale, []byte{0x0F, 0x42, 0x40}), info)),
+		ebml(ebmlTracks, concat(tracks...)),
+	)
+	for i, packet := range testPackets() {
+		if i%25 == 0 {
+			out = append(out, ebml(ebmlCluster, nil)...)
+			out = append(out, ebml(ebmlClusterTime, binary.BigEndian.AppendUint16(nil, uint16(i*20)))...)
+		}
+		block := []byte{0x81}
+		block = binary.BigEndian.AppendUint16(block, uint16(i%25*20))
+		block = append(block, 0x80)
+		out = append(out, ebml(ebmlSimpleBlock, append(block, packet...))...)
+	}
+	return out
+}
+
+func TestProbeVoice(t *testing.T) {
+	opus := webmTrack(ebmlTrackAudio, "A_OPUS")
+	tests := []struct {
+		name     string
+		data     []byte
+		mimeType string
+		duration time.Duration
+	}{
+		{"ogg", testOpus(1, testPackets()), "audio/ogg", time.Second},
+		{"webm without duration", testWebM(nil, opus), "audio/webm", 980 * time.Millisecond},
+		{
+			name:     "webm with duration",
+			data:     testWebM(ebml(ebmlDuration, binary.BigEndian.AppendUint64(nil, math.Float64bits(1000))), opus),
+			mimeType: "audio/webm",
+			duration: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			audio, err := ProbeVoice(tt.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if audio.MimeType != tt.mimeType {
+				t.Errorf("MimeType = %q, want %q", audio.MimeType, tt.mimeType)
+			}
+			if audio.Duration != tt.duration {
+				t.Errorf("Duration = %v, want %v", audio.Duration, tt.duration)
+			}
+			if len(audio.Waveform) != WaveformLength {
+				t.Fatalf("waveform has %d values, want %d", len(audio.Waveform), WaveformLength)
+			}
+			// The 600 byte packet is the loudest bucket; the smallest
+			// packets make the quietest
+			low, high := 100, 0
+			for _, level := range audio.Waveform {
+				low, high = min(low, level), max(high, level)
+			}
+			if low != 0 || high != 100 {
+				t.Errorf("waveform ranges from %d to %d, want 0 to 100", low, high)
+			}
+		})
+	}
+}
+
+func TestProbeVoiceRejects(t *testing.T) {
+	ogg := testOpus(1, testPackets())
+	opus := webmTrack(ebmlTrackAudio, "A_OPUS")
+	webm := testWebM(nil, opus)
+	theora := oggStream(1, [][]byte{[]byte("\x80theora\x03\x02\x01"), {0}}, []int64{0, 0}, 255)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"not audio", []byte("RIFF\x00\x00\x00\x00WAVE")},
+		{"ogg video", theora},
+		{"ogg with a second stream", concat(ogg, testOpus(2, testPackets()))},
+		{"ogg with only headers", testOpus(1, nil)},
+		{"ogg cut in a page", ogg[:len(ogg)-10]},
+		{"ogg cut in a page header", ogg[:oggPageEnd(ogg, 2)+20]},
+		{"webm video", testWebM(nil, webmTrack(1, "V_VP8"))},
+		{"webm video codec", testWebM(nil, webmTrack(ebmlTrackAudio, "V_VP9"))},
+		{"webm with two tracks", testWebM(nil, opus, opus)},
+		{"webm without tracks", testWebM(nil)},
+		{"webm cut in a block", webm[:len(webm)-10]},
+		{"webm cut in a size", webm[:len(webm)-len(testPackets()[49])-6]},
+		{"other doc type", bytes.Replace(webm, []byte("webm"), []byte("mkv2"), 1)},
+	}
+	for _, tt := range tests {
+		if audio, err := ProbeVoice(tt.data); !errors.Is(err, ErrInvalidAudio) {
+			t.Errorf("%s: ProbeVoice = %+v, %v, want ErrInvalidAudio", tt.name, audio, err)
+		}
+	}
+}
+
+// oggPageEnd returns the offset just past the first n pages of an Ogg
+// stream.
+func oggPageEnd(data []byte, n int) int {
+	pos := 0
+	for ; n > 0; n-- {
+		segments := int(data[pos+26])
+		end := pos + 27 + segments
+		for _, l := range data[pos+27 : pos+27+segments] {
+			end += int(l)
+		}
+		pos = end
+	}
+	return pos
+}
+
+func TestReadVint(t *testing.T) {
+	tests := []struct {
+		in      []byte
+		value   uint64
+		length  int
+		unknown bool
+	}{
+		{[]byte{0x81}, 1, 1, false},
+		{[]byte{0x81, 0xFF}, 1, 1, false},
+		{[]byte{0x40, 0x02}, 2, 2, false},
+		{[]byte{0x20, 0x01, 0x00}, 256, 3, false},
+		{[]byte{0xFF}, 127, 1, true},
+		{[]byte{0x7F, 0xFF}, 1<<14 - 1, 2, true},
+		{[]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, 1<<56 - 1, 8, true},
+		{[]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}, 1<<56 - 2, 8, false},
+		{[]byte{0x00, 0x81}, 0, 0, false},
+		{[]byte{0x40}, 0, 0, false},
+		{nil, 0, 0, false},
+	}
+	for _, tt := range tests {
+		value, length, unknown := readVint(tt.in)
+		if value != tt.value || length != tt.length || unknown != tt.unknown {
+			t.Errorf("readVint(% x) = %d, %d, %v, want %d, %d, %v", tt.in, value, length, unknown, tt.value, tt.length, tt.unknown)
+		}
+	}
+}
+
+func FuzzProbeVoice(f *testing.F) {
+	f.Add(testOpus(1, testPackets()))
+	f.Add(testWebM(nil, webmTrack(ebmlTrackAudio, "A_OPUS")))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		audio, err := ProbeVoice(data)
+		if err != nil {
+			return
+		}
+		if audio.Duration <= 0 {
+			t.Fatalf("Duration = %v", audio.Duration)
+		}
+		if len(audio.Waveform) != WaveformLength {
+			t.Fatalf("waveform has %d values, want %d", len(audio.Waveform), WaveformLength)
+		}
+		for _, level := range audio.Waveform {
+			if level < 0 || level > 100 {
+				t.Fatalf("waveform level %d outside 0-100", level)
+			}
+		}
+	})
+}
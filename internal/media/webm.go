@@ -0,0 +1,176 @@
+package media
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// EBML element IDs read from WebM files.
+const (
+	ebmlHeader        = 0x1A45DFA3
+	ebmlDocType       = 0x4282
+	ebmlSegment       = 0x18538067
+	ebmlInfo          = 0x1549A966
+	ebmlTimecodeScale = 0x2AD7B1
+	ebmlDuration      = 0x4489
+	ebmlTracks        = 0x1654AE6B
+	ebmlTrackEntry    = 0xAE
+	ebmlTrackType     = 0x83
+	ebmlCodecID       = 0x86
+	ebmlCluster       = 0x1F43B675
+	ebmlClusterTime   = 0xE7
+	ebmlBlockGroup    = 0xA0
+	ebmlBlock         = 0xA1
+	ebmlSimpleBlock   = 0xA3
+
+	ebmlTrackAudio = 2
+)
+
+// masterElements are the containers parseWebM descends into; every other
+// element is skipped whole.
+var masterElements = map[uint64]bool{
+	ebmlHeader: true, ebmlSegment: true, ebmlInfo: true, ebmlTracks: true,
+	ebmlTrackEntry: true, ebmlCluster: true, ebmlBlockGroup: true,
+}
+
+// parseWebM reads a WebM file that may only hold a single Opus or Vorbis
+// audio track. Browser recorders often stream WebM with unknown element
+// sizes and no duration, so elements are read in a single flat pass and the
+// duration falls back to the timestamp of the last block.
+func parseWebM(data []byte) (*audioStream, error) {
+	var (
+		docType     string
+		scale       uint64 = 1_000_000 // nanoseconds per tick
+		infoTicks   float64
+		clusterTick int64
+		lastTick    int64
+		packets     []int
+		audio       bool
+		tracks      int
+	)
+
+	pos := 0
+	for pos < len(data) {
+		id, n := readElementID(data[pos:])
+		if n == 0 {
+			return nil, errMalformed
+		}
+		pos += n
+		size, n, unknown := readVint(data[pos:])
+		if n == 0 {
+			return nil, errMalformed
+		}
+		pos += n
+
+		if masterElements[id] {
+			if id == ebmlTrackEntry {
+				// Only a single audio track is accepted
+				if tracks++; tracks > 1 {
+					return nil, errMalformed
+				}
+			}
+			// Step inside; children follow immediately
+			continue
+		}
+		if unknown || size > uint64(len(data)-pos) {
+			return nil, errMalformed
+		}
+		payload := data[pos : pos+int(size)]
+		pos += int(size)
+
+		switch id {
+		case ebmlDocType:
+			docType = string(payload)
+		case ebmlTimecodeScale:
+			scale = readUint(payload)
+		case ebmlDuration:
+			switch len(payload) {
+			case 4:
+				infoTicks = float64(math.Float32frombits(binary.BigEndian.Uint32(payload)))
+			case 8:
+				infoTicks = math.Float64frombits(binary.BigEndian.Uint64(payload))
+			}
+		case ebmlTrackType:
+			if readUint(payload) != ebmlTrackAudio {
+				return nil, errMalformed
+			}
+		case ebmlCodecID:
+			if codec := string(payload); codec != "A_OPUS" && codec != "A_VORBIS" {
+				return nil, errMalformed
+			}
+			audio = true
+		case ebmlClusterTime:
+			clusterTick = int64(readUint(payload))
+		case ebmlSimpleBlock, ebmlBlock:
+			// Track number, then a 16-bit timestamp relative to the cluster
+			_, n, _ := readVint(payload)
+			if n == 0 || len(payload) < n+3 {
+				return nil, errMalformed
+			}
+			tick := clusterTick + int64(int16(binary.BigEndian.Uint16(payload[n:])))
+			lastTick = max(lastTick, tick)
+			packets = append(packets, len(payload)-n-3)
+		}
+	}
+
+	if docType != "webm" || !audio || len(packets) == 0 {
+		return nil, errMalformed
+	}
+	ticks := infoTicks
+	if ticks <= 0 {
+		ticks = float64(lastTick)
+	}
+	return &audioStream{
+		duration: time.Duration(ticks * float64(scale)),
+		packets:  packets,
+	}, nil
+}
+
+// readElementID reads an EBML element ID, which keeps its length marker
+// bits. It returns a length of 0 if the ID is invalid.
+func readElementID(b []byte) (uint64, int) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0
+	}
+	length := 1
+	for mask := byte(0x80); b[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > 4 || len(b) < length {
+		return 0, 0
+	}
+	return readUint(b[:length]), length
+}
+
+// readVint reads an EBML variable-length integer with its length marker
+// removed. unknown is set for the reserved all-ones value that marks an
+// element of unknown size.
+func readVint(b []byte) (value uint64, length int, unknown bool) {
+	if len(b) == 0 || b[0] == 0 {
+		return 0, 0, false
+	}
+	length = 1
+	mask := byte(0x80)
+	for b[0]&mask == 0 {
+		length++
+		mask >>= 1
+	}
+	if len(b) < length {
+		return 0, 0, false
+	}
+
+	value = uint64(b[0] & (mask - 1))
+	for _, c := range b[1:length] {
+		value = value<<8 | uint64(c)
+	}
+	return value, length, value == 1<<(7*length)-1
+}
+
+func readUint(b []byte) uint64 {
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
@@ -0,0 +1,67 @@
+package models
+
+import "time"
+
+// Attachment is a file uploaded to be sent with a message. It belongs to its
+// uploader until a message carries it. Forwarded copies of a message get
+// their own rows pointing at the same stored blob.
+type Attachment struct {
+	ID         uint      `json:"id" gorm:"primaryKey"`
+	UserID     uint      `json:"user_id" gorm:"not null;index"`
+	MessageID  *uint     `json:"message_id,omitempty" gorm:"index"`
+	StorageKey string    `json:"-" gorm:"not null;index"`
+	Filename   string    `json:"filename" gorm:"not null"`
+	MimeType   string    `json:"mime_type" gorm:"not null"`
+	Size       int64     `json:"size" gorm:"not null"`
+	Checksum   string    `json:"checksum" gorm:"size:64;not null"` // hex SHA-256
+	CreatedAt  time.Time `json:"created_at"`
+
+	// Images are stored with their metadata stripped, along with their
+	// dimensions, a blurhash placeholder and downscaled copies.
+	Width      int         `json:"width,omitempty"`
+	Height     int         `json:"height,omitempty"`
+	Blurhash   string      `json:"blurhash,omitempty"`
+	Thumbnails []Thumbnail `json:"thumbnails,omitempty" gorm:"type:jsonb;serializer:json"`
+
+	// Voice notes carry their length and a waveform of 0-100 levels for
+	// the player to draw.
+	DurationMs int   `json:"duration_ms,omitempty"`
+	Waveform   []int `json:"waveform,omitempty" gorm:"type:jsonb;serializer:json"`
+
+	// URL is a signed download URL, issued to whoever the attachment is
+	// shown to.
+	URL string `json:"url,omitempty" gorm:"-"`
+}
+
+// Thumbnail is a downscaled copy of an image attachment, stored next to it.
+type Thumbnail struct {
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size"`
+	URL      string `json:"url,omitempty"`
+}
+
+// imageTypes are the image formats that are processed on upload and shown
+// inline. Other image types, SVG in particular, are served as downloads.
+var imageTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// IsImageType reports whether files of the MIME type are handled as images.
+func IsImageType(mimeType string) bool {
+	return imageTypes[mimeType]
+}
+
+// IsImage reports whether the attachment was sniffed as a supported image.
+func (a *Attachment) IsImage() bool {
+	return IsImageType(a.MimeType)
+}
+
+// IsVoice reports whether the attachment was uploaded as a voice note.
+func (a *Attachment) IsVoice() bool {
+	return a.DurationMs > 0
+}
@@ -7,16 +7,242 @@ import (
 )
 
 type Message struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Content   string         `json:"content" gorm:"not null"`
-	UserID    uint           `json:"user_id" gorm:"not null"`
-	User      User           `json:"user" gorm:"foreignKey:UserID"`
-	RoomID    uint           `json:"room_id" gorm:"not null"`
-	Room      Room           `json:"room" gorm:"foreignKey:RoomID"`
-	Type      MessageType    `json:"type" gorm:"default:text"`
-	CreatedAt time.Time      `json:"created_at"`
+	ID          uint        `json:"id" gorm:"primaryKey;index:idx_messages_room_position,priority:2;index:idx_messages_room_timeline,priority:3"`
+	Content     string      `json:"content" gorm:"not null"`
+	UserID      uint        `json:"user_id" gorm:"not null;uniqueIndex:idx_messages_client_msg,priority:1"`
+	User        User        `json:"user" gorm:"foreignKey:UserID"`
+	RoomID      uint        `json:"room_id" gorm:"not null;uniqueIndex:idx_messages_client_msg,priority:2;index:idx_messages_room_position,priority:1;index:idx_messages_room_timeline,priority:1;index:idx_messages_room_changes,priority:1"`
+	Room        Room        `json:"room" gorm:"foreignKey:RoomID"`
+	Type        MessageType `json:"type" gorm:"default:text"`
+	ClientMsgID *string     `json:"client_msg_id,omitempty" gorm:"size:64;uniqueIndex:idx_messages_client_msg,priority:3"`
+	EditedAt    *time.Time  `json:"edited_at,omitempty"`
+
+	// Format says how Content is written. Markdown messages carry HTML, their
+	// sanitized rendering, which clients show instead of Content. PlainText
+	// is the content without formatting; search and notifications use it.
+	Format    MessageFormat `json:"format" gorm:"size:16;not null;default:plain"`
+	HTML      string        `json:"html,omitempty"`
+	PlainText string        `json:"-" gorm:"not null;default:''"`
+
+	// Seq numbers the message's creation among the changes to its room.
+	// UpdatedSeq is the number of the latest change to it: an edit, deletion,
+	// reaction or new thread reply.
+	Seq        uint64 `json:"seq" gorm:"not null;default:0"`
+	UpdatedSeq uint64 `json:"updated_seq" gorm:"not null;default:0;index:idx_messages_room_changes,priority:2"`
+
+	// Threads are flat: every reply points at the thread's root message.
+	// ShowInChannel replies are also shown in the room's main timeline.
+	ParentID      *uint      `json:"parent_id,omitempty"`
+	ThreadRootID  *uint      `json:"thread_root_id,omitempty" gorm:"index"`
+	ThreadRoot    *Message   `json:"-" gorm:"-"`
+	ShowInChannel bool       `json:"show_in_channel,omitempty" gorm:"default:false"`
+	ReplyCount    int        `json:"reply_count,omitempty" gorm:"default:0"`
+	LastReplyAt   *time.Time `json:"last_reply_at,omitempty"`
+
+	// ReplyToID quotes an earlier message of the same room. ReplyTo is its
+	// preview, filled in when the message is loaded.
+	ReplyToID *uint           `json:"reply_to_id,omitempty"`
+	ReplyTo   *MessagePreview `json:"reply_to,omitempty" gorm:"-"`
+
+	// ForwardedFrom credits the original author of a forwarded message.
+	ForwardedFrom *ForwardAttribution `json:"forwarded_from,omitempty" gorm:"type:jsonb;serializer:json"`
+
+	// System describes the room event a system message records.
+	System *SystemEvent `json:"system,omitempty" gorm:"type:jsonb;serializer:json"`
+
+	// Poll is the poll a poll message asks.
+	Poll *Poll `json:"poll,omitempty" gorm:"foreignKey:MessageID"`
+
+	// PinnedAt is set while the message is pinned to its room, by the
+	// moderator or admin PinnedBy.
+	PinnedAt *time.Time `json:"pinned_at,omitempty"`
+	PinnedBy *uint      `json:"pinned_by,omitempty"`
+
+	// LinkPreviews are filled in shortly after the message is sent, for the
+	// links in its content.
+	LinkPreviews []LinkPreview `json:"link_previews,omitempty" gorm:"type:jsonb;serializer:json"`
+
+	CreatedAt time.Time      `json:"created_at" gorm:"index:idx_messages_room_timeline,priority:2"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	DeletedBy *uint          `json:"-"`
+
+	// Tombstone replaces the content of a deleted message in history.
+	Tombstone *MessageTombstone `json:"tombstone,omitempty" gorm:"-"`
+
+	// Reactions is filled in per viewer when history is loaded.
+	Reactions []ReactionSummary `json:"reactions,omitempty" gorm:"-"`
+
+	// Attachments are the files sent with the message.
+	Attachments []Attachment `json:"attachments,omitempty" gorm:"foreignKey:MessageID"`
+
+	// AttachmentIDs are uploads to attach to a new message.
+	AttachmentIDs []uint `json:"-" gorm:"-"`
+
+	// Mentions holds the users a new message mentions. It is stored with the
+	// message but not loaded back.
+	Mentions []MessageMention `json:"-" gorm:"-"`
+}
+
+type MessageTombstone struct {
+	Text      string    `json:"text"`
+	DeletedBy uint      `json:"deleted_by"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// AfterFind hides the content of soft-deleted messages loaded with Unscoped.
+// The row keeps its content until it is purged, but nobody reads it back.
+func (m *Message) AfterFind(tx *gorm.DB) error {
+	if !m.DeletedAt.Valid {
+		return nil
+	}
+	m.Content = ""
+	m.HTML = ""
+	m.PlainText = ""
+	m.Attachments = nil
+	m.LinkPreviews = nil
+	m.Poll = nil
+	m.PinnedAt = nil
+	m.PinnedBy = nil
+	m.Tombstone = &MessageTombstone{
+		Text:      "message deleted",
+		DeletedAt: m.DeletedAt.Time,
+	}
+	if m.DeletedBy != nil {
+		m.Tombstone.DeletedBy = *m.DeletedBy
+	}
+	return nil
+}
+
+// MessageCursor is a position in a room's timeline. Messages are ordered by
+// creation time, then ID.
+type MessageCursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// Cursor returns the message's position in its room's timeline.
+func (m *Message) Cursor() MessageCursor {
+	return MessageCursor{CreatedAt: m.CreatedAt, ID: m.ID}
+}
+
+// MessageInput holds the caller-supplied fields of a message being sent.
+type MessageInput struct {
+	Content string
+	Format  MessageFormat
+
+	// ClientMsgID is an optional client-generated ID. Resending the same ID
+	// to the same room returns the original message instead of a duplicate.
+	ClientMsgID string
+
+	// ParentID makes the message a thread reply. AlsoSendToChannel shows the
+	// reply in the main timeline too.
+	ParentID          uint
+	AlsoSendToChannel bool
+
+	// ReplyToID quotes an earlier message of the same room inline.
+	ReplyToID uint
+
+	// Poll makes the message a poll. Its question becomes the content.
+	Poll *PollInput
+
+	// AttachmentIDs are the sender's uploads to send with the message.
+	AttachmentIDs []uint
+}
+
+// MessagePreview is the inline preview of a quoted message. A quote that can
+// no longer be shown, because the message was purged, is Unavailable and
+// carries only the ID.
+type MessagePreview struct {
+	ID          uint       `json:"id"`
+	UserID      uint       `json:"user_id,omitempty"`
+	Username    string     `json:"username,omitempty"`
+	Snippet     string     `json:"snippet,omitempty"`
+	CreatedAt   *time.Time `json:"created_at,omitempty"`
+	Deleted     bool       `json:"deleted,omitempty"`
+	Unavailable bool       `json:"unavailable,omitempty"`
+}
+
+// ForwardAttribution is a snapshot of where a forwarded message came from. It
+// names the original author but not the source room, whose members and name
+// may be private to the recipients, and survives the original being deleted.
+type ForwardAttribution struct {
+	MessageID uint      `json:"message_id"`
+	UserID    uint      `json:"user_id"`
+	Username  string    `json:"username"`
+	SentAt    time.Time `json:"sent_at"`
+}
+
+// LinkPreview describes a page linked from a message, from its OpenGraph or
+// oEmbed metadata.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+	Type        string `json:"type,omitempty"`
+}
+
+// MessageMention records that a message mentioned a user, by name or through
+// @here or @room. ReadAt is set once the user has seen it.
+type MessageMention struct {
+	MessageID uint        `json:"message_id" gorm:"primaryKey"`
+	UserID    uint        `json:"user_id" gorm:"primaryKey"`
+	Kind      MentionKind `json:"kind" gorm:"size:16;not null"`
+	Message   *Message    `json:"message,omitempty" gorm:"foreignKey:MessageID"`
+	ReadAt    *time.Time  `json:"read_at,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+type MentionKind string
+
+const (
+	// MentionUser is an @username mention.
+	MentionUser MentionKind = "user"
+	// MentionHere reaches the room members online when the message is sent.
+	MentionHere MentionKind = "here"
+	// MentionRoom reaches every member of the room.
+	MentionRoom MentionKind = "room"
+)
+
+// MessageRevision keeps the content a message had before an edit.
+type MessageRevision struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	MessageID uint      `json:"message_id" gorm:"not null;index"`
+	Content   string    `json:"content" gorm:"not null"`
+	EditedBy  uint      `json:"edited_by" gorm:"not null"`
+	Editor    User      `json:"editor" gorm:"foreignKey:EditedBy"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// MessageReaction is one user's emoji reaction to a message.
+type MessageReaction struct {
+	MessageID uint      `json:"message_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	Emoji     string    `json:"emoji" gorm:"primaryKey;size:64"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReactionSummary aggregates a message's reactions with one emoji.
+type ReactionSummary struct {
+	Emoji       string `json:"emoji"`
+	Count       int64  `json:"count"`
+	ReactedByMe bool   `json:"reacted_by_me"`
+}
+
+// ReactionChange describes a reaction being added or removed, with the
+// emoji's count afterwards.
+type ReactionChange struct {
+	RoomID    uint   `json:"room_id"`
+	MessageID uint   `json:"message_id"`
+	UserID    uint   `json:"user_id"`
+	Emoji     string `json:"emoji"`
+	Count     int64  `json:"count"`
+
+	// Seq numbers the change among the changes to the room; 0 if nothing
+	// changed.
+	Seq uint64 `json:"-"`
 }
 
 type MessageType string
@@ -25,7 +251,46 @@ const (
 	MessageTypeText   MessageType = "text"
 	MessageTypeImage  MessageType = "image"
 	MessageTypeFile   MessageType = "file"
+	MessageTypeVoice  MessageType = "voice"
 	MessageTypeSystem MessageType = "system"
+	MessageTypePoll   MessageType = "poll"
+)
+
+// SystemEvent is what a system message records: its actor did Action, to
+// the target user or message where there is one. It is data rather than
+// text so clients can word it in the reader's language.
+type SystemEvent struct {
+	Action     SystemAction `json:"action"`
+	ActorID    uint         `json:"actor_id"`
+	TargetID   *uint        `json:"target_id,omitempty"`
+	TargetName string       `json:"target_name,omitempty"`
+	MessageID  *uint        `json:"message_id,omitempty"`
+
+	// Role is a member's new role, for role changes.
+	Role MemberRole `json:"role,omitempty"`
+
+	// OldName and NewName are set for renames.
+	OldName string `json:"old_name,omitempty"`
+	NewName string `json:"new_name,omitempty"`
+}
+
+type SystemAction string
+
+const (
+	SystemMemberJoined    SystemAction = "member_joined"
+	SystemMemberLeft      SystemAction = "member_left"
+	SystemRoleChanged     SystemAction = "role_changed"
+	SystemRoomRenamed     SystemAction = "room_renamed"
+	SystemMessagePinned   SystemAction = "message_pinned"
+	SystemMessageUnpinned SystemAction = "message_unpinned"
+	SystemMessageRemoved  SystemAction = "message_removed"
+)
+
+type MessageFormat string
+
+const (
+	MessageFormatPlain    MessageFormat = "plain"
+	MessageFormatMarkdown MessageFormat = "markdown"
 )
 
 type Room struct {
@@ -33,6 +298,7 @@ type Room struct {
 	Name        string         `json:"name" gorm:"not null"`
 	Description string         `json:"description"`
 	IsPrivate   bool           `json:"is_private" gorm:"default:false"`
+	LastSeq     uint64         `json:"last_seq" gorm:"not null;default:0"`
 	CreatedBy   uint           `json:"created_by" gorm:"not null"`
 	Creator     User           `json:"creator" gorm:"foreignKey:CreatedBy"`
 	Messages    []Message      `json:"messages,omitempty" gorm:"foreignKey:RoomID"`
@@ -42,11 +308,54 @@ type Room struct {
 	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
+// RoomSummary is a room as listed for one of its members.
+type RoomSummary struct {
+	Room
+	LastMessage       *Message `json:"last_message,omitempty"`
+	LastReadMessageID *uint    `json:"last_read_message_id,omitempty"`
+
+	// UnreadCount counts other members' timeline messages after the read
+	// position. It stops at a cap, reported by UnreadCountCapped.
+	UnreadCount       int64 `json:"unread_count"`
+	UnreadCountCapped bool  `json:"unread_count_capped,omitempty"`
+}
+
+// RoomActivity is what RoomSummary adds to a room, as loaded from the database.
+type RoomActivity struct {
+	RoomID            uint
+	LastReadMessageID *uint
+	LastMessageID     *uint
+	UnreadCount       int64
+}
+
 type RoomMember struct {
 	RoomID		uint			`json:"room_id" gorm:"primaryKey"`
 	UserID 		uint			`json:"user_id" gorm:"primaryKey"`
 	JoinedAt time.Time `json:"joined_at"`
 	Role     MemberRole `json:"role" gorm:"default:member"`
+
+	// LastReadMessageID is the newest message the member has seen. It only
+	// moves forward.
+	LastReadMessageID *uint      `json:"last_read_message_id,omitempty"`
+	LastReadAt        *time.Time `json:"last_read_at,omitempty"`
+}
+
+// SyncResult holds the changes to a room after a sequence number. Seq is the
+// sequence number the client has caught up to; when HasMore is set it should
+// sync again from Seq.
+type SyncResult struct {
+	RoomID   uint      `json:"room_id"`
+	Messages []Message `json:"messages"`
+	Seq      uint64    `json:"seq"`
+	HasMore  bool      `json:"has_more"`
+}
+
+// ReadPosition is how far a member has read in a room.
+type ReadPosition struct {
+	RoomID    uint      `json:"room_id"`
+	UserID    uint      `json:"user_id"`
+	MessageID uint      `json:"message_id"`
+	ReadAt    time.Time `json:"read_at"`
 }
 
 type MemberRole string
@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Poll is the question of a poll message, whose Content repeats Question.
+// Voters pick one option, or any number with MultipleChoice. Votes on
+// Anonymous polls are counted without saying who cast them.
+type Poll struct {
+	ID             uint         `json:"id" gorm:"primaryKey"`
+	MessageID      uint         `json:"message_id" gorm:"not null;uniqueIndex"`
+	Question       string       `json:"question" gorm:"not null"`
+	Options        []PollOption `json:"options" gorm:"foreignKey:PollID"`
+	MultipleChoice bool         `json:"multiple_choice" gorm:"not null;default:false"`
+	Anonymous      bool         `json:"anonymous" gorm:"not null;default:false"`
+
+	// ClosesAt is when voting ends on its own. ClosedAt is when it ended:
+	// early, when the creator or moderator ClosedBy closed the poll, or at
+	// ClosesAt once the poll has been closed on schedule.
+	ClosesAt *time.Time `json:"closes_at,omitempty"`
+	ClosedAt *time.Time `json:"closed_at,omitempty"`
+	ClosedBy *uint      `json:"closed_by,omitempty"`
+
+	// Closed, TotalVoters and MyVotes are filled in when the poll is
+	// loaded, MyVotes per viewer.
+	Closed      bool   `json:"closed" gorm:"-"`
+	TotalVoters int64  `json:"total_voters" gorm:"-"`
+	MyVotes     []uint `json:"my_votes,omitempty" gorm:"-"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsClosed reports whether voting on the poll has ended by now.
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.ClosedAt != nil || (p.ClosesAt != nil && !now.Before(*p.ClosesAt))
+}
+
+// PollOption is one answer of a poll. Votes, and VoterIDs on public polls,
+// are filled in when the poll is loaded.
+type PollOption struct {
+	ID       uint   `json:"id" gorm:"primaryKey"`
+	PollID   uint   `json:"-" gorm:"not null;index"`
+	Position int    `json:"position" gorm:"not null"`
+	Text     string `json:"text" gorm:"not null"`
+	Votes    int64  `json:"votes" gorm:"-"`
+	VoterIDs []uint `json:"voter_ids,omitempty" gorm:"-"`
+}
+
+// PollVote is one user's vote for one option.
+type PollVote struct {
+	PollID    uint      `json:"poll_id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"primaryKey"`
+	OptionID  uint      `json:"option_id" gorm:"primaryKey"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PollInput holds the caller-supplied fields of a new poll.
+type PollInput struct {
+	Question       string     `json:"question"`
+	Options        []string   `json:"options"`
+	MultipleChoice bool       `json:"multiple_choice"`
+	Anonymous      bool       `json:"anonymous"`
+	ClosesAt       *time.Time `json:"closes_at,omitempty"`
+}
+
+// PollChange describes a vote or a poll being closed, with the poll's tallies
+// afterwards.
+type PollChange struct {
+	RoomID    uint  `json:"room_id"`
+	MessageID uint  `json:"message_id"`
+	Poll      *Poll `json:"poll"`
+
+	// Seq numbers the change among the changes to the room; 0 if nothing
+	// changed.
+	Seq uint64 `json:"-"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// SavedItem is a message a user bookmarked, with a note only they can see.
+// Bookmarks of deleted messages, or in rooms the user has left, stay stored
+// but are hidden.
+type SavedItem struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"not null;uniqueIndex:idx_saved_items_user_message,priority:1"`
+	MessageID uint      `json:"message_id" gorm:"not null;uniqueIndex:idx_saved_items_user_message,priority:2;index"`
+	Message   *Message  `json:"message,omitempty" gorm:"foreignKey:MessageID"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+type ScheduledKind string
+
+const (
+	// ScheduledMessage sends a message to a room on the user's behalf.
+	ScheduledMessage ScheduledKind = "message"
+	// ScheduledReminder reminds the user of a message.
+	ScheduledReminder ScheduledKind = "reminder"
+)
+
+type ScheduledStatus string
+
+const (
+	ScheduledPending ScheduledStatus = "pending"
+	ScheduledSent    ScheduledStatus = "sent"
+	ScheduledFailed  ScheduledStatus = "failed"
+)
+
+// ScheduledJob is a message or reminder waiting for its time. Jobs are
+// deleted once they have fired; jobs that could not fire are kept as failed,
+// with the reason in Error, until the user reschedules or cancels them.
+type ScheduledJob struct {
+	ID     uint            `json:"id" gorm:"primaryKey"`
+	UserID uint            `json:"user_id" gorm:"not null;index"`
+	Kind   ScheduledKind   `json:"kind" gorm:"size:16;not null"`
+	Status ScheduledStatus `json:"status" gorm:"size:16;not null;default:pending;index:idx_scheduled_jobs_due,priority:1"`
+	RunAt  time.Time       `json:"run_at" gorm:"not null;index:idx_scheduled_jobs_due,priority:2"`
+	RoomID uint            `json:"room_id" gorm:"not null"`
+
+	// Content, Format, ParentID, AlsoSendToChannel and ReplyToID are the
+	// message to send, as in MessageInput.
+	Content           string        `json:"content,omitempty"`
+	Format            MessageFormat `json:"format,omitempty" gorm:"size:16"`
+	ParentID          *uint         `json:"parent_id,omitempty"`
+	AlsoSendToChannel bool          `json:"also_send_to_channel,omitempty"`
+	ReplyToID         *uint         `json:"reply_to_id,omitempty"`
+
+	// MessageID is the message a reminder is about, or the message a
+	// scheduled message was sent as. Note is the user's reminder text.
+	MessageID *uint    `json:"message_id,omitempty"`
+	Message   *Message `json:"message,omitempty" gorm:"-"`
+	Note      string   `json:"note,omitempty"`
+
+	// Attempts counts the times firing failed for a reason that may pass.
+	Attempts int    `json:"-" gorm:"not null;default:0"`
+	Error    string `json:"error,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
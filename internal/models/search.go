@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+// SearchQuery is a parsed message search. Text uses web search syntax:
+// words, "quoted phrases", -excluded words and OR.
+type SearchQuery struct {
+	Text string
+
+	// From holds usernames and In room names or IDs; a message matches
+	// if it was sent by any of From in any of In.
+	From []string
+	In   []string
+
+	// Before and After bound the creation time, exclusive.
+	Before *time.Time
+	After  *time.Time
+
+	HasFile bool
+}
+
+// SearchCursor is a position in search results, which are ordered by rank,
+// then ID, both descending.
+type SearchCursor struct {
+	Rank float64
+	ID   uint
+}
+
+// SearchHit is a message matching a search. Snippet is HTML-escaped, with
+// the matching words wrapped in <mark> tags.
+type SearchHit struct {
+	Message Message `json:"message"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
@@ -0,0 +1,136 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrQuotaExceeded is returned when storing an upload would take its
+	// owner past their storage quota.
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+	// ErrAttachmentUnavailable is returned when a message is sent with an
+	// attachment that is not the sender's or already belongs to a message.
+	ErrAttachmentUnavailable = errors.New("attachment unavailable")
+)
+
+type AttachmentRepository interface {
+	Create(attachment *models.Attachment, quota int64) error
+	GetByID(id uint) (*models.Attachment, error)
+	GetOwned(userID uint, ids []uint) ([]models.Attachment, error)
+	PurgeOrphans(before time.Time) ([]models.Attachment, error)
+}
+
+type attachmentRepository struct {
+	db *gorm.DB
+}
+
+func NewAttachmentRepository(db *gorm.DB) AttachmentRepository {
+	return &attachmentRepository{db: db}
+}
+
+// Create stores an uploaded file's metadata, unless the owner's files would
+// then exceed quota bytes. The owner's row is locked while the usage is
+// summed, so concurrent uploads cannot overshoot the quota together. A blob
+// shared by forwarded copies is only counted once.
+func (r *attachmentRepository) Create(attachment *models.Attachment, quota int64) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, attachment.UserID).Error; err != nil {
+			return err
+		}
+
+		var used int64
+		err := tx.Raw(`SELECT COALESCE(SUM(size), 0) FROM (
+				SELECT DISTINCT ON (storage_key) size FROM attachments WHERE user_id = ?
+			) AS blobs`, attachment.UserID).
+			Scan(&used).Error
+		if err != nil {
+			return err
+		}
+		if quota > 0 && used+attachment.Size > quota {
+			return ErrQuotaExceeded
+		}
+
+		return tx.Create(attachment).Error
+	})
+}
+
+func (r *attachmentRepository) GetByID(id uint) (*models.Attachment, error) {
+	var attachment models.Attachment
+	err := r.db.First(&attachment, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &attachment, nil
+}
+
+// GetOwned returns the attachments among ids that the user uploaded.
+func (r *attachmentRepository) GetOwned(userID uint, ids []uint) ([]models.Attachment, error) {
+	var attachments []models.Attachment
+	if len(ids) == 0 {
+		return attachments, nil
+	}
+	err := r.db.Where("id IN ? AND user_id = ?", ids, userID).Find(&attachments).Error
+	if err != nil {
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// PurgeOrphans removes uploads created before the given time that were never
+// sent in a message. It returns one of the removed attachments for each
+// stored file no attachment refers to any more, so the files can be deleted.
+func (r *attachmentRepository) PurgeOrphans(before time.Time) ([]models.Attachment, error) {
+	var unreferenced []models.Attachment
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		var removed []models.Attachment
+		err := tx.Clauses(clause.Returning{}).
+			Where("message_id IS NULL AND created_at < ?", before).
+			Delete(&removed).Error
+		if err != nil {
+			return err
+		}
+
+		unreferenced, err = unreferencedBlobs(tx, removed)
+		return err
+	})
+	return unreferenced, err
+}
+
+// unreferencedBlobs picks, for each stored file of the removed attachments
+// that no attachment row points at any more, one of those attachments.
+func unreferencedBlobs(tx *gorm.DB, removed []models.Attachment) ([]models.Attachment, error) {
+	if len(removed) == 0 {
+		return nil, nil
+	}
+
+	keys := make([]string, len(removed))
+	for i := range removed {
+		keys[i] = removed[i].StorageKey
+	}
+	var referenced []string
+	err := tx.Session(&gorm.Session{NewDB: true}).Model(&models.Attachment{}).
+		Where("storage_key IN ?", keys).
+		Distinct().
+		Pluck("storage_key", &referenced).Error
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(map[string]bool, len(removed))
+	for _, key := range referenced {
+		done[key] = true
+	}
+	var unreferenced []models.Attachment
+	for _, attachment := range removed {
+		if !done[attachment.StorageKey] {
+			done[attachment.StorageKey] = true
+			unreferenced = append(unreferenced, attachment)
+		}
+	}
+	return unreferenced, nil
+}
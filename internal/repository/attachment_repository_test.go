@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+func TestAttachmentCreateEnforcesQuota(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewAttachmentRepository(db)
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+
+	create := func(user *models.User, key string, size int64) error {
+		return repo.Create(&models.Attachment{
+			UserID:     user.ID,
+			StorageKey: key,
+			Filename:   "f",
+			MimeType:   "text/plain",
+			Size:       size,
+		}, 100)
+	}
+
+	if err := create(alice, "a/1", 60); err != nil {
+		t.Fatal(err)
+	}
+	// Forwarded copies point at the same blob and are only charged once
+	if err := create(alice, "a/1", 60); err != nil {
+		t.Fatalf("copy of a stored blob: %v", err)
+	}
+	if err := create(alice, "a/2", 40); err != nil {
+		t.Fatalf("upload filling the quota: %v", err)
+	}
+	if err := create(alice, "a/3", 1); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("upload over quota: err = %v, want ErrQuotaExceeded", err)
+	}
+	// Quotas are per user
+	if err := create(bob, "b/1", 100); err != nil {
+		t.Fatalf("other user's upload: %v", err)
+	}
+
+	var count int64
+	db.Model(&models.Attachment{}).Where("user_id = ?", alice.ID).Count(&count)
+	if count != 3 {
+		t.Fatalf("alice has %d attachments, want 3", count)
+	}
+}
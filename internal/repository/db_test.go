@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// openTestDB connects to the Postgres database named by TEST_DATABASE_DSN
+// and migrates a fresh schema that is dropped when the test ends. Tests
+// that need a database are skipped when the variable is unset.
+func openTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	b := make([]byte, 6)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	schema := "test_" + hex.EncodeToString(b)
+
+	admin, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Exec("CREATE SCHEMA " + schema).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := gorm.Open(postgres.Open(withSearchPath(dsn, schema)), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+		admin.Exec("DROP SCHEMA " + schema + " CASCADE")
+		if sqlDB, err := admin.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+
+	err = db.AutoMigrate(&models.User{}, &models.Room{}, &models.Message{}, &models.RoomMember{}, &models.MessageRevision{}, &models.MessageReaction{}, &models.MessageMention{}, &models.Attachment{}, &models.SavedItem{}, &models.ScheduledJob{}, &models.Poll{}, &models.PollOption{}, &models.PollVote{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetupMessageSearch(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// withSearchPath points a DSN, in either URL or key=value form, at a schema.
+func withSearchPath(dsn, schema string) string {
+	if !strings.Contains(dsn, "://") {
+		return dsn + " search_path=" + schema
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&search_path=" + schema
+	}
+	return dsn + "?search_path=" + schema
+}
+
+// createTestUser stores a user with the given name.
+func createTestUser(t *testing.T, db *gorm.DB, name string) *models.User {
+	t.Helper()
+	user := &models.User{Username: name, Email: name + "@example.com", Password: "x"}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createTestRoom stores a room with the given members.
+func createTestRoom(t *testing.T, db *gorm.DB, members ...*models.User) *models.Room {
+	t.Helper()
+	room := &models.Room{Name: "room", CreatedBy: members[0].ID}
+	if err := db.Create(room).Error; err != nil {
+		t.Fatal(err)
+	}
+	for _, member := range members {
+		if err := db.Create(&models.RoomMember{RoomID: room.ID, UserID: member.ID}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	return room
+}
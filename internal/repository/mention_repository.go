@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+type MentionRepository interface {
+	GetUnread(userID uint, limit, offset int) ([]models.MessageMention, error)
+	MarkRead(userID uint, messageIDs []uint) (int64, error)
+}
+
+type mentionRepository struct {
+	db *gorm.DB
+}
+
+func NewMentionRepository(db *gorm.DB) MentionRepository {
+	return &mentionRepository{db: db}
+}
+
+// GetUnread returns the user's unread mentions, newest first. Mentions in
+// deleted messages and in rooms the user has left are skipped.
+func (r *mentionRepository) GetUnread(userID uint, limit, offset int) ([]models.MessageMention, error) {
+	var mentions []models.MessageMention
+
+	query := r.db.Preload("Message.User").Preload("Message.Room").
+		Joins("JOIN messages ON messages.id = message_mentions.message_id AND messages.deleted_at IS NULL").
+		Joins("JOIN room_members ON room_members.room_id = messages.room_id AND room_members.user_id = message_mentions.user_id").
+		Where("message_mentions.user_id = ? AND message_mentions.read_at IS NULL", userID).
+		Order("message_mentions.created_at DESC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&mentions).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return mentions, nil
+}
+
+// MarkRead marks the user's mentions in the given messages as read, or all of
+// them if messageIDs is empty, and returns how many were unread.
+func (r *mentionRepository) MarkRead(userID uint, messageIDs []uint) (int64, error) {
+	query := r.db.Model(&models.MessageMention{}).
+		Where("user_id = ? AND read_at IS NULL", userID)
+
+	if len(messageIDs) > 0 {
+		query = query.Where("message_id IN ?", messageIDs)
+	}
+
+	result := query.Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+// ErrPinLimit is returned when a room already has the maximum number of
+// pinned messages and another is pinned.
+var ErrPinLimit = errors.New("pin limit reached")
+
+// errPinUnchanged rolls back a pin or unpin that found nothing to change, so
+// the sequence number it took is given back.
+var errPinUnchanged = errors.New("pin unchanged")
+
+// Pin pins a message to its room as a new change in the room's sequence. It
+// returns false if the message was already pinned. Taking the sequence number
+// locks the room, so concurrent pins cannot push it past maxPins.
+func (r *messageRepository) Pin(message *models.Message, pinnedBy uint, maxPins int) (bool, error) {
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextSeq(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+
+		if maxPins > 0 {
+			var pinned int64
+			if err := tx.Model(&models.Message{}).
+				Where("room_id = ? AND pinned_at IS NOT NULL AND id <> ?", message.RoomID, message.ID).
+				Count(&pinned).Error; err != nil {
+				return err
+			}
+			if pinned >= int64(maxPins) {
+				return ErrPinLimit
+			}
+		}
+
+		result := tx.Model(&models.Message{ID: message.ID}).
+			Where("pinned_at IS NULL").
+			Updates(map[string]interface{}{
+				"pinned_at":   now,
+				"pinned_by":   pinnedBy,
+				"updated_seq": seq,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPinUnchanged
+		}
+		message.PinnedAt = &now
+		message.PinnedBy = &pinnedBy
+		message.UpdatedSeq = seq
+		return nil
+	})
+	if errors.Is(err, errPinUnchanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Unpin unpins a message as a new change in its room's sequence. It returns
+// false if the message was not pinned.
+func (r *messageRepository) Unpin(message *models.Message) (bool, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextSeq(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Message{ID: message.ID}).
+			Where("pinned_at IS NOT NULL").
+			Updates(map[string]interface{}{
+				"pinned_at":   nil,
+				"pinned_by":   nil,
+				"updated_seq": seq,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPinUnchanged
+		}
+		message.PinnedAt = nil
+		message.PinnedBy = nil
+		message.UpdatedSeq = seq
+		return nil
+	})
+	if errors.Is(err, errPinUnchanged) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetPinned returns the live pinned messages of a room, most recently pinned
+// first.
+func (r *messageRepository) GetPinned(roomID uint) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.db.Preload("User").Preload("Attachments").
+		Where("room_id = ? AND pinned_at IS NOT NULL", roomID).
+		Order("pinned_at DESC").
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
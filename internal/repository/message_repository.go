@@ -1,20 +1,47 @@
 package repository
 
 import (
+	"errors"
+	"time"
+
 	"github.com/Shobayosamuel/tap-me/internal/models"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type MessageRepository interface {
 	Create(message *models.Message) error
+	CreateIdempotent(message *models.Message) (bool, error)
 	GetByID(id uint) (*models.Message, error)
 	GetByIDWithRelations(id uint) (*models.Message, error)
-	GetRoomMessages(roomID uint, limit, offset int) ([]models.Message, error)
+	GetByIDWithDeleted(id uint) (*models.Message, error)
+	GetByIDsWithDeleted(ids []uint) ([]models.Message, error)
+	GetRoomMessagesBefore(roomID uint, before *models.MessageCursor, limit int) ([]models.Message, error)
+	GetRoomMessagesAfter(roomID uint, after models.MessageCursor, limit int) ([]models.Message, error)
+	GetThreadReplies(rootID uint, limit, offset int) ([]models.Message, error)
 	Update(message *models.Message) error
+	Edit(message *models.Message, editedBy uint) error
+	GetRevisions(messageID uint) ([]models.MessageRevision, error)
 	Delete(id uint) error
+	SoftDelete(message *models.Message, deletedBy uint) error
+	SetLinkPreviews(message *models.Message, previews []models.LinkPreview) (bool, error)
+	Pin(message *models.Message, pinnedBy uint, maxPins int) (bool, error)
+	Unpin(message *models.Message) (bool, error)
+	GetPinned(roomID uint) ([]models.Message, error)
+	PurgeDeleted(before time.Time) (int64, []models.Attachment, error)
 	GetUserMessages(userID uint, limit, offset int) ([]models.Message, error)
+	GetChangesSince(roomID uint, since, until uint64, limit int) ([]models.Message, error)
+	Search(userID uint, query models.SearchQuery, after *models.SearchCursor, limit int) ([]models.SearchHit, *models.SearchCursor, error)
 }
 
+// errDuplicateMessage rolls back a send that turned out to be a retry, so
+// the sequence number it took is given back.
+var errDuplicateMessage = errors.New("duplicate message")
+
+// errStalePreviews rolls back link previews fetched for content that has
+// since been edited or deleted.
+var errStalePreviews = errors.New("stale link previews")
+
 type messageRepository struct {
 	db *gorm.DB
 }
@@ -27,6 +54,101 @@ func (r *messageRepository) Create(message *models.Message) error {
 	return r.db.Create(message).Error
 }
 
+// CreateIdempotent inserts message with the room's next sequence number
+// unless the sender already posted a message with the same ClientMsgID to
+// the room. In that case message is replaced by the stored one and false is
+// returned. The unique index makes this safe under concurrent retries: the
+// losing insert waits for the winner to commit and then does nothing. A new
+// message's mentions, attachments and poll are stored, and a new thread reply
+// bumps its root's counters, in the same transaction. Uploads listed in
+// AttachmentIDs must be the sender's and not yet sent, or the send fails with
+// ErrAttachmentUnavailable.
+func (r *messageRepository) CreateIdempotent(message *models.Message) (bool, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextSeq(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+		message.Seq = seq
+		message.UpdatedSeq = seq
+
+		if message.ClientMsgID != nil {
+			tx = tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "room_id"}, {Name: "client_msg_id"}},
+				DoNothing: true,
+			})
+		}
+
+		result := tx.Omit(clause.Associations).Create(message)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errDuplicateMessage
+		}
+
+		if len(message.AttachmentIDs) > 0 {
+			result := tx.Session(&gorm.Session{NewDB: true}).Model(&models.Attachment{}).
+				Where("id IN ? AND user_id = ? AND message_id IS NULL", message.AttachmentIDs, message.UserID).
+				Update("message_id", message.ID)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected != int64(len(message.AttachmentIDs)) {
+				return ErrAttachmentUnavailable
+			}
+		}
+		if len(message.Attachments) > 0 {
+			for i := range message.Attachments {
+				message.Attachments[i].MessageID = &message.ID
+			}
+			if err := tx.Session(&gorm.Session{NewDB: true}).Create(&message.Attachments).Error; err != nil {
+				return err
+			}
+		}
+
+		if message.Poll != nil {
+			message.Poll.MessageID = message.ID
+			if err := tx.Session(&gorm.Session{NewDB: true}).Create(message.Poll).Error; err != nil {
+				return err
+			}
+		}
+
+		if len(message.Mentions) > 0 {
+			for i := range message.Mentions {
+				message.Mentions[i].MessageID = message.ID
+			}
+			if err := tx.Session(&gorm.Session{NewDB: true}).Create(&message.Mentions).Error; err != nil {
+				return err
+			}
+		}
+
+		if message.ThreadRootID != nil {
+			return tx.Session(&gorm.Session{NewDB: true}).Model(&models.Message{}).
+				Where("id = ?", *message.ThreadRootID).
+				UpdateColumns(map[string]interface{}{
+					"reply_count":   gorm.Expr("reply_count + 1"),
+					"last_reply_at": message.CreatedAt,
+					"updated_seq":   seq,
+				}).Error
+		}
+		return nil
+	})
+	if !errors.Is(err, errDuplicateMessage) {
+		return err == nil, err
+	}
+
+	var existing models.Message
+	err = r.db.Unscoped().
+		Where("user_id = ? AND room_id = ? AND client_msg_id = ?", message.UserID, message.RoomID, *message.ClientMsgID).
+		First(&existing).Error
+	if err != nil {
+		return false, err
+	}
+	*message = existing
+	return false, nil
+}
+
 func (r *messageRepository) GetByID(id uint) (*models.Message, error) {
 	var message models.Message
 	err := r.db.First(&message, id).Error
@@ -38,26 +160,58 @@ func (r *messageRepository) GetByID(id uint) (*models.Message, error) {
 
 func (r *messageRepository) GetByIDWithRelations(id uint) (*models.Message, error) {
 	var message models.Message
-	err := r.db.Preload("User").Preload("Room").First(&message, id).Error
+	err := r.db.Preload("User").Preload("Room").Preload("Attachments").First(&message, id).Error
 	if err != nil {
 		return nil, err
 	}
 	return &message, nil
 }
 
-func (r *messageRepository) GetRoomMessages(roomID uint, limit, offset int) ([]models.Message, error) {
+// GetByIDWithDeleted loads a message even if it was deleted, in which case it
+// comes back as a tombstone.
+func (r *messageRepository) GetByIDWithDeleted(id uint) (*models.Message, error) {
+	var message models.Message
+	err := r.db.Unscoped().Preload("User").Preload("Room").Preload("Attachments").First(&message, id).Error
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetByIDsWithDeleted loads the given messages with their authors, including
+// deleted ones as tombstones. IDs that no longer exist are skipped.
+func (r *messageRepository) GetByIDsWithDeleted(ids []uint) ([]models.Message, error) {
 	var messages []models.Message
+	if len(ids) == 0 {
+		return messages, nil
+	}
+	err := r.db.Unscoped().Preload("User").Preload("Attachments").Where("id IN ?", ids).Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
 
-	query := r.db.Preload("User").
+// timeline selects the messages shown in a room's main timeline. Deleted
+// messages stay in history as tombstones. Thread replies only show up when
+// they were also sent to the channel.
+func (r *messageRepository) timeline(roomID uint) *gorm.DB {
+	return r.db.Unscoped().Preload("User").Preload("Attachments").
 		Where("room_id = ?", roomID).
-		Order("created_at DESC")
+		Where("thread_root_id IS NULL OR show_in_channel")
+}
 
-	if limit > 0 {
-		query = query.Limit(limit)
-	}
+// GetRoomMessagesBefore returns up to limit timeline messages older than
+// before, or the newest ones if before is nil, oldest first.
+func (r *messageRepository) GetRoomMessagesBefore(roomID uint, before *models.MessageCursor, limit int) ([]models.Message, error) {
+	var messages []models.Message
 
-	if offset > 0 {
-		query = query.Offset(offset)
+	query := r.timeline(roomID).
+		Order("created_at DESC, id DESC").
+		Limit(limit)
+
+	if before != nil {
+		query = query.Where("(created_at, id) < (?, ?)", before.CreatedAt, before.ID)
 	}
 
 	err := query.Find(&messages).Error
@@ -73,6 +227,47 @@ func (r *messageRepository) GetRoomMessages(roomID uint, limit, offset int) ([]m
 	return messages, nil
 }
 
+// GetRoomMessagesAfter returns up to limit timeline messages newer than
+// after, oldest first.
+func (r *messageRepository) GetRoomMessagesAfter(roomID uint, after models.MessageCursor, limit int) ([]models.Message, error) {
+	var messages []models.Message
+
+	err := r.timeline(roomID).
+		Where("(created_at, id) > (?, ?)", after.CreatedAt, after.ID).
+		Order("created_at ASC, id ASC").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
+// GetThreadReplies returns a page of a thread's replies, oldest first.
+func (r *messageRepository) GetThreadReplies(rootID uint, limit, offset int) ([]models.Message, error) {
+	var messages []models.Message
+
+	query := r.db.Unscoped().Preload("User").Preload("Attachments").
+		Where("thread_root_id = ?", rootID).
+		Order("created_at ASC, id ASC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	err := query.Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return messages, nil
+}
+
 func (r *messageRepository) GetUserMessages(userID uint, limit, offset int) ([]models.Message, error) {
 	var messages []models.Message
 
@@ -100,6 +295,232 @@ func (r *messageRepository) Update(message *models.Message) error {
 	return r.db.Save(message).Error
 }
 
+// Edit saves the message's new content as a new change in the room's
+// sequence, together with a revision by editedBy holding the content it
+// replaces. The message is read again under lock once the room is locked, so
+// concurrent edits each keep the content they actually replaced. It returns
+// gorm.ErrRecordNotFound if the message was deleted meanwhile.
+func (r *messageRepository) Edit(message *models.Message, editedBy uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextSeq(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+
+		var current models.Message
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "content").First(&current, message.ID).Error; err != nil {
+			return err
+		}
+		revision := &models.MessageRevision{
+			MessageID: message.ID,
+			Content:   current.Content,
+			EditedBy:  editedBy,
+		}
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+
+		message.UpdatedSeq = seq
+		result := tx.Model(message).
+			Select("content", "html", "plain_text", "edited_at", "updated_at", "updated_seq", "link_previews").
+			Updates(message)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+		return nil
+	})
+}
+
+func (r *messageRepository) GetRevisions(messageID uint) ([]models.MessageRevision, error) {
+	var revisions []models.MessageRevision
+	err := r.db.Preload("Editor").
+		Where("message_id = ?", messageID).
+		Order("created_at ASC").
+		Find(&revisions).Error
+	if err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
 func (r *messageRepository) Delete(id uint) error {
 	return r.db.Delete(&models.Message{}, id).Error
-}
\ No newline at end of file
+}
+
+// SoftDelete marks a message deleted by the given user, as a new change in
+// the room's sequence. The content is kept until PurgeDeleted removes the row.
+// A deleted thread reply stops counting towards its root's reply count and
+// last reply time, in the same change. It returns gorm.ErrRecordNotFound if
+// the message was already deleted.
+func (r *messageRepository) SoftDelete(message *models.Message, deletedBy uint) error {
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextSeq(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+		message.UpdatedSeq = seq
+
+		result := tx.Model(message).Updates(map[string]interface{}{
+			"deleted_at":  now,
+			"deleted_by":  deletedBy,
+			"updated_seq": seq,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return gorm.ErrRecordNotFound
+		}
+
+		if message.ThreadRootID != nil {
+			rootID := *message.ThreadRootID
+			return tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&models.Message{}).
+				Where("id = ?", rootID).
+				UpdateColumns(map[string]interface{}{
+					"reply_count": gorm.Expr("GREATEST(reply_count - 1, 0)"),
+					"last_reply_at": gorm.Expr("(SELECT MAX(created_at) FROM messages WHERE thread_root_id = ? AND deleted_at IS NULL)",
+						rootID),
+					"updated_seq": seq,
+				}).Error
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	message.DeletedAt = gorm.DeletedAt{Time: now, Valid: true}
+	message.DeletedBy = &deletedBy
+	return nil
+}
+
+// SetLinkPreviews stores the previews fetched for message's links as a new
+// change in the room's sequence. It does nothing and returns false if the
+// message was deleted or its content edited after message was loaded.
+func (r *messageRepository) SetLinkPreviews(message *models.Message, previews []models.LinkPreview) (bool, error) {
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		seq, err := nextSeq(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Message{ID: message.ID}).
+			Where("content = ?", message.Content).
+			Select("link_previews", "updated_seq").
+			Updates(&models.Message{LinkPreviews: previews, UpdatedSeq: seq})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errStalePreviews
+		}
+		message.LinkPreviews = previews
+		message.UpdatedSeq = seq
+		return nil
+	})
+	if errors.Is(err, errStalePreviews) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// GetChangesSince returns up to limit messages of the room, including thread
+// replies and tombstones, created or changed after since and no later than
+// until, in the order of their last change.
+func (r *messageRepository) GetChangesSince(roomID uint, since, until uint64, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := r.db.Unscoped().Preload("User").Preload("Attachments").
+		Where("room_id = ? AND updated_seq > ? AND updated_seq <= ?", roomID, since, until).
+		Order("updated_seq ASC").
+		Limit(limit).
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// PurgeDeleted permanently removes messages deleted before the given time,
+// along with the rows that hang off them. A thread root whose replies are
+// not all being purged keeps its row, stripped of its content, so the thread
+// can still be opened; it goes in a later purge with its last reply. Parent
+// and quote references to removed messages are cleared. It returns the
+// number of messages removed and one removed attachment for each stored file
+// no attachment refers to any more, so the files can be deleted.
+func (r *messageRepository) PurgeDeleted(before time.Time) (int64, []models.Attachment, error) {
+	var purged int64
+	var unreferenced []models.Attachment
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		expired := tx.Unscoped().Model(&models.Message{}).
+			Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before)
+		removable := tx.Unscoped().Model(&models.Message{}).
+			Select("id").
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+			Where(`NOT EXISTS (SELECT 1 FROM messages replies WHERE replies.thread_root_id = messages.id
+				AND (replies.deleted_at IS NULL OR replies.deleted_at >= ?))`, before)
+
+		if err := tx.Where("message_id IN (?)", expired).Delete(&models.MessageRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN (?)", expired).Delete(&models.MessageReaction{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN (?)", expired).Delete(&models.MessageMention{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN (?)", expired).Delete(&models.SavedItem{}).Error; err != nil {
+			return err
+		}
+
+		polls := tx.Model(&models.Poll{}).Select("id").Where("message_id IN (?)", expired)
+		if err := tx.Where("poll_id IN (?)", polls).Delete(&models.PollVote{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("poll_id IN (?)", polls).Delete(&models.PollOption{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("message_id IN (?)", expired).Delete(&models.Poll{}).Error; err != nil {
+			return err
+		}
+
+		var removed []models.Attachment
+		if err := tx.Clauses(clause.Returning{}).Where("message_id IN (?)", expired).Delete(&removed).Error; err != nil {
+			return err
+		}
+
+		// Expired thread roots that are kept lose their content all the same
+		err := tx.Unscoped().Model(&models.Message{}).Where("id IN (?)", expired).
+			UpdateColumns(map[string]interface{}{
+				"content":        "",
+				"html":           "",
+				"plain_text":     "",
+				"link_previews":  nil,
+				"forwarded_from": nil,
+			}).Error
+		if err != nil {
+			return err
+		}
+
+		for _, column := range []string{"parent_id", "reply_to_id"} {
+			err := tx.Unscoped().Model(&models.Message{}).Where(column+" IN (?)", removable).
+				UpdateColumn(column, nil).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		result := tx.Unscoped().Where("id IN (?)", removable).Delete(&models.Message{})
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+
+		unreferenced, err = unreferencedBlobs(tx, removed)
+		return err
+	})
+	return purged, unreferenced, err
+}
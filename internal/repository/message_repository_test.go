@@ -0,0 +1,298 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+func TestCreateIdempotentConcurrentRetries(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMessageRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+
+	const senders = 8
+	clientMsgID := "retry-1"
+	messages := make([]*models.Message, senders)
+	created := make([]bool, senders)
+	errs := make([]error, senders)
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for i := range messages {
+		messages[i] = &models.Message{Content: "hello", UserID: alice.ID, RoomID: room.ID, ClientMsgID: &clientMsgID}
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			created[i], errs[i] = repo.CreateIdempotent(messages[i])
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	winners := 0
+	for i := range messages {
+		if errs[i] != nil {
+			t.Fatalf("sender %d: %v", i, errs[i])
+		}
+		if created[i] {
+			winners++
+		}
+		if messages[i].ID != messages[0].ID || messages[i].Seq != messages[0].Seq {
+			t.Errorf("sender %d got message %d seq %d, sender 0 got message %d seq %d",
+				i, messages[i].ID, messages[i].Seq, messages[0].ID, messages[0].Seq)
+		}
+	}
+	if winners != 1 {
+		t.Errorf("%d senders created the message, want 1", winners)
+	}
+
+	var count int64
+	db.Model(&models.Message{}).Where("room_id = ?", room.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("room has %d messages, want 1", count)
+	}
+	// Losing inserts roll back the sequence number they drew
+	var stored models.Room
+	db.First(&stored, room.ID)
+	if stored.LastSeq != 1 || messages[0].Seq != 1 {
+		t.Errorf("room last_seq = %d, message seq = %d; want 1 and 1", stored.LastSeq, messages[0].Seq)
+	}
+
+	// The same client ID is free in another room
+	other := createTestRoom(t, db, alice)
+	message := &models.Message{Content: "hello", UserID: alice.ID, RoomID: other.ID, ClientMsgID: &clientMsgID}
+	if ok, err := repo.CreateIdempotent(message); err != nil || !ok {
+		t.Fatalf("same client ID in another room: created = %v, err = %v", ok, err)
+	}
+
+	// A retry of a message deleted since finds its tombstone
+	if err := repo.SoftDelete(message, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	retry := &models.Message{Content: "hello", UserID: alice.ID, RoomID: other.ID, ClientMsgID: &clientMsgID}
+	ok, err := repo.CreateIdempotent(retry)
+	if err != nil || ok {
+		t.Fatalf("retry of a deleted message: created = %v, err = %v", ok, err)
+	}
+	if retry.ID != message.ID || retry.Tombstone == nil || retry.Content != "" {
+		t.Fatalf("retry of a deleted message got %+v, want its tombstone", retry)
+	}
+}
+
+func TestCreateIdempotentRetriedReplyCountsOnce(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMessageRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+
+	root := &models.Message{Content: "root", UserID: alice.ID, RoomID: room.ID}
+	if _, err := repo.CreateIdempotent(root); err != nil {
+		t.Fatal(err)
+	}
+
+	clientMsgID := "reply-1"
+	for i := 0; i < 2; i++ {
+		reply := &models.Message{Content: "reply", UserID: alice.ID, RoomID: room.ID, ClientMsgID: &clientMsgID, ParentID: &root.ID, ThreadRootID: &root.ID}
+		if _, err := repo.CreateIdempotent(reply); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stored models.Message
+	db.First(&stored, root.ID)
+	if stored.ReplyCount != 1 {
+		t.Fatalf("root reply_count = %d after a retried reply, want 1", stored.ReplyCount)
+	}
+}
+
+func TestEditRecordsReplacedContent(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMessageRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+	message := &models.Message{Content: "v1", UserID: alice.ID, RoomID: room.ID}
+	if _, err := repo.CreateIdempotent(message); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two edits made from copies read before either was saved
+	first, second := *message, *message
+	first.Content, second.Content = "v2", "v3"
+	if err := repo.Edit(&first, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Edit(&second, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	revisions, err := repo.GetRevisions(message.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 2 || revisions[0].Content != "v1" || revisions[1].Content != "v2" {
+		t.Fatalf("revisions = %+v, want v1 then v2", revisions)
+	}
+	if second.UpdatedSeq != 3 {
+		t.Fatalf("second edit seq = %d, want 3", second.UpdatedSeq)
+	}
+}
+
+func TestEditDeletedMessage(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMessageRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+	message := &models.Message{Content: "v1", UserID: alice.ID, RoomID: room.ID}
+	if _, err := repo.CreateIdempotent(message); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := *message
+	if err := repo.SoftDelete(message, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	stale.Content = "v2"
+	if err := repo.Edit(&stale, alice.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("edit of a deleted message: err = %v, want gorm.ErrRecordNotFound", err)
+	}
+
+	var revisions int64
+	db.Model(&models.MessageRevision{}).Where("message_id = ?", message.ID).Count(&revisions)
+	var stored models.Room
+	db.First(&stored, room.ID)
+	if revisions != 0 || stored.LastSeq != 2 {
+		t.Fatalf("failed edit left %d revisions and last_seq %d, want 0 and 2", revisions, stored.LastSeq)
+	}
+}
+
+func TestSoftDeleteReplyUpdatesRoot(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMessageRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+	root := &models.Message{Content: "root", UserID: alice.ID, RoomID: room.ID}
+	if _, err := repo.CreateIdempotent(root); err != nil {
+		t.Fatal(err)
+	}
+	var replies [2]*models.Message
+	for i := range replies {
+		replies[i] = &models.Message{Content: "reply", UserID: alice.ID, RoomID: room.ID, ParentID: &root.ID, ThreadRootID: &root.ID}
+		if _, err := repo.CreateIdempotent(replies[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, _ := repo.GetByID(replies[0].ID)
+
+	if err := repo.SoftDelete(replies[1], alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.SoftDelete(replies[1], alice.ID); !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("second delete: err = %v, want gorm.ErrRecordNotFound", err)
+	}
+
+	var stored models.Message
+	db.First(&stored, root.ID)
+	if stored.ReplyCount != 1 || stored.UpdatedSeq != replies[1].UpdatedSeq {
+		t.Fatalf("root reply_count %d at seq %d, want 1 at seq %d", stored.ReplyCount, stored.UpdatedSeq, replies[1].UpdatedSeq)
+	}
+	if stored.LastReplyAt == nil || !stored.LastReplyAt.Equal(first.CreatedAt) {
+		t.Fatalf("root last_reply_at = %v, want the remaining reply's %v", stored.LastReplyAt, first.CreatedAt)
+	}
+
+	if err := repo.SoftDelete(replies[0], alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	stored = models.Message{}
+	db.First(&stored, root.ID)
+	if stored.ReplyCount != 0 || stored.LastReplyAt != nil {
+		t.Fatalf("root with no replies left has reply_count %d and last_reply_at %v", stored.ReplyCount, stored.LastReplyAt)
+	}
+}
+
+func TestPurgeDeletedKeepsThreadRoots(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMessageRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+	send := func(message *models.Message) *models.Message {
+		message.UserID, message.RoomID = alice.ID, room.ID
+		if _, err := repo.CreateIdempotent(message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	root := send(&models.Message{Content: "root"})
+	quoted := send(&models.Message{Content: "quoted"})
+	reply := send(&models.Message{Content: "reply", ParentID: &root.ID, ThreadRootID: &root.ID, ReplyToID: &quoted.ID})
+	for _, message := range []*models.Message{root, quoted} {
+		if err := repo.SoftDelete(message, alice.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	purged, _, err := repo.PurgeDeleted(time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged != 1 {
+		t.Fatalf("purged %d messages, want only the quoted one", purged)
+	}
+	var stored models.Message
+	if err := db.Unscoped().First(&stored, root.ID).Error; err != nil {
+		t.Fatalf("thread root with a live reply was purged: %v", err)
+	}
+	var content string
+	db.Unscoped().Model(&models.Message{}).Where("id = ?", root.ID).Pluck("content", &content)
+	if content != "" {
+		t.Fatalf("kept thread root still has content %q", content)
+	}
+	stored = models.Message{}
+	db.First(&stored, reply.ID)
+	if stored.ReplyToID != nil || stored.ParentID == nil {
+		t.Fatalf("reply has reply_to_id %v and parent_id %v, want only the quote cleared", stored.ReplyToID, stored.ParentID)
+	}
+
+	// The root goes with its last reply
+	if err := repo.SoftDelete(reply, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if purged, _, err = repo.PurgeDeleted(time.Now().Add(time.Minute)); err != nil || purged != 2 {
+		t.Fatalf("second purge removed %d messages, err %v; want the root and its reply", purged, err)
+	}
+}
+
+func TestSearchPages(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewMessageRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+	for i := 0; i < 3; i++ {
+		message := &models.Message{Content: "hello", PlainText: "hello", UserID: alice.ID, RoomID: room.ID}
+		if _, err := repo.CreateIdempotent(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	query := models.SearchQuery{Text: "hello"}
+
+	first, next, err := repo.Search(alice.ID, query, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || next == nil || next.ID != first[1].Message.ID {
+		t.Fatalf("first page has %d hits and cursor %+v", len(first), next)
+	}
+	second, next, err := repo.Search(alice.ID, query, next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(second) != 1 || next != nil {
+		t.Fatalf("last page has %d hits and cursor %+v, want 1 and none", len(second), next)
+	}
+}
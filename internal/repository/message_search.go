@@ -0,0 +1,151 @@
+package repository
+
+import (
+	"strings"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+// searchConfig is the text search configuration messages are indexed with.
+const searchConfig = "english"
+
+// escapedContent is the plain text of a message made safe to embed in HTML,
+// so that snippets can carry <mark> tags.
+const escapedContent = "replace(replace(replace(plain_text, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+
+// SetupMessageSearch adds the full-text index of the plain text of messages,
+// so Markdown syntax is neither matched nor shown in snippets. The tsvector
+// column is generated, so Postgres keeps it current on insert and edit.
+// AutoMigrate can't express generated columns, hence the explicit SQL.
+func SetupMessageSearch(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// Messages sent before formats existed are plain text
+		err := tx.Exec("UPDATE messages SET plain_text = content WHERE plain_text = '' AND content <> '' AND format = ?",
+			models.MessageFormatPlain).Error
+		if err != nil {
+			return err
+		}
+
+		// Columns generated from content are rebuilt from plain_text
+		var expression string
+		err = tx.Raw(`SELECT coalesce(generation_expression, '') FROM information_schema.columns
+			WHERE table_name = 'messages' AND column_name = 'search_vector' AND table_schema = current_schema()`).
+			Scan(&expression).Error
+		if err != nil {
+			return err
+		}
+		if expression != "" && !strings.Contains(expression, "plain_text") {
+			if err := tx.Exec("ALTER TABLE messages DROP COLUMN search_vector").Error; err != nil {
+				return err
+			}
+		}
+
+		err = tx.Exec(`ALTER TABLE messages ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector('` + searchConfig + `', plain_text)) STORED`).Error
+		if err != nil {
+			return err
+		}
+		return tx.Exec("CREATE INDEX IF NOT EXISTS idx_messages_search ON messages USING GIN (search_vector)").Error
+	})
+}
+
+// Search returns up to limit live messages matching query in the rooms the
+// user belongs to, best match first, starting after the cursor if one is
+// given, and the cursor of the next page, or nil on the last one. Membership
+// is part of the query, so other rooms' messages are never read.
+func (r *messageRepository) Search(userID uint, query models.SearchQuery, after *models.SearchCursor, limit int) ([]models.SearchHit, *models.SearchCursor, error) {
+	tsquery := "websearch_to_tsquery('" + searchConfig + "', ?)"
+
+	matches := r.db.Table("messages").
+		Joins("JOIN room_members ON room_members.room_id = messages.room_id AND room_members.user_id = ?", userID).
+		Where("messages.deleted_at IS NULL AND messages.type <> ?", models.MessageTypeSystem)
+
+	if query.Text != "" {
+		matches = matches.
+			Select("messages.id, messages.plain_text, ts_rank_cd(messages.search_vector, "+tsquery+")::float8 AS rank", query.Text).
+			Where("messages.search_vector @@ "+tsquery, query.Text)
+	} else {
+		matches = matches.Select("messages.id, messages.plain_text, 0::float8 AS rank")
+	}
+
+	if len(query.From) > 0 {
+		matches = matches.Where("messages.user_id IN (SELECT id FROM users WHERE lower(username) IN ?)", lower(query.From))
+	}
+	if len(query.In) > 0 {
+		matches = matches.Where("messages.room_id IN (SELECT id FROM rooms WHERE lower(name) IN ? OR id::text IN ?)", lower(query.In), query.In)
+	}
+	if query.Before != nil {
+		matches = matches.Where("messages.created_at < ?", *query.Before)
+	}
+	if query.After != nil {
+		matches = matches.Where("messages.created_at > ?", *query.After)
+	}
+	if query.HasFile {
+		matches = matches.Where("EXISTS (SELECT 1 FROM attachments WHERE attachments.message_id = messages.id)")
+	}
+
+	// Snippets are only built for the page being returned
+	hits := r.db.Table("(?) AS hits", matches)
+	if query.Text != "" {
+		hits = hits.Select("id, rank, ts_headline('"+searchConfig+"', "+escapedContent+", "+tsquery+
+			", 'StartSel=<mark>, StopSel=</mark>, MaxWords=30, MinWords=10, MaxFragments=2') AS snippet", query.Text)
+	} else {
+		hits = hits.Select("id, rank, left(" + escapedContent + ", 200) AS snippet")
+	}
+	if after != nil {
+		hits = hits.Where("(rank, id) < (?, ?)", after.Rank, after.ID)
+	}
+
+	var rows []struct {
+		ID      uint
+		Rank    float64
+		Snippet string
+	}
+	err := hits.Order("rank DESC, id DESC").Limit(limit + 1).Scan(&rows).Error
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// The next page starts after the last row matched, even if that message
+	// is deleted before it is loaded below
+	var next *models.SearchCursor
+	if len(rows) > limit {
+		rows = rows[:limit]
+		last := rows[limit-1]
+		next = &models.SearchCursor{Rank: last.Rank, ID: last.ID}
+	}
+	if len(rows) == 0 {
+		return []models.SearchHit{}, nil, nil
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	var messages []models.Message
+	if err := r.db.Preload("User").Preload("Room").Preload("Attachments").Where("id IN ?", ids).Find(&messages).Error; err != nil {
+		return nil, nil, err
+	}
+	byID := make(map[uint]models.Message, len(messages))
+	for _, m := range messages {
+		byID[m.ID] = m
+	}
+
+	// A message deleted since the search ran is left out
+	results := make([]models.SearchHit, 0, len(rows))
+	for _, row := range rows {
+		if message, ok := byID[row.ID]; ok {
+			results = append(results, models.SearchHit{Message: message, Snippet: row.Snippet, Rank: row.Rank})
+		}
+	}
+	return results, next, nil
+}
+
+func lower(values []string) []string {
+	out := make([]string, len(values))
+	for i, v := range values {
+		out[i] = strings.ToLower(v)
+	}
+	return out
+}
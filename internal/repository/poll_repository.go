@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrPollClosed is returned when a vote arrives after voting ended.
+	ErrPollClosed = errors.New("poll is closed")
+
+	// ErrPollOption is returned when a vote names an option of another poll.
+	ErrPollOption = errors.New("option is not part of the poll")
+)
+
+// errPollUnchanged rolls back a vote or close that changed nothing, so the
+// sequence number it took is given back.
+var errPollUnchanged = errors.New("poll unchanged")
+
+type PollRepository interface {
+	Vote(message *models.Message, userID uint, optionIDs []uint) (uint64, error)
+	Close(message *models.Message, closedBy uint) (uint64, error)
+	CloseDue(now time.Time, limit int) ([]models.PollChange, error)
+	GetByMessageIDs(messageIDs []uint) (map[uint]*models.Poll, error)
+	Votes(pollIDs []uint) ([]models.PollVote, error)
+}
+
+type pollRepository struct {
+	db *gorm.DB
+}
+
+func NewPollRepository(db *gorm.DB) PollRepository {
+	return &pollRepository{db: db}
+}
+
+// Vote replaces the user's votes on the poll of message with optionIDs, which
+// may be empty to take them back, as a new change in the room's sequence. It
+// returns the change's sequence number, or 0 if the votes were already so.
+// Taking the sequence number locks the room, so a vote cannot slip in after
+// the poll is closed.
+func (r *pollRepository) Vote(message *models.Message, userID uint, optionIDs []uint) (uint64, error) {
+	var seq uint64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		next, err := nextSeq(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+
+		var poll models.Poll
+		if err := tx.Where("message_id = ?", message.ID).First(&poll).Error; err != nil {
+			return err
+		}
+		if poll.IsClosed(time.Now()) {
+			return ErrPollClosed
+		}
+
+		if len(optionIDs) > 0 {
+			var known int64
+			if err := tx.Model(&models.PollOption{}).
+				Where("poll_id = ? AND id IN ?", poll.ID, optionIDs).
+				Count(&known).Error; err != nil {
+				return err
+			}
+			if known != int64(len(optionIDs)) {
+				return ErrPollOption
+			}
+		}
+
+		var current []uint
+		if err := tx.Model(&models.PollVote{}).
+			Where("poll_id = ? AND user_id = ?", poll.ID, userID).
+			Pluck("option_id", &current).Error; err != nil {
+			return err
+		}
+		if sameIDs(current, optionIDs) {
+			return errPollUnchanged
+		}
+
+		if err := tx.Where("poll_id = ? AND user_id = ?", poll.ID, userID).Delete(&models.PollVote{}).Error; err != nil {
+			return err
+		}
+		if len(optionIDs) > 0 {
+			votes := make([]models.PollVote, len(optionIDs))
+			for i, optionID := range optionIDs {
+				votes[i] = models.PollVote{PollID: poll.ID, UserID: userID, OptionID: optionID}
+			}
+			if err := tx.Create(&votes).Error; err != nil {
+				return err
+			}
+		}
+
+		seq = next
+		return touchMessage(tx, message.ID, next)
+	})
+	if errors.Is(err, errPollUnchanged) {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// Close ends voting on the poll of message as a new change in the room's
+// sequence. It returns the change's sequence number, or 0 if the poll was
+// already closed.
+func (r *pollRepository) Close(message *models.Message, closedBy uint) (uint64, error) {
+	var seq uint64
+	now := time.Now()
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		next, err := nextSeq(tx, message.RoomID)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Model(&models.Poll{}).
+			Where("message_id = ? AND closed_at IS NULL AND (closes_at IS NULL OR closes_at > ?)", message.ID, now).
+			Updates(map[string]interface{}{
+				"closed_at": now,
+				"closed_by": closedBy,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errPollUnchanged
+		}
+
+		seq = next
+		return touchMessage(tx, message.ID, next)
+	})
+	if errors.Is(err, errPollUnchanged) {
+		return 0, nil
+	}
+	return seq, err
+}
+
+// CloseDue closes up to limit polls of live messages whose closing time has
+// passed by now, each as a new change in its room's sequence, and returns
+// the changes without their polls. A poll closed meanwhile is left out.
+func (r *pollRepository) CloseDue(now time.Time, limit int) ([]models.PollChange, error) {
+	var due []struct {
+		MessageID uint
+		RoomID    uint
+	}
+	err := r.db.Table("polls").
+		Select("polls.message_id, messages.room_id").
+		Joins("JOIN messages ON messages.id = polls.message_id AND messages.deleted_at IS NULL").
+		Where("polls.closed_at IS NULL AND polls.closes_at <= ?", now).
+		Order("polls.closes_at ASC").
+		Limit(limit).
+		Scan(&due).Error
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make([]models.PollChange, 0, len(due))
+	for _, poll := range due {
+		var seq uint64
+		err := r.db.Transaction(func(tx *gorm.DB) error {
+			next, err := nextSeq(tx, poll.RoomID)
+			if err != nil {
+				return err
+			}
+
+			result := tx.Model(&models.Poll{}).
+				Where("message_id = ? AND closed_at IS NULL", poll.MessageID).
+				Update("closed_at", gorm.Expr("closes_at"))
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errPollUnchanged
+			}
+
+			seq = next
+			return touchMessage(tx, poll.MessageID, next)
+		})
+		if errors.Is(err, errPollUnchanged) {
+			continue
+		}
+		if err != nil {
+			return changes, err
+		}
+		changes = append(changes, models.PollChange{RoomID: poll.RoomID, MessageID: poll.MessageID, Seq: seq})
+	}
+	return changes, nil
+}
+
+// GetByMessageIDs loads the polls of the given messages, keyed by message ID,
+// with their options in order.
+func (r *pollRepository) GetByMessageIDs(messageIDs []uint) (map[uint]*models.Poll, error) {
+	polls := make(map[uint]*models.Poll)
+	if len(messageIDs) == 0 {
+		return polls, nil
+	}
+
+	var rows []models.Poll
+	err := r.db.Preload("Options", func(db *gorm.DB) *gorm.DB {
+		return db.Order("position ASC")
+	}).Where("message_id IN ?", messageIDs).Find(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	for i := range rows {
+		polls[rows[i].MessageID] = &rows[i]
+	}
+	return polls, nil
+}
+
+// Votes returns every vote cast on the given polls, oldest first.
+func (r *pollRepository) Votes(pollIDs []uint) ([]models.PollVote, error) {
+	var votes []models.PollVote
+	if len(pollIDs) == 0 {
+		return votes, nil
+	}
+	err := r.db.Where("poll_id IN ?", pollIDs).Order("created_at ASC").Find(&votes).Error
+	return votes, err
+}
+
+// sameIDs reports whether a and b hold the same IDs, in any order.
+func sameIDs(a, b []uint) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]uint(nil), a...)
+	b = append([]uint(nil), b...)
+	sort.Slice(a, func(i, j int) bool { return a[i] < a[j] })
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
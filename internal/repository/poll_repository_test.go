@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+func TestCloseDue(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewPollRepository(db)
+	messages := NewMessageRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+	send := func(closesAt time.Time) *models.Message {
+		t.Helper()
+		message := &models.Message{Content: "lunch?", Type: models.MessageTypePoll, UserID: alice.ID, RoomID: room.ID,
+			Poll: &models.Poll{Question: "lunch?", ClosesAt: &closesAt, Options: []models.PollOption{{Text: "yes"}, {Text: "no", Position: 1}}}}
+		if _, err := messages.CreateIdempotent(message); err != nil {
+			t.Fatal(err)
+		}
+		return message
+	}
+	now := time.Now()
+	due := send(now.Add(-time.Minute))
+	send(now.Add(time.Hour))
+	deleted := send(now.Add(-time.Minute))
+	if err := messages.SoftDelete(deleted, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	changes, err := repo.CloseDue(now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].MessageID != due.ID || changes[0].Seq != 5 {
+		t.Fatalf("changes = %+v, want the due poll closed at seq 5", changes)
+	}
+	polls, err := repo.GetByMessageIDs([]uint{due.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if poll := polls[due.ID]; poll.ClosedAt == nil || poll.ClosedBy != nil {
+		t.Fatalf("closed poll has closed_at %v and closed_by %v", poll.ClosedAt, poll.ClosedBy)
+	}
+
+	if changes, err := repo.CloseDue(now, 10); err != nil || len(changes) != 0 {
+		t.Fatalf("second run closed %+v, err %v; want nothing", changes, err)
+	}
+}
@@ -0,0 +1,176 @@
+package repository
+
+import (
+	"errors"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrReactionLimit is returned when a message already has the maximum number
+// of distinct emoji and a new one is added.
+var ErrReactionLimit = errors.New("reaction limit reached")
+
+// errReactionUnchanged rolls back an add or remove that changed nothing, so
+// the sequence number it took is given back.
+var errReactionUnchanged = errors.New("reaction unchanged")
+
+type ReactionRepository interface {
+	Add(reaction *models.MessageReaction, maxDistinct int) (uint64, int64, error)
+	Remove(messageID, userID uint, emoji string) (uint64, int64, error)
+	Summaries(messageIDs []uint, viewerID uint) (map[uint][]models.ReactionSummary, error)
+}
+
+type reactionRepository struct {
+	db *gorm.DB
+}
+
+func NewReactionRepository(db *gorm.DB) ReactionRepository {
+	return &reactionRepository{db: db}
+}
+
+// Add stores a reaction and returns the room sequence number of the change,
+// or 0 if the user had already reacted with that emoji, along with how many
+// users now reacted with it. The message stays locked while the
+// distinct-emoji limit is checked, so concurrent reactions cannot push a
+// message past it.
+func (r *reactionRepository) Add(reaction *models.MessageReaction, maxDistinct int) (uint64, int64, error) {
+	var seq uint64
+	var count int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		next, err := r.lock(tx, reaction.MessageID)
+		if err != nil {
+			return err
+		}
+
+		var sameEmoji int64
+		if err := tx.Model(&models.MessageReaction{}).
+			Where("message_id = ? AND emoji = ?", reaction.MessageID, reaction.Emoji).
+			Count(&sameEmoji).Error; err != nil {
+			return err
+		}
+
+		if sameEmoji == 0 && maxDistinct > 0 {
+			var distinct int64
+			if err := tx.Model(&models.MessageReaction{}).
+				Where("message_id = ?", reaction.MessageID).
+				Distinct("emoji").
+				Count(&distinct).Error; err != nil {
+				return err
+			}
+			if distinct >= int64(maxDistinct) {
+				return ErrReactionLimit
+			}
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(reaction)
+		if result.Error != nil {
+			return result.Error
+		}
+		if count, err = r.count(tx, reaction.MessageID, reaction.Emoji); err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return errReactionUnchanged
+		}
+		seq = next
+		return touchMessage(tx, reaction.MessageID, seq)
+	})
+	if errors.Is(err, errReactionUnchanged) {
+		return 0, count, nil
+	}
+	return seq, count, err
+}
+
+// Remove deletes a reaction and returns the room sequence number of the
+// change, or 0 if there was no such reaction, along with how many users are
+// left reacting with the emoji.
+func (r *reactionRepository) Remove(messageID, userID uint, emoji string) (uint64, int64, error) {
+	var seq uint64
+	var count int64
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		next, err := r.lock(tx, messageID)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Where("message_id = ? AND user_id = ? AND emoji = ?", messageID, userID, emoji).
+			Delete(&models.MessageReaction{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if count, err = r.count(tx, messageID, emoji); err != nil {
+			return err
+		}
+		if result.RowsAffected == 0 {
+			return errReactionUnchanged
+		}
+		seq = next
+		return touchMessage(tx, messageID, seq)
+	})
+	if errors.Is(err, errReactionUnchanged) {
+		return 0, count, nil
+	}
+	return seq, count, err
+}
+
+// lock takes the room's next sequence number for a change to a message's
+// reactions, then locks the message. Like every other change, it locks the
+// room before the message, so concurrent changes cannot deadlock.
+func (r *reactionRepository) lock(tx *gorm.DB, messageID uint) (uint64, error) {
+	var message models.Message
+	if err := tx.Select("id", "room_id").First(&message, messageID).Error; err != nil {
+		return 0, err
+	}
+	seq, err := nextSeq(tx, message.RoomID)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Session(&gorm.Session{NewDB: true}).Clauses(clause.Locking{Strength: "UPDATE"}).
+		Select("id").First(&models.Message{}, messageID).Error
+	return seq, err
+}
+
+// count returns how many users reacted to a message with an emoji.
+func (r *reactionRepository) count(tx *gorm.DB, messageID uint, emoji string) (int64, error) {
+	var count int64
+	err := tx.Session(&gorm.Session{NewDB: true}).Model(&models.MessageReaction{}).
+		Where("message_id = ? AND emoji = ?", messageID, emoji).
+		Count(&count).Error
+	return count, err
+}
+
+// Summaries aggregates reactions per message and emoji, in the order each
+// emoji was first used, marking the ones the viewer added.
+func (r *reactionRepository) Summaries(messageIDs []uint, viewerID uint) (map[uint][]models.ReactionSummary, error) {
+	summaries := make(map[uint][]models.ReactionSummary)
+	if len(messageIDs) == 0 {
+		return summaries, nil
+	}
+
+	var rows []struct {
+		MessageID   uint
+		Emoji       string
+		Count       int64
+		ReactedByMe bool
+	}
+	err := r.db.Model(&models.MessageReaction{}).
+		Select("message_id, emoji, COUNT(*) AS count, BOOL_OR(user_id = ?) AS reacted_by_me", viewerID).
+		Where("message_id IN ?", messageIDs).
+		Group("message_id, emoji").
+		Order("MIN(created_at)").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		summaries[row.MessageID] = append(summaries[row.MessageID], models.ReactionSummary{
+			Emoji:       row.Emoji,
+			Count:       row.Count,
+			ReactedByMe: row.ReactedByMe,
+		})
+	}
+	return summaries, nil
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+func TestReactionAddRemove(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReactionRepository(db)
+	alice := createTestUser(t, db, "alice")
+	bob := createTestUser(t, db, "bob")
+	room := createTestRoom(t, db, alice, bob)
+	message := &models.Message{Content: "hi", UserID: alice.ID, RoomID: room.ID}
+	if _, err := NewMessageRepository(db).CreateIdempotent(message); err != nil {
+		t.Fatal(err)
+	}
+
+	react := func(user *models.User) (uint64, int64) {
+		t.Helper()
+		seq, count, err := repo.Add(&models.MessageReaction{MessageID: message.ID, UserID: user.ID, Emoji: "👍"}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return seq, count
+	}
+
+	if seq, count := react(alice); seq != 2 || count != 1 {
+		t.Fatalf("first reaction: seq %d count %d, want 2 and 1", seq, count)
+	}
+	// Repeating a reaction changes nothing and gives its sequence number back
+	if seq, count := react(alice); seq != 0 || count != 1 {
+		t.Fatalf("repeated reaction: seq %d count %d, want 0 and 1", seq, count)
+	}
+	if seq, count := react(bob); seq != 3 || count != 2 {
+		t.Fatalf("second user's reaction: seq %d count %d, want 3 and 2", seq, count)
+	}
+
+	seq, count, err := repo.Remove(message.ID, alice.ID, "👍")
+	if err != nil || seq != 4 || count != 1 {
+		t.Fatalf("Remove: seq %d count %d err %v, want 4, 1, nil", seq, count, err)
+	}
+	seq, count, err = repo.Remove(message.ID, alice.ID, "👍")
+	if err != nil || seq != 0 || count != 1 {
+		t.Fatalf("repeated Remove: seq %d count %d err %v, want 0, 1, nil", seq, count, err)
+	}
+
+	var stored models.Room
+	db.First(&stored, room.ID)
+	if stored.LastSeq != 4 {
+		t.Fatalf("room last_seq = %d, want 4", stored.LastSeq)
+	}
+}
+
+func TestReactionLimitUnderConcurrency(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewReactionRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+	message := &models.Message{Content: "hi", UserID: alice.ID, RoomID: room.ID}
+	if _, err := NewMessageRepository(db).CreateIdempotent(message); err != nil {
+		t.Fatal(err)
+	}
+
+	const maxDistinct, attempts = 3, 10
+	errs := make([]error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			reaction := &models.MessageReaction{MessageID: message.ID, UserID: alice.ID, Emoji: fmt.Sprintf(":e%d:", i)}
+			_, _, errs[i] = repo.Add(reaction, maxDistinct)
+		}(i)
+	}
+	wg.Wait()
+
+	added := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			added++
+		case !errors.Is(err, ErrReactionLimit):
+			t.Fatal(err)
+		}
+	}
+	if added != maxDistinct {
+		t.Fatalf("%d distinct emoji added, want %d", added, maxDistinct)
+	}
+
+	var stored models.Room
+	db.First(&stored, room.ID)
+	if stored.LastSeq != uint64(1+maxDistinct) {
+		t.Fatalf("room last_seq = %d, want %d", stored.LastSeq, 1+maxDistinct)
+	}
+}
@@ -1,6 +1,8 @@
 package repository
 
 import (
+	"time"
+
 	"github.com/Shobayosamuel/tap-me/internal/models"
 	"gorm.io/gorm"
 )
@@ -13,6 +15,12 @@ type RoomRepository interface {
 	RemoveMember(roomID, userID uint) error
 	IsUserMember(roomID, userID uint) (bool, error)
 	GetMembers(roomID uint) ([]models.User, error)
+	GetMemberRole(roomID, userID uint) (models.MemberRole, error)
+	UpdateMemberRole(roomID, userID uint, role models.MemberRole) error
+	Update(room *models.Room) error
+	GetActivity(userID uint, unreadCap int) (map[uint]models.RoomActivity, error)
+	MarkRead(roomID, userID, messageID uint, readAt time.Time) (bool, error)
+	GetReadPositions(roomID uint) ([]models.ReadPosition, error)
 }
 
 type roomRepository struct {
@@ -119,14 +127,86 @@ func (r *roomRepository) GetMemberRole(roomID, userID uint) (models.MemberRole,
 	return member.Role, nil
 }
 
+// activityQuery loads, for each of a user's rooms, the read position, the
+// newest timeline message and the number of unread timeline messages from
+// others. Counting stops at a cap so that rooms far behind stay cheap; both
+// scans walk idx_messages_room_position.
+const activityQuery = `
+SELECT rm.room_id, rm.last_read_message_id, last.id AS last_message_id,
+	(SELECT COUNT(*) FROM (
+		SELECT 1 FROM messages m
+		WHERE m.room_id = rm.room_id
+			AND m.id > COALESCE(rm.last_read_message_id, 0)
+			AND m.user_id <> rm.user_id
+			AND m.deleted_at IS NULL
+			AND m.type <> 'system'
+			AND (m.thread_root_id IS NULL OR m.show_in_channel)
+		LIMIT ?
+	) unread) AS unread_count
+FROM room_members rm
+LEFT JOIN LATERAL (
+	SELECT m.id FROM messages m
+	WHERE m.room_id = rm.room_id
+		AND m.deleted_at IS NULL
+		AND (m.thread_root_id IS NULL OR m.show_in_channel)
+	ORDER BY m.id DESC
+	LIMIT 1
+) last ON true
+WHERE rm.user_id = ?`
+
+// GetActivity returns the activity of each room the user belongs to, keyed by
+// room ID. Unread counts stop at unreadCap.
+func (r *roomRepository) GetActivity(userID uint, unreadCap int) (map[uint]models.RoomActivity, error) {
+	var rows []models.RoomActivity
+	if err := r.db.Raw(activityQuery, unreadCap, userID).Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	activity := make(map[uint]models.RoomActivity, len(rows))
+	for _, row := range rows {
+		activity[row.RoomID] = row
+	}
+	return activity, nil
+}
+
+// MarkRead moves the member's read position forward to messageID. It reports
+// false when the position was already there or further.
+func (r *roomRepository) MarkRead(roomID, userID, messageID uint, readAt time.Time) (bool, error) {
+	result := r.db.Model(&models.RoomMember{}).
+		Where("room_id = ? AND user_id = ?", roomID, userID).
+		Where("last_read_message_id IS NULL OR last_read_message_id < ?", messageID).
+		Updates(map[string]interface{}{
+			"last_read_message_id": messageID,
+			"last_read_at":         readAt,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetReadPositions returns the read position of each member of the room who
+// has read anything.
+func (r *roomRepository) GetReadPositions(roomID uint) ([]models.ReadPosition, error) {
+	var positions []models.ReadPosition
+	err := r.db.Model(&models.RoomMember{}).
+		Select("room_id, user_id, last_read_message_id AS message_id, last_read_at AS read_at").
+		Where("room_id = ? AND last_read_message_id IS NOT NULL", roomID).
+		Scan(&positions).Error
+
+	if err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
 func (r *roomRepository) UpdateMemberRole(roomID, userID uint, role models.MemberRole) error {
 	return r.db.Model(&models.RoomMember{}).
 		Where("room_id = ? AND user_id = ?", roomID, userID).
 		Update("role", role).Error
 }
 	
+// Update saves a room's name and description. Other columns, the sequence
+// counter in particular, are left to the code that owns them.
 func (r *roomRepository) Update(room *models.Room) error {
-	return r.db.Save(room).Error
+	return r.db.Model(room).Select("name", "description").Updates(room).Error
 }
 
 func (r *roomRepository) Delete(id uint) error {
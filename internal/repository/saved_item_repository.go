@@ -0,0 +1,101 @@
+package repository
+
+import (
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type SavedItemRepository interface {
+	Create(item *models.SavedItem) (bool, error)
+	GetByID(userID, id uint) (*models.SavedItem, error)
+	GetVisible(userID, id uint) (*models.SavedItem, error)
+	GetVisibleByMessage(userID, messageID uint) (*models.SavedItem, error)
+	List(userID uint, limit, offset int) ([]models.SavedItem, error)
+	UpdateNote(item *models.SavedItem) error
+	Delete(item *models.SavedItem) error
+}
+
+type savedItemRepository struct {
+	db *gorm.DB
+}
+
+func NewSavedItemRepository(db *gorm.DB) SavedItemRepository {
+	return &savedItemRepository{db: db}
+}
+
+// Create stores a bookmark. It returns false, leaving item unsaved, if the
+// user had already saved the message.
+func (r *savedItemRepository) Create(item *models.SavedItem) (bool, error) {
+	result := r.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "message_id"}},
+		DoNothing: true,
+	}).Create(item)
+	return result.RowsAffected > 0, result.Error
+}
+
+// GetByID loads one of the user's bookmarks, visible or not.
+func (r *savedItemRepository) GetByID(userID, id uint) (*models.SavedItem, error) {
+	var item models.SavedItem
+	if err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetVisible loads one of the user's bookmarks with its message, if the user
+// can still see the message.
+func (r *savedItemRepository) GetVisible(userID, id uint) (*models.SavedItem, error) {
+	var item models.SavedItem
+	if err := r.visible(userID).Where("saved_items.id = ?", id).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetVisibleByMessage is GetVisible for the user's bookmark of a message.
+func (r *savedItemRepository) GetVisibleByMessage(userID, messageID uint) (*models.SavedItem, error) {
+	var item models.SavedItem
+	if err := r.visible(userID).Where("saved_items.message_id = ?", messageID).First(&item).Error; err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// List returns the user's visible bookmarks, most recently saved first.
+func (r *savedItemRepository) List(userID uint, limit, offset int) ([]models.SavedItem, error) {
+	var items []models.SavedItem
+
+	query := r.visible(userID).Order("saved_items.created_at DESC, saved_items.id DESC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	if err := query.Find(&items).Error; err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *savedItemRepository) UpdateNote(item *models.SavedItem) error {
+	return r.db.Model(item).Update("note", item.Note).Error
+}
+
+func (r *savedItemRepository) Delete(item *models.SavedItem) error {
+	return r.db.Delete(item).Error
+}
+
+// visible selects the user's bookmarks of live messages in rooms they still
+// belong to, with the messages loaded. Access is checked on every read, so
+// leaving a room or a message being deleted hides its bookmarks at once.
+func (r *savedItemRepository) visible(userID uint) *gorm.DB {
+	return r.db.Preload("Message.User").Preload("Message.Room").Preload("Message.Attachments").
+		Joins("JOIN messages ON messages.id = saved_items.message_id AND messages.deleted_at IS NULL").
+		Joins("JOIN room_members ON room_members.room_id = messages.room_id AND room_members.user_id = saved_items.user_id").
+		Where("saved_items.user_id = ?", userID)
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"errors"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTooManyScheduled is returned when a job would take its owner past their
+// limit of pending jobs.
+var ErrTooManyScheduled = errors.New("too many pending scheduled jobs")
+
+type ScheduledJobRepository interface {
+	Create(job *models.ScheduledJob, maxPending int) error
+	GetByID(userID, id uint) (*models.ScheduledJob, error)
+	List(userID uint, limit, offset int) ([]models.ScheduledJob, error)
+	Update(job *models.ScheduledJob, maxPending int) (bool, error)
+	Delete(userID, id uint) (bool, error)
+	FireDue(now time.Time, limit int, fire func(job *models.ScheduledJob)) ([]models.ScheduledJob, error)
+}
+
+type scheduledJobRepository struct {
+	db *gorm.DB
+}
+
+func NewScheduledJobRepository(db *gorm.DB) ScheduledJobRepository {
+	return &scheduledJobRepository{db: db}
+}
+
+// Create stores a pending job, unless its owner already has maxPending
+// pending jobs; 0 means no limit. The owner's row is locked while the jobs
+// are counted, so concurrent requests cannot overshoot the limit together.
+func (r *scheduledJobRepository) Create(job *models.ScheduledJob, maxPending int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, job.UserID); err != nil {
+			return err
+		}
+		if err := checkPending(tx, job.UserID, maxPending); err != nil {
+			return err
+		}
+		return tx.Create(job).Error
+	})
+}
+
+func (r *scheduledJobRepository) GetByID(userID, id uint) (*models.ScheduledJob, error) {
+	var job models.ScheduledJob
+	if err := r.db.Where("id = ? AND user_id = ?", id, userID).First(&job).Error; err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// List returns the user's pending and failed jobs, soonest first.
+func (r *scheduledJobRepository) List(userID uint, limit, offset int) ([]models.ScheduledJob, error) {
+	var jobs []models.ScheduledJob
+
+	query := r.db.Where("user_id = ?", userID).Order("run_at ASC, id ASC")
+
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+
+	if offset > 0 {
+		query = query.Offset(offset)
+	}
+
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Update saves a job the user changed. It returns false if the job is gone,
+// which happens when it fires while the change waits for its row lock. A
+// failed job made pending again counts towards maxPending, checked under the
+// same lock as Create.
+func (r *scheduledJobRepository) Update(job *models.ScheduledJob, maxPending int) (bool, error) {
+	updated := false
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := lockUser(tx, job.UserID); err != nil {
+			return err
+		}
+
+		var current models.ScheduledJob
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "status").
+			Where("id = ? AND user_id = ?", job.ID, job.UserID).
+			Take(&current).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if current.Status != models.ScheduledPending && job.Status == models.ScheduledPending {
+			if err := checkPending(tx, job.UserID, maxPending); err != nil {
+				return err
+			}
+		}
+
+		result := tx.Model(job).
+			Select("status", "run_at", "content", "format", "note", "attempts", "error").
+			Updates(job)
+		updated = result.RowsAffected > 0
+		return result.Error
+	})
+	return updated, err
+}
+
+// lockUser locks the user's row, which serializes the checks of their job
+// limit.
+func lockUser(tx *gorm.DB, userID uint) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id").First(&models.User{}, userID).Error
+}
+
+// checkPending fails with ErrTooManyScheduled if the user has maxPending
+// pending jobs already; 0 means no limit. The caller holds the user's lock.
+func checkPending(tx *gorm.DB, userID uint, maxPending int) error {
+	if maxPending <= 0 {
+		return nil
+	}
+	var pending int64
+	err := tx.Model(&models.ScheduledJob{}).
+		Where("user_id = ? AND status = ?", userID, models.ScheduledPending).
+		Count(&pending).Error
+	if err != nil {
+		return err
+	}
+	if pending >= int64(maxPending) {
+		return ErrTooManyScheduled
+	}
+	return nil
+}
+
+// Delete cancels a job. It returns false if the job is gone, including when
+// it fired first.
+func (r *scheduledJobRepository) Delete(userID, id uint) (bool, error) {
+	result := r.db.Where("id = ? AND user_id = ?", id, userID).Delete(&models.ScheduledJob{})
+	return result.RowsAffected > 0, result.Error
+}
+
+// FireDue claims up to limit pending jobs due by now and calls fire for each
+// one. fire leaves the job sent, failed, or pending at a later RunAt to retry;
+// sent jobs are deleted and the rest saved. The fired jobs are returned once
+// the outcome is committed.
+//
+// Claimed rows stay locked until then, and other servers skip locked rows, so
+// each job is fired by one server at a time. A server that dies mid-batch
+// releases its rows to be fired again, so fire must be safe to repeat.
+func (r *scheduledJobRepository) FireDue(now time.Time, limit int, fire func(job *models.ScheduledJob)) ([]models.ScheduledJob, error) {
+	var jobs []models.ScheduledJob
+	err := r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND run_at <= ?", models.ScheduledPending, now).
+			Order("run_at ASC, id ASC").
+			Limit(limit).
+			Find(&jobs).Error; err != nil {
+			return err
+		}
+
+		for i := range jobs {
+			job := &jobs[i]
+			fire(job)
+
+			if job.Status == models.ScheduledSent {
+				if err := tx.Delete(&models.ScheduledJob{}, job.ID).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := tx.Model(job).Select("status", "run_at", "attempts", "error").Updates(job).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+func TestScheduledJobLimit(t *testing.T) {
+	db := openTestDB(t)
+	repo := NewScheduledJobRepository(db)
+	alice := createTestUser(t, db, "alice")
+	room := createTestRoom(t, db, alice)
+	newJob := func() *models.ScheduledJob {
+		return &models.ScheduledJob{UserID: alice.ID, Kind: models.ScheduledMessage, Status: models.ScheduledPending,
+			RunAt: time.Now().Add(time.Hour), RoomID: room.ID, Content: "later"}
+	}
+
+	// Concurrent requests cannot overshoot the limit together
+	const limit = 2
+	errs := make([]error, 6)
+	var wg sync.WaitGroup
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = repo.Create(newJob(), limit)
+		}(i)
+	}
+	wg.Wait()
+	created := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			created++
+		case !errors.Is(err, ErrTooManyScheduled):
+			t.Fatal(err)
+		}
+	}
+	if created != limit {
+		t.Fatalf("created %d jobs, want %d", created, limit)
+	}
+
+	// A failed job cannot be made pending again while the user is at the limit
+	failed := newJob()
+	failed.Status = models.ScheduledFailed
+	if err := repo.Create(failed, 0); err != nil {
+		t.Fatal(err)
+	}
+	failed.Status = models.ScheduledPending
+	if _, err := repo.Update(failed, limit); !errors.Is(err, ErrTooManyScheduled) {
+		t.Fatalf("retrying a failed job at the limit: err = %v, want ErrTooManyScheduled", err)
+	}
+
+	jobs, err := repo.List(alice.ID, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := jobs[0]
+	pending.Content = "edited"
+	if updated, err := repo.Update(&pending, limit); err != nil || !updated {
+		t.Fatalf("editing a pending job at the limit: updated %v, err %v", updated, err)
+	}
+	if _, err := repo.Delete(alice.ID, pending.ID); err != nil {
+		t.Fatal(err)
+	}
+	if updated, err := repo.Update(failed, limit); err != nil || !updated {
+		t.Fatalf("retrying a failed job below the limit: updated %v, err %v", updated, err)
+	}
+}
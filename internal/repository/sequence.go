@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+)
+
+// nextSeq allocates the room's next sequence number. The room row stays
+// locked until tx ends, so changes to one room commit in sequence order and
+// a reader that sees rooms.last_seq = N can also see every change up to N.
+func nextSeq(tx *gorm.DB, roomID uint) (uint64, error) {
+	var seq uint64
+	err := tx.Session(&gorm.Session{NewDB: true}).
+		Raw("UPDATE rooms SET last_seq = last_seq + 1 WHERE id = ? RETURNING last_seq", roomID).
+		Scan(&seq).Error
+	return seq, err
+}
+
+// touchMessage records that the change numbered seq modified a message, so
+// that syncing from an earlier seq returns it again.
+func touchMessage(tx *gorm.DB, messageID uint, seq uint64) error {
+	return tx.Session(&gorm.Session{NewDB: true}).
+		Exec("UPDATE messages SET updated_seq = ? WHERE id = ?", seq, messageID).Error
+}
+
+// BackfillSequences numbers the messages of rooms that predate sequence
+// numbers, in timeline order. Rooms that already have a sequence are left
+// alone, so it is safe to run on every start.
+func BackfillSequences(db *gorm.DB) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec(`
+UPDATE messages SET seq = numbered.seq, updated_seq = numbered.seq
+FROM (
+	SELECT id, ROW_NUMBER() OVER (PARTITION BY room_id ORDER BY created_at, id) AS seq
+	FROM messages
+	WHERE room_id IN (SELECT id FROM rooms WHERE last_seq = 0)
+) numbered
+WHERE messages.id = numbered.id`).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Exec(`
+UPDATE rooms SET last_seq = (SELECT COALESCE(MAX(seq), 0) FROM messages WHERE messages.room_id = rooms.id)
+WHERE last_seq = 0`).Error
+	})
+}
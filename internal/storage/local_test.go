@@ -0,0 +1,94 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalStorePathRejectsTraversal(t *testing.T) {
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "/", "..", "../x", "a/../../x", "a/..", "..\\x", "a/b/../../../etc/passwd"} {
+		if path, err := store.path(key); err == nil {
+			t.Errorf("path(%q) = %q, want an error", key, path)
+		}
+	}
+
+	for key, want := range map[string]string{
+		"a":                "a",
+		"attachments/1/ab": "attachments/1/ab",
+		"/abs/key":         "abs/key",
+		"a//b/./c":         "a/b/c",
+	} {
+		path, err := store.path(key)
+		if err != nil {
+			t.Errorf("path(%q): %v", key, err)
+			continue
+		}
+		if rel, _ := filepath.Rel(store.root, path); filepath.ToSlash(rel) != want {
+			t.Errorf("path(%q) = %q, want %q under the root", key, path, want)
+		}
+	}
+}
+
+func TestLocalStoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	store, err := NewLocalStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "attachments/1/ab", strings.NewReader("hello"), 5, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	body, err := store.Get(ctx, "attachments/1/ab")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("Get = %q, %v; want %q", data, err, "hello")
+	}
+
+	if err := store.Delete(ctx, "attachments/1/ab"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "attachments/1/ab"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, "attachments/1/ab"); err != nil {
+		t.Fatalf("Delete of a missing blob: %v", err)
+	}
+}
+
+func TestLocalStorePutRejectsShortBody(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	store, err := NewLocalStore(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(ctx, "a/b", strings.NewReader("short"), 10, ""); err == nil {
+		t.Fatal("Put accepted a body shorter than its size")
+	}
+	if _, err := store.Get(ctx, "a/b"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after a failed Put: err = %v, want ErrNotFound", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(root, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("failed Put left %d files behind", len(entries))
+	}
+}
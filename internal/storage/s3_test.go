@@ -0,0 +1,231 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeS3 is an in-memory stand-in for an S3 bucket addressed path-style. It
+// checks every request's Signature Version 4 against its own computation.
+type fakeS3 struct {
+	t         *testing.T
+	accessKey string
+	secretKey string
+	region    string
+
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	data        []byte
+	contentType string
+}
+
+var authorizationHeader = regexp.MustCompile(`^AWS4-HMAC-SHA256 Credential=([^/]+)/(\d{8})/([^/]+)/s3/aws4_request, SignedHeaders=([a-z0-9;-]+), Signature=([0-9a-f]{64})$`)
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		f.t.Errorf("%s %s: %v", r.Method, r.URL.Path, err)
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	switch r.Method {
+	case http.MethodPut:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f.objects[r.URL.Path] = fakeObject{data: data, contentType: r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		object, ok := f.objects[r.URL.Path]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.data)
+	case http.MethodDelete:
+		delete(f.objects, r.URL.Path)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unsupported", http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeS3) verify(r *http.Request) error {
+	match := authorizationHeader.FindStringSubmatch(r.Header.Get("Authorization"))
+	if match == nil {
+		return errors.New("malformed Authorization header")
+	}
+	accessKey, day, region, signedHeaders, signature := match[1], match[2], match[3], match[4], match[5]
+	if accessKey != f.accessKey || region != f.region {
+		return errors.New("wrong credential scope")
+	}
+	amzDate := r.Header.Get("X-Amz-Date")
+	if !strings.HasPrefix(amzDate, day) {
+		return errors.New("X-Amz-Date does not match the credential scope")
+	}
+
+	var canonicalHeaders strings.Builder
+	for _, name := range strings.Split(signedHeaders, ";") {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+	if !strings.Contains(";"+signedHeaders+";", ";host;") {
+		return errors.New("host is not signed")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + day + "/" + region + "/s3/aws4_request\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + f.secretKey)
+	for _, part := range []string{day, region, "s3", "aws4_request", stringToSign} {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(part))
+		key = mac.Sum(nil)
+	}
+	if hex.EncodeToString(key) != signature {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *S3Store) {
+	t.Helper()
+	fake := &fakeS3{t: t, accessKey: "AKID", secretKey: "secret", region: "eu-west-1", objects: map[string]fakeObject{}}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3Store(S3Config{
+		Endpoint:  server.URL,
+		Region:    fake.region,
+		Bucket:    "uploads",
+		AccessKey: fake.accessKey,
+		SecretKey: fake.secretKey,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fake, store
+}
+
+func TestS3StoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	fake, store := newFakeS3(t)
+
+	key := "attachments/7/0a1b_320x240"
+	if err := store.Put(ctx, key, strings.NewReader("image bytes"), 11, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	fake.mu.Lock()
+	object, ok := fake.objects["/uploads/"+key]
+	fake.mu.Unlock()
+	if !ok {
+		t.Fatal("object not stored under the bucket path")
+	}
+	if object.contentType != "image/png" {
+		t.Errorf("stored content type = %q, want image/png", object.contentType)
+	}
+
+	body, err := store.Get(ctx, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(data) != "image bytes" {
+		t.Fatalf("Get = %q, %v; want %q", data, err, "image bytes")
+	}
+
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, key); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := store.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete of a missing object: %v", err)
+	}
+}
+
+func TestS3StoreReportsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	store, err := NewS3Store(S3Config{Endpoint: server.URL, Bucket: "uploads", PathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Put(context.Background(), "a", strings.NewReader("x"), 1, "")
+	if err == nil || !strings.Contains(err.Error(), "403") || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Fatalf("Put against a refusing bucket: err = %v", err)
+	}
+	if errors.Is(err, ErrNotFound) {
+		t.Fatal("a refusal was reported as ErrNotFound")
+	}
+}
+
+func TestS3StoreAddressing(t *testing.T) {
+	tests := []struct {
+		pathStyle bool
+		endpoint  string
+		want      string
+	}{
+		{true, "https://minio.local:9000", "https://minio.local:9000/uploads/a/b"},
+		{true, "https://minio.local:9000/prefix/", "https://minio.local:9000/prefix/uploads/a/b"},
+		{false, "https://s3.eu-west-1.amazonaws.com", "https://uploads.s3.eu-west-1.amazonaws.com/a/b"},
+	}
+	for _, tt := range tests {
+		store, err := NewS3Store(S3Config{Endpoint: tt.endpoint, Bucket: "uploads", PathStyle: tt.pathStyle})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req, err := store.request(context.Background(), http.MethodGet, "a/b", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := req.URL.String(); got != tt.want {
+			t.Errorf("request URL for %s (path style %v) = %q, want %q", tt.endpoint, tt.pathStyle, got, tt.want)
+		}
+	}
+}
+
+func TestNewS3StoreValidatesConfig(t *testing.T) {
+	for _, cfg := range []S3Config{
+		{Endpoint: "", Bucket: "uploads"},
+		{Endpoint: "not a url", Bucket: "uploads"},
+		{Endpoint: "https://minio.local"},
+	} {
+		if _, err := NewS3Store(cfg); err == nil {
+			t.Errorf("NewS3Store(%+v) accepted an invalid config", cfg)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// URLSigner issues and checks expiring download URLs for stored files. A
+// URL is only handed to users allowed to see the file, and works for
+// anyone holding it until it expires.
+type URLSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+func NewURLSigner(secret string, ttl time.Duration) *URLSigner {
+	return &URLSigner{secret: []byte(secret), ttl: ttl}
+}
+
+// Sign returns a download URL for the file with the given ID.
+func (s *URLSigner) Sign(id uint) string {
+	expires := strconv.FormatInt(time.Now().Add(s.ttl).Unix(), 10)
+	return "/files/" + strconv.FormatUint(uint64(id), 10) + "?expires=" + expires + "&signature=" + s.signature(id, expires)
+}
+
+// Verify reports whether signature is valid for the file and has not expired.
+func (s *URLSigner) Verify(id uint, expires, signature string) bool {
+	at, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > at {
+		return false
+	}
+	return hmac.Equal([]byte(signature), []byte(s.signature(id, expires)))
+}
+
+func (s *URLSigner) signature(id uint, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(strconv.FormatUint(uint64(id), 10) + ":" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
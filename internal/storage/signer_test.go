@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// parseSigned splits a URL issued by Sign into its expiry and signature.
+func parseSigned(t *testing.T, signed string) (string, string) {
+	t.Helper()
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query().Get("expires"), u.Query().Get("signature")
+}
+
+func TestURLSignerAcceptsOwnURL(t *testing.T) {
+	signer := NewURLSigner("secret", time.Minute)
+	signed := signer.Sign(42)
+
+	if want := "/files/42?"; signed[:len(want)] != want {
+		t.Fatalf("Sign(42) = %q, want prefix %q", signed, want)
+	}
+	expires, signature := parseSigned(t, signed)
+	if !signer.Verify(42, expires, signature) {
+		t.Fatalf("Verify rejected a fresh URL %q", signed)
+	}
+}
+
+func TestURLSignerRejectsTampering(t *testing.T) {
+	signer := NewURLSigner("secret", time.Minute)
+	expires, signature := parseSigned(t, signer.Sign(42))
+	at, _ := strconv.ParseInt(expires, 10, 64)
+	flipped := []byte(signature)
+	flipped[0] ^= 1
+
+	tests := []struct {
+		name      string
+		signer    *URLSigner
+		id        uint
+		expires   string
+		signature string
+	}{
+		{"other file", signer, 43, expires, signature},
+		{"extended expiry", signer, 42, strconv.FormatInt(at+3600, 10), signature},
+		{"changed signature", signer, 42, expires, string(flipped)},
+		{"empty signature", signer, 42, expires, ""},
+		{"malformed expiry", signer, 42, expires + "x", signature},
+		{"other secret", NewURLSigner("other", time.Minute), 42, expires, signature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.signer.Verify(tt.id, tt.expires, tt.signature) {
+				t.Error("Verify accepted a tampered URL")
+			}
+		})
+	}
+}
+
+func TestURLSignerRejectsExpired(t *testing.T) {
+	signer := NewURLSigner("secret", -time.Second)
+	expires, signature := parseSigned(t, signer.Sign(42))
+	if signer.Verify(42, expires, signature) {
+		t.Fatal("Verify accepted an expired URL")
+	}
+}
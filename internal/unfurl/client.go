@@ -0,0 +1,99 @@
+package unfurl
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// ErrBlockedAddress is returned when a link resolves to an address the
+// fetcher must not reach, such as a private network or the server itself.
+var ErrBlockedAddress = errors.New("address not allowed")
+
+const maxRedirects = 5
+
+// blockedPrefixes are ranges outside the public internet that the standard
+// library's classifications do not already cover.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64, can reach IPv4 private ranges
+	netip.MustParsePrefix("64:ff9b:1::/48"),
+	netip.MustParsePrefix("2002::/16"), // 6to4, embeds an IPv4 address
+	netip.MustParsePrefix("2001::/32"), // Teredo, likewise
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// NewSafeClient returns an HTTP client for fetching user-supplied links. The
+// address of every connection it opens, redirects included, is checked after
+// DNS resolution, so neither a redirect nor a DNS record pointing inside the
+// network can make it reach private services. Only ports 80 and 443 are
+// allowed and proxies from the environment are ignored.
+func NewSafeClient(timeout time.Duration) *http.Client {
+	return newClient(timeout, checkAddress)
+}
+
+// newClient builds the client with control vetting each connection, which
+// tests relax to reach a local server.
+func newClient(timeout time.Duration, control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: control,
+	}
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          20,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &http.Client{
+		Transport: transport,
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return ErrBlockedAddress
+			}
+			return nil
+		},
+	}
+}
+
+// checkAddress runs just before each connection is made, with the resolved
+// address being dialled.
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return ErrBlockedAddress
+	}
+	if port := addrPort.Port(); port != 80 && port != 443 {
+		return ErrBlockedAddress
+	}
+	if !isPublic(addrPort.Addr()) {
+		return ErrBlockedAddress
+	}
+	return nil
+}
+
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
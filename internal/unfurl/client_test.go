@@ -0,0 +1,116 @@
+package unfurl
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:80", true},
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"93.184.216.34:8080", false},
+		{"93.184.216.34:22", false},
+		{"127.0.0.1:80", false},
+		{"169.254.169.254:80", false},
+		{"10.1.2.3:443", false},
+		{"172.16.0.1:443", false},
+		{"192.168.1.1:80", false},
+		{"100.64.0.1:80", false},
+		{"0.0.0.0:80", false},
+		{"[::1]:443", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"[::ffff:169.254.169.254]:80", false},
+		{"[fe80::1]:80", false},
+		{"[fd00::1]:443", false},
+		{"[64:ff9b::a00:1]:80", false},
+		{"[2002:a00:1::1]:80", false},
+		{"[2002:7f00:1::]:443", false},
+		{"[2001:0:4136:e378:8000:63bf:f5ff:fffe]:443", false},
+		{"[2001::1]:80", false},
+		{"not-an-address", false},
+	}
+	for _, tt := range tests {
+		err := checkAddress("tcp", tt.address, nil)
+		if tt.allowed && err != nil {
+			t.Errorf("checkAddress(%q) = %v, want allowed", tt.address, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("checkAddress(%q) = %v, want ErrBlockedAddress", tt.address, err)
+		}
+	}
+}
+
+func TestSafeClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("request reached the local server")
+	}))
+	defer server.Close()
+
+	_, err := NewSafeClient(time.Second).Get(server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Fatalf("Get(%s) = %v, want ErrBlockedAddress", server.URL, err)
+	}
+}
+
+// allowServer returns a client that may reach server, standing in for a
+// public site, but checks every other address as NewSafeClient does.
+func allowServer(server *httptest.Server) *http.Client {
+	host := server.Listener.Addr().String()
+	return newClient(time.Second, func(network, address string, c syscall.RawConn) error {
+		if address == host {
+			return nil
+		}
+		return checkAddress(network, address, c)
+	})
+}
+
+func TestSafeClientBlocksRedirectsInside(t *testing.T) {
+	targets := []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1/",
+		"http://[::1]/admin",
+		"http://10.0.0.5:443/",
+		"http://93.184.216.34:6379/",
+		"ftp://93.184.216.34/",
+	}
+	for _, target := range targets {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target, http.StatusFound)
+		}))
+
+		_, err := allowServer(server).Get(server.URL)
+		var urlErr *url.Error
+		if err == nil || !errors.As(err, &urlErr) {
+			t.Errorf("redirect to %s: got %v, want a blocked request", target, err)
+		} else if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("redirect to %s: got %v, want ErrBlockedAddress", target, err)
+		}
+		server.Close()
+	}
+}
+
+func TestSafeClientCapsRedirects(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, "/again", http.StatusFound)
+	}))
+	defer server.Close()
+
+	if _, err := allowServer(server).Get(server.URL); err == nil {
+		t.Fatal("endless redirects were followed without error")
+	}
+	if requests != maxRedirects {
+		t.Errorf("server saw %d requests, want %d", requests, maxRedirects)
+	}
+}
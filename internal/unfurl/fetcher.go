@@ -0,0 +1,215 @@
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"golang.org/x/net/html"
+)
+
+const (
+	maxPageBytes   = 512 << 10 // metadata lives in <head>, near the top
+	maxOEmbedBytes = 64 << 10
+	maxTitle       = 300
+	maxDescription = 500
+	userAgent      = "tap-me-unfurl/1.0 (link previews)"
+)
+
+// ErrNoPreview is returned for pages that have nothing to preview.
+var ErrNoPreview = errors.New("no preview available")
+
+// HTTPFetcher builds previews from a page's OpenGraph and Twitter card tags,
+// filling gaps from its oEmbed endpoint when the page advertises one.
+type HTTPFetcher struct {
+	client *http.Client
+}
+
+// NewHTTPFetcher returns a fetcher using client, which should come from
+// NewSafeClient outside of tests.
+func NewHTTPFetcher(client *http.Client) *HTTPFetcher {
+	return &HTTPFetcher{client: client}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (*models.LinkPreview, error) {
+	resp, err := f.get(ctx, rawURL, "text/html,application/xhtml+xml")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, ErrNoPreview
+	}
+
+	page := parseHead(io.LimitReader(resp.Body, maxPageBytes))
+
+	// Relative links resolve against where redirects ended up
+	base := resp.Request.URL
+	preview := &models.LinkPreview{
+		URL:         rawURL,
+		Title:       firstOf(page.meta["og:title"], page.meta["twitter:title"], page.title),
+		Description: firstOf(page.meta["og:description"], page.meta["twitter:description"], page.meta["description"]),
+		SiteName:    page.meta["og:site_name"],
+		Type:        page.meta["og:type"],
+		ImageURL:    resolve(base, firstOf(page.meta["og:image"], page.meta["og:image:url"], page.meta["twitter:image"])),
+	}
+
+	if page.oembed != "" && (preview.Title == "" || preview.ImageURL == "" || preview.SiteName == "") {
+		if embed, err := f.fetchOEmbed(ctx, resolve(base, page.oembed)); err == nil {
+			preview.Title = firstOf(preview.Title, embed.Title)
+			preview.SiteName = firstOf(preview.SiteName, embed.ProviderName)
+			preview.ImageURL = firstOf(preview.ImageURL, resolve(base, embed.ThumbnailURL))
+			preview.Type = firstOf(preview.Type, embed.Type)
+		}
+	}
+
+	preview.Title = truncate(preview.Title, maxTitle)
+	preview.Description = truncate(preview.Description, maxDescription)
+	preview.SiteName = truncate(preview.SiteName, maxTitle)
+	if preview.Title == "" && preview.Description == "" && preview.ImageURL == "" {
+		return nil, ErrNoPreview
+	}
+	return preview, nil
+}
+
+// oEmbed holds the oEmbed response fields previews use. The embeddable HTML
+// is ignored: it would run third-party markup in clients.
+type oEmbed struct {
+	Type         string `json:"type"`
+	Title        string `json:"title"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+func (f *HTTPFetcher) fetchOEmbed(ctx context.Context, endpoint string) (*oEmbed, error) {
+	if endpoint == "" {
+		return nil, ErrNoPreview
+	}
+	resp, err := f.get(ctx, endpoint, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var embed oEmbed
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOEmbedBytes)).Decode(&embed); err != nil {
+		return nil, err
+	}
+	return &embed, nil
+}
+
+func (f *HTTPFetcher) get(ctx context.Context, rawURL, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, ErrBlockedAddress
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", accept)
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("fetching %s: %s", rawURL, resp.Status)
+	}
+	return resp, nil
+}
+
+// head is the metadata read from a page's <head>.
+type head struct {
+	title  string
+	meta   map[string]string // first value of each property or name
+	oembed string            // JSON oEmbed discovery link
+}
+
+// parseHead reads metadata up to the end of <head>; the body is never
+// parsed.
+func parseHead(r io.Reader) *head {
+	page := &head{meta: map[string]string{}}
+	z := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			// End of input, or of the part of the page that was read
+			return page
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				attrs[string(key)] = string(val)
+			}
+			switch string(name) {
+			case "body":
+				return page
+			case "title":
+				inTitle = page.title == ""
+			case "meta":
+				key := strings.ToLower(firstOf(attrs["property"], attrs["name"]))
+				if key != "" && page.meta[key] == "" {
+					page.meta[key] = strings.TrimSpace(attrs["content"])
+				}
+			case "link":
+				if strings.EqualFold(attrs["type"], "application/json+oembed") && page.oembed == "" {
+					page.oembed = attrs["href"]
+				}
+			}
+		case html.TextToken:
+			if inTitle {
+				page.title = strings.TrimSpace(string(z.Text()))
+				inTitle = false
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "head" {
+				return page
+			}
+		}
+	}
+}
+
+// resolve makes ref absolute against base, keeping only http(s) results.
+func resolve(base *url.URL, ref string) string {
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func truncate(s string, limit int) string {
+	s = strings.ToValidUTF8(strings.TrimSpace(s), "")
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit-1]) + "…"
+}
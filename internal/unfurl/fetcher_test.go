@@ -0,0 +1,148 @@
+package unfurl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestFetchReadsOpenGraph(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head>
+			<title>Fallback title</title>
+			<meta property="og:title" content=" The Title ">
+			<meta name="description" content="A page">
+			<meta property="og:site_name" content="Example">
+			<meta property="og:image" content="/img/cover.png">
+			</head><body><meta property="og:type" content="ignored"></body></html>`)
+	}))
+	defer server.Close()
+
+	preview, err := NewHTTPFetcher(server.Client()).Fetch(context.Background(), server.URL+"/post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.URL != server.URL+"/post" {
+		t.Errorf("URL = %q", preview.URL)
+	}
+	if preview.Title != "The Title" || preview.Description != "A page" || preview.SiteName != "Example" {
+		t.Errorf("got %+v", preview)
+	}
+	if preview.ImageURL != server.URL+"/img/cover.png" {
+		t.Errorf("ImageURL = %q, want it resolved against the page", preview.ImageURL)
+	}
+	if preview.Type != "" {
+		t.Errorf("Type = %q, read from the body", preview.Type)
+	}
+}
+
+func TestFetchFillsGapsFromOEmbed(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/video", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<head><link rel="alternate" type="application/json+oembed" href="/oembed?id=1"></head>`)
+	})
+	mux.HandleFunc("/oembed", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"type":"video","title":"Clip","provider_name":"Tube","thumbnail_url":"/t.jpg","html":"<script>x</script>"}`)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	preview, err := NewHTTPFetcher(server.Client()).Fetch(context.Background(), server.URL+"/video")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Title != "Clip" || preview.SiteName != "Tube" || preview.Type != "video" || preview.ImageURL != server.URL+"/t.jpg" {
+		t.Errorf("got %+v", preview)
+	}
+}
+
+func TestFetchWithoutPreview(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"not html", "image/png", "\x89PNG", http.StatusOK},
+		{"no metadata", "text/html", "<html><head></head><body>Hi</body></html>", http.StatusOK},
+		{"error status", "text/html", "<title>Not found</title>", http.StatusNotFound},
+		{
+			// Metadata past the read limit is never seen
+			"metadata too far in", "text/html",
+			"<head><!--" + strings.Repeat("x", maxPageBytes) + "--><title>Late</title></head>", http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.WriteHeader(tt.status)
+				fmt.Fprint(w, tt.body)
+			}))
+			defer server.Close()
+
+			preview, err := NewHTTPFetcher(server.Client()).Fetch(context.Background(), server.URL)
+			if err == nil {
+				t.Fatalf("got preview %+v, want none", preview)
+			}
+		})
+	}
+}
+
+func TestFetchStopsReadingLargePages(t *testing.T) {
+	// The head never ends; only the read limit lets the fetch finish
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<head><title>Big</title>")
+		chunk := strings.Repeat("<meta name=x content=y>", 1000)
+		for {
+			if _, err := fmt.Fprint(w, chunk); err != nil {
+				return
+			}
+		}
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	preview, err := NewHTTPFetcher(server.Client()).Fetch(ctx, server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Title != "Big" {
+		t.Errorf("Title = %q", preview.Title)
+	}
+}
+
+func TestFetchTruncatesLongText(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<head><meta property="og:title" content="%s"></head>`, strings.Repeat("é", 2*maxTitle))
+	}))
+	defer server.Close()
+
+	preview, err := NewHTTPFetcher(server.Client()).Fetch(context.Background(), server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := utf8.RuneCountInString(preview.Title); n != maxTitle || !strings.HasSuffix(preview.Title, "…") {
+		t.Errorf("title has %d characters: %q", n, preview.Title)
+	}
+}
+
+func TestFetchRejectsOtherSchemes(t *testing.T) {
+	for _, link := range []string{"file:///etc/passwd", "gopher://example.com/", "javascript:alert(1)"} {
+		if _, err := NewHTTPFetcher(http.DefaultClient).Fetch(context.Background(), link); !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Fetch(%q) = %v, want ErrBlockedAddress", link, err)
+		}
+	}
+}
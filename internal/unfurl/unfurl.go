@@ -0,0 +1,110 @@
+// Package unfurl builds previews of links posted in messages.
+package unfurl
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+// Fetcher builds the preview of a single link. HTTPFetcher is the real one;
+// tests can supply their own or point an HTTPFetcher at a local server.
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) (*models.LinkPreview, error)
+}
+
+// failureTTL is how long a link that could not be previewed is remembered,
+// so a popular broken link is not fetched for every message.
+const failureTTL = 5 * time.Minute
+
+// Unfurler fetches link previews through a Fetcher, caching the results.
+type Unfurler struct {
+	fetcher Fetcher
+	ttl     time.Duration
+	size    int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+}
+
+type cacheEntry struct {
+	url     string
+	preview *models.LinkPreview // nil if the link had no preview
+	expires time.Time
+}
+
+// New returns an Unfurler keeping up to size previews for ttl.
+func New(fetcher Fetcher, ttl time.Duration, size int) *Unfurler {
+	return &Unfurler{
+		fetcher: fetcher,
+		ttl:     ttl,
+		size:    size,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// Unfurl returns the preview of url, or nil if it has none or could not be
+// fetched.
+func (u *Unfurler) Unfurl(ctx context.Context, url string) *models.LinkPreview {
+	if preview, ok := u.cached(url); ok {
+		return preview
+	}
+
+	preview, err := u.fetcher.Fetch(ctx, url)
+	if err != nil {
+		// Failures from the caller giving up are not the link's fault
+		if ctx.Err() == nil {
+			u.store(url, nil, failureTTL)
+		}
+		return nil
+	}
+	u.store(url, preview, u.ttl)
+
+	copied := *preview
+	return &copied
+}
+
+func (u *Unfurler) cached(url string) (*models.LinkPreview, bool) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	el, ok := u.entries[url]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		u.order.Remove(el)
+		delete(u.entries, url)
+		return nil, false
+	}
+	u.order.MoveToFront(el)
+	if entry.preview == nil {
+		return nil, true
+	}
+	preview := *entry.preview
+	return &preview, true
+}
+
+func (u *Unfurler) store(url string, preview *models.LinkPreview, ttl time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	entry := &cacheEntry{url: url, preview: preview, expires: time.Now().Add(ttl)}
+	if el, ok := u.entries[url]; ok {
+		el.Value = entry
+		u.order.MoveToFront(el)
+		return
+	}
+	u.entries[url] = u.order.PushFront(entry)
+	for u.order.Len() > u.size {
+		oldest := u.order.Back()
+		u.order.Remove(oldest)
+		delete(u.entries, oldest.Value.(*cacheEntry).url)
+	}
+}
@@ -0,0 +1,109 @@
+package unfurl
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+// stubFetcher counts fetches and answers from a fixed map; missing links fail.
+type stubFetcher struct {
+	previews map[string]*models.LinkPreview
+	fetches  map[string]int
+}
+
+func newStubFetcher(previews map[string]*models.LinkPreview) *stubFetcher {
+	return &stubFetcher{previews: previews, fetches: map[string]int{}}
+}
+
+func (f *stubFetcher) Fetch(ctx context.Context, url string) (*models.LinkPreview, error) {
+	f.fetches[url]++
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if preview, ok := f.previews[url]; ok {
+		copied := *preview
+		return &copied, nil
+	}
+	return nil, ErrNoPreview
+}
+
+func TestUnfurlCachesPreviews(t *testing.T) {
+	fetcher := newStubFetcher(map[string]*models.LinkPreview{
+		"https://a.example/": {URL: "https://a.example/", Title: "A"},
+	})
+	u := New(fetcher, time.Hour, 10)
+
+	first := u.Unfurl(context.Background(), "https://a.example/")
+	first.Title = "changed by a caller"
+	second := u.Unfurl(context.Background(), "https://a.example/")
+
+	if second == nil || second.Title != "A" {
+		t.Fatalf("second Unfurl = %+v, want the cached preview unchanged", second)
+	}
+	if n := fetcher.fetches["https://a.example/"]; n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+}
+
+func TestUnfurlCachesFailures(t *testing.T) {
+	fetcher := newStubFetcher(nil)
+	u := New(fetcher, time.Hour, 10)
+
+	for i := 0; i < 3; i++ {
+		if preview := u.Unfurl(context.Background(), "https://broken.example/"); preview != nil {
+			t.Fatalf("got %+v for a link without preview", preview)
+		}
+	}
+	if n := fetcher.fetches["https://broken.example/"]; n != 1 {
+		t.Errorf("fetched %d times, want 1", n)
+	}
+
+	// Once the failure expires the link is tried again
+	u.entries["https://broken.example/"].Value.(*cacheEntry).expires = time.Now().Add(-time.Second)
+	u.Unfurl(context.Background(), "https://broken.example/")
+	if n := fetcher.fetches["https://broken.example/"]; n != 2 {
+		t.Errorf("fetched %d times after the failure expired, want 2", n)
+	}
+}
+
+func TestUnfurlDoesNotCacheCancelledFetches(t *testing.T) {
+	fetcher := newStubFetcher(map[string]*models.LinkPreview{
+		"https://slow.example/": {URL: "https://slow.example/", Title: "Slow"},
+	})
+	u := New(fetcher, time.Hour, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if preview := u.Unfurl(ctx, "https://slow.example/"); preview != nil {
+		t.Fatalf("got %+v from a cancelled fetch", preview)
+	}
+
+	preview := u.Unfurl(context.Background(), "https://slow.example/")
+	if preview == nil || preview.Title != "Slow" {
+		t.Errorf("got %+v, want the preview once the caller did not give up", preview)
+	}
+}
+
+func TestUnfurlEvictsLeastRecentlyUsed(t *testing.T) {
+	fetcher := newStubFetcher(map[string]*models.LinkPreview{
+		"https://1.example/": {Title: "1"},
+		"https://2.example/": {Title: "2"},
+		"https://3.example/": {Title: "3"},
+	})
+	u := New(fetcher, time.Hour, 2)
+	ctx := context.Background()
+
+	u.Unfurl(ctx, "https://1.example/")
+	u.Unfurl(ctx, "https://2.example/")
+	u.Unfurl(ctx, "https://1.example/") // 2 is now the oldest
+	u.Unfurl(ctx, "https://3.example/")
+	u.Unfurl(ctx, "https://1.example/")
+	u.Unfurl(ctx, "https://2.example/")
+
+	if fetcher.fetches["https://1.example/"] != 1 || fetcher.fetches["https://2.example/"] != 2 {
+		t.Errorf("fetches = %v, want 1 kept and 2 evicted", fetcher.fetches)
+	}
+}
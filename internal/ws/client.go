@@ -6,6 +6,7 @@ import (
 	"net/http"
 
 	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/gorilla/websocket"
 	"encoding/json"
 	"log"
@@ -21,8 +22,11 @@ const (
 	// Send pings to peer with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
 
-	// Maximum message size allowed from peer.
-	maxMessageSize = 512
+	// Maximum message size allowed from peer. The largest valid command is a
+	// send_message with 1000 characters of content and a poll of 300 for the
+	// question and 10 options of 100; at up to 6 bytes a character once JSON
+	// escaped, that fits with room for the other fields.
+	maxMessageSize = 16 << 10
 )
 
 var Upgrader = websocket.Upgrader{
@@ -44,34 +48,19 @@ type Client struct {
 	send chan []byte
 	user *models.User
 	rooms map[uint]bool
-}
-
-// Incoming message structure
-type WSMessage struct {
-	Type    string      `json:"type"`
-	RoomID  uint        `json:"room_id,omitempty"`
-	Content string      `json:"content,omitempty"`
-	Data    interface{} `json:"data,omitempty"`
-}
 
-// outgoing message structure
-type WSResponse struct {
-	Type      string        `json:"type"`
-	RoomID    uint          `json:"room_id,omitempty"`
-	Message   *models.Message `json:"message,omitempty"`
-	User      *models.User    `json:"user,omitempty"`
-	Content   string        `json:"content,omitempty"`
-	Error     string        `json:"error,omitempty"`
-	Timestamp time.Time     `json:"timestamp"`
+	// Negotiated protocol version.
+	protocol string
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, user *models.User) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, user *models.User, protocol string) *Client {
 	return &Client{
-		hub:   hub,
-		conn:  conn,
-		send:  make(chan []byte, 256),
-		user:  user,
-		rooms: make(map[uint]bool),
+		hub:      hub,
+		conn:     conn,
+		send:     make(chan []byte, 256),
+		user:     user,
+		rooms:    make(map[uint]bool),
+		protocol: protocol,
 	}
 }
 
@@ -103,7 +92,7 @@ func (c *Client) ReadPump() {
 			continue
 		}
 
-		c.handleMessage(wsMsg)
+		c.handleMessage(wsMsg, messageBytes)
 	}
 }
 
@@ -149,53 +138,150 @@ func (c *Client) WritePump() {
 	}
 }
 
-func (c *Client) handleMessage(wsMsg WSMessage) {
+func (c *Client) handleMessage(wsMsg WSMessage, raw []byte) {
 	switch wsMsg.Type {
-	case "join_room":
-		c.hub.joinRoom <- &JoinRoomRequest{
-			Client: c,
-			RoomID: wsMsg.RoomID,
+	case CommandJoinRoom:
+		var cmd JoinRoomCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleJoinRoom(&JoinRoomRequest{
+				Client:    c,
+				RoomID:    cmd.RoomID,
+				RequestID: cmd.RequestID,
+			})
 		}
-	case "leave_room":
-		c.hub.leaveRoom <- &LeaveRoomRequest{
-			Client: c,
-			RoomID: wsMsg.RoomID,
+	case CommandLeaveRoom:
+		var cmd LeaveRoomCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.leaveRoom <- &LeaveRoomRequest{
+				Client:    c,
+				RoomID:    cmd.RoomID,
+				RequestID: cmd.RequestID,
+			}
+		}
+	case CommandSendMessage:
+		var cmd SendMessageCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleBroadcast(&BroadcastMessage{
+				Client:            c,
+				RoomID:            cmd.RoomID,
+				Content:           cmd.Content,
+				Format:            cmd.Format,
+				ClientMsgID:       cmd.ClientMsgID,
+				ParentID:          cmd.ParentID,
+				AlsoSendToChannel: cmd.AlsoSendToChannel,
+				ReplyToID:         cmd.ReplyToID,
+				AttachmentIDs:     cmd.AttachmentIDs,
+				Poll:              cmd.Poll,
+				RequestID:         cmd.RequestID,
+			})
+		}
+	case CommandTyping:
+		var cmd TypingCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.typing <- &TypingMessage{
+				Client:    c,
+				RoomID:    cmd.RoomID,
+				RequestID: cmd.RequestID,
+			}
 		}
-	case "send_message":
-		c.hub.broadcast <- &BroadcastMessage{
-			Client:  c,
-			RoomID:  wsMsg.RoomID,
-			Content: wsMsg.Content,
+	case CommandEditMessage:
+		var cmd EditMessageCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleEditMessage(c, &cmd)
 		}
-	case "typing":
-		c.hub.typing <- &TypingMessage{
-			Client: c,
-			RoomID: wsMsg.RoomID,
+	case CommandForwardMessage:
+		var cmd ForwardMessageCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleForwardMessage(c, &cmd)
+		}
+	case CommandMarkRead:
+		var cmd MarkReadCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleMarkRead(c, &cmd)
+		}
+	case CommandDeleteMessage:
+		var cmd DeleteMessageCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleDeleteMessage(c, &cmd)
+		}
+	case CommandAddReaction, CommandRemoveReaction:
+		var cmd ReactionCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleReaction(c, &cmd, wsMsg.Type == CommandAddReaction)
+		}
+	case CommandVotePoll:
+		var cmd VotePollCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleVotePoll(c, &cmd)
+		}
+	case CommandSync:
+		var cmd SyncCommand
+		if c.decode(wsMsg, raw, &cmd) {
+			c.hub.handleSync(c, &cmd)
 		}
 	default:
-		c.sendError("Unknown message type")
+		c.reject(wsMsg.RequestID, "Unknown message type")
+	}
+}
+
+// decode unmarshals a frame into its command payload and validates it with
+// the same binding rules the REST DTOs use.
+func (c *Client) decode(header WSMessage, raw []byte, cmd interface{}) bool {
+	if err := json.Unmarshal(raw, cmd); err != nil {
+		c.reject(header.RequestID, "Invalid payload: "+err.Error())
+		return false
 	}
+	if err := binding.Validator.ValidateStruct(cmd); err != nil {
+		c.reject(header.RequestID, "Invalid payload: "+err.Error())
+		return false
+	}
+	return true
 }
 
-func (c *Client) sendMessage(response WSResponse) {
-	response.Timestamp = time.Now()
-	data, err := json.Marshal(response)
+// reject answers a frame with an error from outside the hub goroutine, which
+// does every send, since the hub may close the send channel.
+func (c *Client) reject(requestID, message string) {
+	c.hub.commands <- func() { c.sendError(requestID, message) }
+}
+
+// sendMessage queues an event for the client. It must run on the hub
+// goroutine.
+func (c *Client) sendMessage(event Event) {
+	// Dropped clients have a closed send channel
+	if !c.hub.clients[c] {
+		return
+	}
+
+	event.envelope().Timestamp = time.Now()
+	data, err := json.Marshal(event)
 	if err != nil {
 		log.Printf("error marshaling response: %v", err)
 		return
 	}
 
+	// A client too slow to keep up is disconnected. It can catch up on
+	// what it missed with sync after reconnecting.
 	select {
 	case c.send <- data:
 	default:
-		close(c.send)
-		delete(c.hub.clients, c)
+		c.hub.dropClient(c)
+	}
+}
+
+// sendAck answers a command that carried a request_id. Commands without one
+// get no ack, as before request IDs existed.
+func (c *Client) sendAck(requestID string, ack *AckEvent) {
+	if requestID == "" {
+		return
 	}
+	ack.Type = EventAck
+	ack.RequestID = requestID
+	c.sendMessage(ack)
 }
 
-func (c *Client) sendError(message string) {
-	c.sendMessage(WSResponse{
-		Type:  "error",
-		Error: message,
+func (c *Client) sendError(requestID, message string) {
+	c.sendMessage(&ErrorEvent{
+		Envelope: Envelope{Type: EventError, RequestID: requestID},
+		Error:    message,
 	})
-}
\ No newline at end of file
+}
@@ -0,0 +1,355 @@
+package ws
+
+import (
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+)
+
+type EventType string
+
+// Client -> server commands.
+const (
+	CommandJoinRoom       EventType = "join_room"
+	CommandLeaveRoom      EventType = "leave_room"
+	CommandSendMessage    EventType = "send_message"
+	CommandTyping         EventType = "typing"
+	CommandEditMessage    EventType = "edit_message"
+	CommandDeleteMessage  EventType = "delete_message"
+	CommandAddReaction    EventType = "add_reaction"
+	CommandRemoveReaction EventType = "remove_reaction"
+	CommandVotePoll       EventType = "vote_poll"
+	CommandForwardMessage EventType = "forward_message"
+	CommandMarkRead       EventType = "mark_read"
+	CommandSync           EventType = "sync"
+)
+
+// Server -> client events.
+const (
+	EventConnected        EventType = "connected"
+	EventJoinedRoom       EventType = "joined_room"
+	EventLeftRoom         EventType = "left_room"
+	EventUserJoined       EventType = "user_joined"
+	EventUserLeft         EventType = "user_left"
+	EventUserTyping       EventType = "user_typing"
+	EventNewMessage       EventType = "new_message"
+	EventMessageEdited    EventType = "message_edited"
+	EventMessageDeleted   EventType = "message_deleted"
+	EventMessageUpdated   EventType = "message_updated"
+	EventMessagePinned    EventType = "message_pinned"
+	EventMessageUnpinned  EventType = "message_unpinned"
+	EventSavedItem        EventType = "saved_item_updated"
+	EventSavedItemRemoved EventType = "saved_item_removed"
+	EventScheduledJob     EventType = "scheduled_updated"
+	EventReminder         EventType = "reminder"
+	EventReactionAdded    EventType = "reaction_added"
+	EventReactionRemoved  EventType = "reaction_removed"
+	EventPollUpdated      EventType = "poll_updated"
+	EventThreadUpdated    EventType = "thread_updated"
+	EventMentioned        EventType = "mentioned"
+	EventReadPosition     EventType = "read_position"
+	EventSynced           EventType = "synced"
+	EventAck              EventType = "ack"
+	EventError            EventType = "error"
+)
+
+// WSMessage is the header of every client frame. The frame is decoded a
+// second time into the payload type registered for its command.
+type WSMessage struct {
+	Type EventType `json:"type"`
+
+	// RequestID is chosen by the client and echoed in the ack or error
+	// answering this command.
+	RequestID string `json:"request_id,omitempty" binding:"max=64"`
+}
+
+type JoinRoomCommand struct {
+	WSMessage
+	RoomID uint `json:"room_id" binding:"required"`
+}
+
+type LeaveRoomCommand struct {
+	WSMessage
+	RoomID uint `json:"room_id" binding:"required"`
+}
+
+type SendMessageCommand struct {
+	WSMessage
+	RoomID  uint   `json:"room_id" binding:"required"`
+	Content string `json:"content" binding:"max=1000"`
+
+	// Format is plain, the default, or markdown.
+	Format string `json:"format,omitempty" binding:"omitempty,oneof=plain markdown"`
+
+	// AttachmentIDs sends files uploaded over HTTP with the message, which
+	// may then have no content.
+	AttachmentIDs []uint `json:"attachment_ids,omitempty" binding:"max=10"`
+
+	// ClientMsgID makes retries safe: resending it returns the original
+	// message in the ack instead of posting a duplicate.
+	ClientMsgID string `json:"client_msg_id,omitempty" binding:"max=64"`
+
+	// ParentID posts the message as a thread reply; AlsoSendToChannel
+	// shows the reply in the main timeline too.
+	ParentID          uint `json:"parent_id,omitempty"`
+	AlsoSendToChannel bool `json:"also_send_to_channel,omitempty"`
+
+	// ReplyToID quotes an earlier message of the room inline.
+	ReplyToID uint `json:"reply_to_id,omitempty"`
+
+	// Poll sends the message as a poll, asking its question.
+	Poll *models.PollInput `json:"poll,omitempty"`
+}
+
+type TypingCommand struct {
+	WSMessage
+	RoomID uint `json:"room_id" binding:"required"`
+}
+
+type EditMessageCommand struct {
+	WSMessage
+	MessageID uint   `json:"message_id" binding:"required"`
+	Content   string `json:"content" binding:"required,min=1,max=1000"`
+}
+
+type DeleteMessageCommand struct {
+	WSMessage
+	MessageID uint `json:"message_id" binding:"required"`
+}
+
+// ForwardMessageCommand copies a message into another room the user belongs
+// to. The target room does not have to be joined on this connection.
+type ForwardMessageCommand struct {
+	WSMessage
+	MessageID   uint   `json:"message_id" binding:"required"`
+	RoomID      uint   `json:"room_id" binding:"required"`
+	ClientMsgID string `json:"client_msg_id,omitempty" binding:"max=64"`
+}
+
+// MarkReadCommand moves the user's read position in a room forward.
+type MarkReadCommand struct {
+	WSMessage
+	RoomID    uint `json:"room_id" binding:"required"`
+	MessageID uint `json:"message_id" binding:"required"`
+}
+
+// SyncCommand asks for everything that changed in a room after Since. The
+// answer is a synced event carrying the same request_id.
+type SyncCommand struct {
+	WSMessage
+	RoomID uint   `json:"room_id" binding:"required"`
+	Since  uint64 `json:"since"`
+	Limit  int    `json:"limit,omitempty" binding:"min=0,max=500"`
+}
+
+// ReactionCommand is the payload of add_reaction and remove_reaction.
+type ReactionCommand struct {
+	WSMessage
+	MessageID uint   `json:"message_id" binding:"required"`
+	Emoji     string `json:"emoji" binding:"required,max=64"`
+}
+
+// VotePollCommand replaces the user's votes on a poll; no options takes them
+// back.
+type VotePollCommand struct {
+	WSMessage
+	MessageID uint   `json:"message_id" binding:"required"`
+	OptionIDs []uint `json:"option_ids" binding:"max=10"`
+}
+
+// Envelope is embedded in every server frame.
+type Envelope struct {
+	Type      EventType `json:"type"`
+	RequestID string    `json:"request_id,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+
+	// Seq is set on events reporting a change to a room: the change's
+	// number in the room's sequence. A room's events arrive in seq order and
+	// events for one change share it, so a jump of more than one means
+	// events were missed and the client should sync.
+	Seq uint64 `json:"seq,omitempty"`
+}
+
+func (e *Envelope) envelope() *Envelope {
+	return e
+}
+
+// Event is any server -> client frame.
+type Event interface {
+	envelope() *Envelope
+}
+
+type ConnectedEvent struct {
+	Envelope
+	Protocol string       `json:"protocol"`
+	User     *models.User `json:"user"`
+	Content  string       `json:"content"`
+}
+
+// RoomStatusEvent confirms a join_room or leave_room to the requesting client.
+type RoomStatusEvent struct {
+	Envelope
+	RoomID  uint   `json:"room_id"`
+	Content string `json:"content"`
+}
+
+// PresenceEvent tells room members that someone joined, left or is typing.
+type PresenceEvent struct {
+	Envelope
+	RoomID  uint         `json:"room_id"`
+	User    *models.User `json:"user"`
+	Content string       `json:"content,omitempty"`
+}
+
+// MessageEvent carries a message that was posted or changed.
+type MessageEvent struct {
+	Envelope
+	RoomID  uint            `json:"room_id"`
+	Message *models.Message `json:"message"`
+}
+
+// AckEvent confirms that the command with the same request_id succeeded.
+// For send_message it carries the persisted message's ID and creation time so
+// clients can reconcile optimistic sends; Duplicate is set when the send
+// repeated an earlier client_msg_id.
+type AckEvent struct {
+	Envelope
+	Command   EventType  `json:"command"`
+	RoomID    uint       `json:"room_id,omitempty"`
+	MessageID uint       `json:"message_id,omitempty"`
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Duplicate bool       `json:"duplicate,omitempty"`
+}
+
+// ThreadUpdatedEvent is sent for each new thread reply instead of
+// new_message, so timelines can update the root's counters without showing
+// the reply. Clients with the thread open append Reply. It is also sent
+// without Reply when a deleted reply lowers the counters.
+type ThreadUpdatedEvent struct {
+	Envelope
+	RoomID      uint            `json:"room_id"`
+	RootID      uint            `json:"root_id"`
+	ReplyCount  int             `json:"reply_count"`
+	LastReplyAt *time.Time      `json:"last_reply_at,omitempty"`
+	Reply       *models.Message `json:"reply,omitempty"`
+}
+
+// MentionedEvent is sent only to a mentioned user, on every connection they
+// have open.
+type MentionedEvent struct {
+	Envelope
+	RoomID  uint               `json:"room_id"`
+	Kind    models.MentionKind `json:"kind"`
+	Text    string             `json:"text"` // the message without formatting, for notifications
+	Message *models.Message    `json:"message"`
+}
+
+// SavedItemEvent is sent only to the user who owns the saved item, on every
+// connection they have open, so their sessions stay in step.
+type SavedItemEvent struct {
+	Envelope
+	Item *models.SavedItem `json:"saved_item"`
+}
+
+// ScheduledJobEvent is sent to every connection of the user who scheduled the
+// job when it fires. Sent jobs are gone from the user's list afterwards.
+type ScheduledJobEvent struct {
+	Envelope
+	Job *models.ScheduledJob `json:"scheduled"`
+}
+
+// ReadPositionEvent tells a room how far one of its members has read.
+type ReadPositionEvent struct {
+	Envelope
+	models.ReadPosition
+}
+
+// SyncedEvent answers a sync command. Seq is the sequence number the client
+// has caught up to.
+type SyncedEvent struct {
+	Envelope
+	RoomID   uint             `json:"room_id"`
+	Messages []models.Message `json:"messages"`
+	Seq      uint64           `json:"seq"`
+	HasMore  bool             `json:"has_more"`
+}
+
+type MessageDeletedEvent struct {
+	Envelope
+	RoomID    uint      `json:"room_id"`
+	MessageID uint      `json:"message_id"`
+	DeletedBy uint      `json:"deleted_by"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// ReactionEvent reports a reaction change with the emoji's new count.
+type ReactionEvent struct {
+	Envelope
+	models.ReactionChange
+}
+
+// PollUpdatedEvent carries a poll's tallies after a vote or after it was
+// closed. Voters are only listed on public polls.
+type PollUpdatedEvent struct {
+	Envelope
+	RoomID    uint         `json:"room_id"`
+	MessageID uint         `json:"message_id"`
+	Poll      *models.Poll `json:"poll"`
+}
+
+type ErrorEvent struct {
+	Envelope
+	Error string `json:"error"`
+}
+
+// EventSpec describes one frame type of the protocol.
+type EventSpec struct {
+	Type    EventType
+	Summary string
+	Payload interface{}
+}
+
+// Commands lists every frame a client may send, with the payload it is decoded into.
+var Commands = []EventSpec{
+	{CommandJoinRoom, "Subscribe to a room's live events", JoinRoomCommand{}},
+	{CommandLeaveRoom, "Unsubscribe from a room", LeaveRoomCommand{}},
+	{CommandSendMessage, "Post a message to a joined room", SendMessageCommand{}},
+	{CommandTyping, "Signal that the user is typing in a joined room", TypingCommand{}},
+	{CommandEditMessage, "Edit one of the user's own messages", EditMessageCommand{}},
+	{CommandDeleteMessage, "Delete an own message, or any message as a room moderator", DeleteMessageCommand{}},
+	{CommandAddReaction, "React to a message with an emoji", ReactionCommand{}},
+	{CommandRemoveReaction, "Take back a reaction", ReactionCommand{}},
+	{CommandVotePoll, "Vote on a poll, replacing the user's earlier votes", VotePollCommand{}},
+	{CommandForwardMessage, "Forward a message to another room the user belongs to", ForwardMessageCommand{}},
+	{CommandMarkRead, "Mark a room as read up to a message", MarkReadCommand{}},
+	{CommandSync, "Fetch everything that changed in a room after a sequence number", SyncCommand{}},
+}
+
+// Events lists every frame the server may send.
+var Events = []EventSpec{
+	{EventConnected, "Sent once after the connection is registered", ConnectedEvent{}},
+	{EventJoinedRoom, "Confirms a join_room command", RoomStatusEvent{}},
+	{EventLeftRoom, "Confirms a leave_room command", RoomStatusEvent{}},
+	{EventUserJoined, "Another user subscribed to the room", PresenceEvent{}},
+	{EventUserLeft, "Another user unsubscribed from the room", PresenceEvent{}},
+	{EventUserTyping, "Another user is typing in the room", PresenceEvent{}},
+	{EventNewMessage, "A message was posted to the room's timeline", MessageEvent{}},
+	{EventMessageEdited, "A message in the room was edited", MessageEvent{}},
+	{EventMessageDeleted, "A message in the room was deleted", MessageDeletedEvent{}},
+	{EventMessageUpdated, "The server added to a message, such as its link previews", MessageEvent{}},
+	{EventMessagePinned, "A moderator pinned a message to the room", MessageEvent{}},
+	{EventMessageUnpinned, "A moderator unpinned a message", MessageEvent{}},
+	{EventSavedItem, "The user saved a message or changed a saved item's note, in any session", SavedItemEvent{}},
+	{EventSavedItemRemoved, "The user removed a saved item, in any session", SavedItemEvent{}},
+	{EventScheduledJob, "One of the user's scheduled messages was sent, or failed to send", ScheduledJobEvent{}},
+	{EventReminder, "A reminder the user set is due; the job carries the message", ScheduledJobEvent{}},
+	{EventReactionAdded, "Someone reacted to a message in the room", ReactionEvent{}},
+	{EventReactionRemoved, "Someone took back a reaction", ReactionEvent{}},
+	{EventPollUpdated, "Someone voted on a poll in the room, or it was closed", PollUpdatedEvent{}},
+	{EventThreadUpdated, "A reply was posted to or deleted from a thread in the room", ThreadUpdatedEvent{}},
+	{EventMentioned, "The user was mentioned in a room they belong to", MentionedEvent{}},
+	{EventReadPosition, "A member of the room read further", ReadPositionEvent{}},
+	{EventSynced, "Answer to a sync command", SyncedEvent{}},
+	{EventAck, "A command carrying a request_id succeeded", AckEvent{}},
+	{EventError, "A command failed; carries its request_id if it had one", ErrorEvent{}},
+}
@@ -11,10 +11,17 @@ type Hub struct {
 	rooms      map[uint]map[*Client]bool
 	Register   chan *Client
 	unregister chan *Client
-	broadcast  chan *BroadcastMessage
-	joinRoom   chan *JoinRoomRequest
 	leaveRoom  chan *LeaveRoomRequest
 	typing     chan *TypingMessage
+	publish    chan *roomEvent
+	// commands runs functions on the hub goroutine, which owns the client
+	// and room maps. WS command handlers make their service calls on the
+	// client's read goroutine and only pass their replies and broadcasts in,
+	// so a slow query never stalls the hub.
+	commands   chan func()
+	// order keeps each room's events in seq order.
+	order      map[uint]*roomOrder
+	presence   *Presence
 	chatService ChatService
 }
 
@@ -22,41 +29,69 @@ type BroadcastMessage struct {
 	Client *Client
 	RoomID uint
 	Content string
+	Format string
+	ClientMsgID string
+	ParentID uint
+	AlsoSendToChannel bool
+	ReplyToID uint
+	AttachmentIDs []uint
+	Poll *models.PollInput
+	RequestID string
 }
 
 type JoinRoomRequest struct {
 	Client *Client
 	RoomID uint
 	Content string
+	RequestID string
 }
 
 type LeaveRoomRequest struct {
 	Client *Client
 	RoomID uint
 	Content string
+	RequestID string
 }
 
 type TypingMessage struct {
 	Client *Client
 	RoomID uint
+	RequestID string
+}
+
+// roomEvent is an event produced outside the hub, e.g. by a REST handler,
+// waiting to be fanned out to a room's subscribers.
+type roomEvent struct {
+	roomID uint
+	event  Event
 }
 
 type ChatService interface {
-	CreateMessage(userID, roomID uint, content string) (*models.Message, error)
+	CreateMessage(userID, roomID uint, input models.MessageInput) (*models.Message, bool, error)
 	CanUserAccessRoom(userID, roomID uint) (bool, error)
 	GetRoomMembers(roomID uint) ([]models.User, error)
+	EditMessage(userID, messageID uint, content string) (*models.Message, bool, error)
+	DeleteMessage(userID, messageID uint) (*models.Message, error)
+	AddReaction(userID, messageID uint, emoji string) (*models.ReactionChange, bool, error)
+	RemoveReaction(userID, messageID uint, emoji string) (*models.ReactionChange, bool, error)
+	VotePoll(userID, messageID uint, optionIDs []uint) (*models.PollChange, bool, error)
+	ForwardMessage(userID, messageID, roomID uint, clientMsgID string) (*models.Message, bool, error)
+	MarkRead(userID, roomID, messageID uint) (*models.ReadPosition, bool, error)
+	Sync(userID, roomID uint, since uint64, limit int) (*models.SyncResult, error)
 }
 
-func NewHub(chatService ChatService) *Hub {
+func NewHub(chatService ChatService, presence *Presence) *Hub {
 	return &Hub{
 		clients:     make(map[*Client]bool),
 		rooms:       make(map[uint]map[*Client]bool),
 		Register:    make(chan *Client),
 		unregister:  make(chan *Client),
-		broadcast:   make(chan *BroadcastMessage),
-		joinRoom:    make(chan *JoinRoomRequest),
 		leaveRoom:   make(chan *LeaveRoomRequest),
 		typing:      make(chan *TypingMessage),
+		publish:     make(chan *roomEvent),
+		commands:    make(chan func()),
+		order:       make(map[uint]*roomOrder),
+		presence:    presence,
 		chatService: chatService,
 	}
 }
@@ -66,38 +101,33 @@ func (h *Hub) Run() {
 		select {
 		case client := <-h.Register:
 			h.clients[client] = true
+			h.presence.connect(client.user.ID)
 			log.Printf("Client connected: %s", client.user.Username)
 
-			client.sendMessage(WSResponse{
-				Type:    "connected",
-				Content: "Successfully connected to chat",
-				User:    client.user,
+			client.sendMessage(&ConnectedEvent{
+				Envelope: Envelope{Type: EventConnected},
+				Protocol: client.protocol,
+				Content:  "Successfully connected to chat",
+				User:     client.user,
 			})
 
 		case client := <-h.unregister:
 			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
-
-				// Remove client from all rooms
-				for roomID := range client.rooms {
-					h.removeClientFromRoom(client, roomID)
-				}
-
+				h.dropClient(client)
 				log.Printf("Client disconnected: %s", client.user.Username)
 			}
 
-		case joinReq := <-h.joinRoom:
-			h.handleJoinRoom(joinReq)
-
 		case leaveReq := <-h.leaveRoom:
 			h.handleLeaveRoom(leaveReq)
 
-		case broadcastMsg := <-h.broadcast:
-			h.handleBroadcast(broadcastMsg)
-
 		case typingMsg := <-h.typing:
 			h.handleTyping(typingMsg)
+
+		case ev := <-h.publish:
+			h.broadcastToRoom(ev.roomID, ev.event, nil)
+
+		case command := <-h.commands:
+			command()
 		}
 	}
 }
@@ -106,7 +136,16 @@ func (h *Hub) handleJoinRoom(req *JoinRoomRequest) {
 	// Check if user can access room
 	canAccess, err := h.chatService.CanUserAccessRoom(req.Client.user.ID, req.RoomID)
 	if err != nil || !canAccess {
-		req.Client.sendError("Cannot access this room")
+		req.Client.reject(req.RequestID, "Cannot access this room")
+		return
+	}
+
+	h.commands <- func() { h.addClientToRoom(req) }
+}
+
+func (h *Hub) addClientToRoom(req *JoinRoomRequest) {
+	// A client dropped meanwhile must not linger in the room
+	if !h.clients[req.Client] {
 		return
 	}
 
@@ -119,18 +158,19 @@ func (h *Hub) handleJoinRoom(req *JoinRoomRequest) {
 	req.Client.rooms[req.RoomID] = true
 
 	// Notify client
-	req.Client.sendMessage(WSResponse{
-		Type:   "joined_room",
-		RoomID: req.RoomID,
-		Content: "Successfully joined room",
+	req.Client.sendMessage(&RoomStatusEvent{
+		Envelope: Envelope{Type: EventJoinedRoom},
+		RoomID:   req.RoomID,
+		Content:  "Successfully joined room",
 	})
+	req.Client.sendAck(req.RequestID, &AckEvent{Command: CommandJoinRoom, RoomID: req.RoomID})
 
 	// Notify other room members
-	h.broadcastToRoom(req.RoomID, WSResponse{
-		Type:    "user_joined",
-		RoomID:  req.RoomID,
-		User:    req.Client.user,
-		Content: req.Client.user.Username + " joined the room",
+	h.broadcastToRoom(req.RoomID, &PresenceEvent{
+		Envelope: Envelope{Type: EventUserJoined},
+		RoomID:   req.RoomID,
+		User:     req.Client.user,
+		Content:  req.Client.user.Username + " joined the room",
 	}, req.Client)
 
 	log.Printf("User %s joined room %d", req.Client.user.Username, req.RoomID)
@@ -139,18 +179,19 @@ func (h *Hub) handleJoinRoom(req *JoinRoomRequest) {
 func (h *Hub) handleLeaveRoom(req *LeaveRoomRequest) {
 	h.removeClientFromRoom(req.Client, req.RoomID)
 
-	req.Client.sendMessage(WSResponse{
-		Type:   "left_room",
-		RoomID: req.RoomID,
-		Content: "Successfully left room",
+	req.Client.sendMessage(&RoomStatusEvent{
+		Envelope: Envelope{Type: EventLeftRoom},
+		RoomID:   req.RoomID,
+		Content:  "Successfully left room",
 	})
+	req.Client.sendAck(req.RequestID, &AckEvent{Command: CommandLeaveRoom, RoomID: req.RoomID})
 
 	// Notify other room members
-	h.broadcastToRoom(req.RoomID, WSResponse{
-		Type:    "user_left",
-		RoomID:  req.RoomID,
-		User:    req.Client.user,
-		Content: req.Client.user.Username + " left the room",
+	h.broadcastToRoom(req.RoomID, &PresenceEvent{
+		Envelope: Envelope{Type: EventUserLeft},
+		RoomID:   req.RoomID,
+		User:     req.Client.user,
+		Content:  req.Client.user.Username + " left the room",
 	}, req.Client)
 
 	log.Printf("User %s left room %d", req.Client.user.Username, req.RoomID)
@@ -158,48 +199,283 @@ func (h *Hub) handleLeaveRoom(req *LeaveRoomRequest) {
 
 func (h *Hub) handleBroadcast(broadcastMsg *BroadcastMessage) {
 	// Check if client is in the room
-	if !broadcastMsg.Client.rooms[broadcastMsg.RoomID] {
-		broadcastMsg.Client.sendError("You are not in this room")
+	if !h.inRoom(broadcastMsg.Client, broadcastMsg.RoomID) {
+		broadcastMsg.Client.reject(broadcastMsg.RequestID, "You are not in this room")
 		return
 	}
 
 	// Save message to database
-	message, err := h.chatService.CreateMessage(
+	message, created, err := h.chatService.CreateMessage(
 		broadcastMsg.Client.user.ID,
 		broadcastMsg.RoomID,
-		broadcastMsg.Content,
+		models.MessageInput{
+			Content:           broadcastMsg.Content,
+			Format:            models.MessageFormat(broadcastMsg.Format),
+			ClientMsgID:       broadcastMsg.ClientMsgID,
+			ParentID:          broadcastMsg.ParentID,
+			AlsoSendToChannel: broadcastMsg.AlsoSendToChannel,
+			ReplyToID:         broadcastMsg.ReplyToID,
+			AttachmentIDs:     broadcastMsg.AttachmentIDs,
+			Poll:              broadcastMsg.Poll,
+		},
 	)
 	if err != nil {
-		broadcastMsg.Client.sendError("Failed to save message")
+		broadcastMsg.Client.reject(broadcastMsg.RequestID, err.Error())
 		return
 	}
 
-	// Broadcast to all clients in the room
-	response := WSResponse{
-		Type:    "new_message",
-		RoomID:  broadcastMsg.RoomID,
-		Message: message,
+	h.commands <- func() {
+		broadcastMsg.Client.sendAck(broadcastMsg.RequestID, &AckEvent{
+			Command:   CommandSendMessage,
+			RoomID:    broadcastMsg.RoomID,
+			MessageID: message.ID,
+			CreatedAt: &message.CreatedAt,
+			Duplicate: !created,
+		})
+
+		// A retried send was already broadcast the first time
+		if !created {
+			return
+		}
+
+		// Broadcast to all clients in the room
+		h.fanOutMessage(message)
+	}
+}
+
+// inRoom reports whether a client joined a room. The client's rooms belong
+// to the hub goroutine, so it is asked there.
+func (h *Hub) inRoom(client *Client, roomID uint) bool {
+	in := make(chan bool, 1)
+	h.commands <- func() { in <- client.rooms[roomID] }
+	return <-in
+}
+
+// fanOutMessage delivers a new message to its room and to the users it
+// mentions. Thread replies update the thread's counters and only reach the
+// timeline when also sent there.
+func (h *Hub) fanOutMessage(message *models.Message) {
+	h.notifyMentions(message)
+
+	if message.ThreadRootID != nil {
+		event := &ThreadUpdatedEvent{
+			Envelope: Envelope{Type: EventThreadUpdated, Seq: message.Seq},
+			RoomID:   message.RoomID,
+			RootID:   *message.ThreadRootID,
+			Reply:    message,
+		}
+		if message.ThreadRoot != nil {
+			event.ReplyCount = message.ThreadRoot.ReplyCount
+			event.LastReplyAt = message.ThreadRoot.LastReplyAt
+		}
+		h.broadcastToRoom(message.RoomID, event, nil)
+
+		if !message.ShowInChannel {
+			return
+		}
+	}
+
+	h.broadcastToRoom(message.RoomID, &MessageEvent{
+		Envelope: Envelope{Type: EventNewMessage, Seq: message.Seq},
+		RoomID:   message.RoomID,
+		Message:  message,
+	}, nil)
+}
+
+// notifyMentions tells each user mentioned in a new message about it on all
+// their connections, whether or not they joined the room on them.
+func (h *Hub) notifyMentions(message *models.Message) {
+	for _, mention := range message.Mentions {
+		h.sendToUser(mention.UserID, &MentionedEvent{
+			Envelope: Envelope{Type: EventMentioned},
+			RoomID:   message.RoomID,
+			Kind:     mention.Kind,
+			Text:     message.PlainText,
+			Message:  message,
+		})
 	}
+}
 
-	h.broadcastToRoom(broadcastMsg.RoomID, response, nil)
+func (h *Hub) sendToUser(userID uint, event Event) {
+	for client := range h.clients {
+		if client.user.ID == userID {
+			client.sendMessage(event)
+		}
+	}
 }
 
 func (h *Hub) handleTyping(typingMsg *TypingMessage) {
 	// Check if client is in the room
 	if !typingMsg.Client.rooms[typingMsg.RoomID] {
+		if typingMsg.RequestID != "" {
+			typingMsg.Client.sendError(typingMsg.RequestID, "You are not in this room")
+		}
 		return
 	}
+	typingMsg.Client.sendAck(typingMsg.RequestID, &AckEvent{Command: CommandTyping, RoomID: typingMsg.RoomID})
 
 	// Broadcast typing indicator to other room members
-	response := WSResponse{
-		Type:   "user_typing",
-		RoomID: typingMsg.RoomID,
-		User:   typingMsg.Client.user,
+	response := &PresenceEvent{
+		Envelope: Envelope{Type: EventUserTyping},
+		RoomID:   typingMsg.RoomID,
+		User:     typingMsg.Client.user,
 	}
 
 	h.broadcastToRoom(typingMsg.RoomID, response, typingMsg.Client)
 }
 
+func (h *Hub) handleEditMessage(client *Client, cmd *EditMessageCommand) {
+	message, _, err := h.chatService.EditMessage(client.user.ID, cmd.MessageID, cmd.Content)
+	if err != nil {
+		client.reject(cmd.RequestID, err.Error())
+		return
+	}
+
+	// The service published the edit, if there was one
+	h.commands <- func() {
+		client.sendAck(cmd.RequestID, &AckEvent{
+			Command:   CommandEditMessage,
+			RoomID:    message.RoomID,
+			MessageID: message.ID,
+		})
+	}
+}
+
+func (h *Hub) handleForwardMessage(client *Client, cmd *ForwardMessageCommand) {
+	message, created, err := h.chatService.ForwardMessage(client.user.ID, cmd.MessageID, cmd.RoomID, cmd.ClientMsgID)
+	if err != nil {
+		client.reject(cmd.RequestID, err.Error())
+		return
+	}
+
+	h.commands <- func() {
+		client.sendAck(cmd.RequestID, &AckEvent{
+			Command:   CommandForwardMessage,
+			RoomID:    message.RoomID,
+			MessageID: message.ID,
+			CreatedAt: &message.CreatedAt,
+			Duplicate: !created,
+		})
+		if created {
+			h.fanOutMessage(message)
+		}
+	}
+}
+
+func (h *Hub) handleMarkRead(client *Client, cmd *MarkReadCommand) {
+	position, moved, err := h.chatService.MarkRead(client.user.ID, cmd.RoomID, cmd.MessageID)
+	if err != nil {
+		client.reject(cmd.RequestID, err.Error())
+		return
+	}
+
+	h.commands <- func() {
+		client.sendAck(cmd.RequestID, &AckEvent{
+			Command:   CommandMarkRead,
+			RoomID:    position.RoomID,
+			MessageID: position.MessageID,
+		})
+		if moved {
+			h.broadcastToRoom(position.RoomID, readPositionEvent(position), nil)
+		}
+	}
+}
+
+func (h *Hub) handleSync(client *Client, cmd *SyncCommand) {
+	result, err := h.chatService.Sync(client.user.ID, cmd.RoomID, cmd.Since, cmd.Limit)
+	if err != nil {
+		client.reject(cmd.RequestID, err.Error())
+		return
+	}
+
+	event := &SyncedEvent{
+		Envelope: Envelope{Type: EventSynced, RequestID: cmd.RequestID},
+		RoomID:   result.RoomID,
+		Messages: result.Messages,
+		Seq:      result.Seq,
+		HasMore:  result.HasMore,
+	}
+	h.commands <- func() { client.sendMessage(event) }
+}
+
+func (h *Hub) handleDeleteMessage(client *Client, cmd *DeleteMessageCommand) {
+	message, err := h.chatService.DeleteMessage(client.user.ID, cmd.MessageID)
+	if err != nil {
+		client.reject(cmd.RequestID, err.Error())
+		return
+	}
+
+	// The service published the deletion
+	h.commands <- func() {
+		client.sendAck(cmd.RequestID, &AckEvent{
+			Command:   CommandDeleteMessage,
+			RoomID:    message.RoomID,
+			MessageID: message.ID,
+		})
+	}
+}
+
+func (h *Hub) handleReaction(client *Client, cmd *ReactionCommand, add bool) {
+	react := h.chatService.RemoveReaction
+	command := CommandRemoveReaction
+	if add {
+		react = h.chatService.AddReaction
+		command = CommandAddReaction
+	}
+
+	change, changed, err := react(client.user.ID, cmd.MessageID, cmd.Emoji)
+	if err != nil {
+		client.reject(cmd.RequestID, err.Error())
+		return
+	}
+
+	h.commands <- func() {
+		client.sendAck(cmd.RequestID, &AckEvent{
+			Command:   command,
+			RoomID:    change.RoomID,
+			MessageID: change.MessageID,
+		})
+		if changed {
+			h.broadcastToRoom(change.RoomID, reactionEvent(change, add), nil)
+		}
+	}
+}
+
+func (h *Hub) handleVotePoll(client *Client, cmd *VotePollCommand) {
+	change, changed, err := h.chatService.VotePoll(client.user.ID, cmd.MessageID, cmd.OptionIDs)
+	if err != nil {
+		client.reject(cmd.RequestID, err.Error())
+		return
+	}
+
+	h.commands <- func() {
+		client.sendAck(cmd.RequestID, &AckEvent{
+			Command:   CommandVotePoll,
+			RoomID:    change.RoomID,
+			MessageID: change.MessageID,
+		})
+		if changed {
+			h.broadcastToRoom(change.RoomID, pollUpdated(change), nil)
+		}
+	}
+}
+
+// dropClient forgets a client and closes its send channel, which makes its
+// write pump close the connection.
+func (h *Hub) dropClient(client *Client) {
+	if _, ok := h.clients[client]; !ok {
+		return
+	}
+	delete(h.clients, client)
+	h.presence.disconnect(client.user.ID)
+	close(client.send)
+
+	// Remove client from all rooms
+	for roomID := range client.rooms {
+		h.removeClientFromRoom(client, roomID)
+	}
+}
+
 func (h *Hub) removeClientFromRoom(client *Client, roomID uint) {
 	if h.rooms[roomID] != nil {
 		delete(h.rooms[roomID], client)
@@ -210,7 +486,17 @@ func (h *Hub) removeClientFromRoom(client *Client, roomID uint) {
 	delete(client.rooms, roomID)
 }
 
-func (h *Hub) broadcastToRoom(roomID uint, response WSResponse, exclude *Client) {
+// broadcastToRoom sends an event to a room's subscribers. Events reporting a
+// change go out in the order of the room's sequence.
+func (h *Hub) broadcastToRoom(roomID uint, response Event, exclude *Client) {
+	if response.envelope().Seq != 0 {
+		h.publishInOrder(roomID, response, exclude)
+		return
+	}
+	h.deliver(roomID, response, exclude)
+}
+
+func (h *Hub) deliver(roomID uint, response Event, exclude *Client) {
 	if roomClients, exists := h.rooms[roomID]; exists {
 		for client := range roomClients {
 			if client != exclude {
@@ -220,6 +506,152 @@ func (h *Hub) broadcastToRoom(roomID uint, response WSResponse, exclude *Client)
 	}
 }
 
+// BroadcastToRoom sends an event to every live subscriber of a room. It is
+// safe to call from outside the hub's goroutine.
+func (h *Hub) BroadcastToRoom(roomID uint, event Event) {
+	h.publish <- &roomEvent{roomID: roomID, event: event}
+}
+
+// PublishMessage fans a message created outside the hub out to its room.
+func (h *Hub) PublishMessage(message *models.Message) {
+	h.commands <- func() { h.fanOutMessage(message) }
+}
+
+// PublishMessageEdited tells a room's subscribers that a message was edited.
+func (h *Hub) PublishMessageEdited(message *models.Message) {
+	h.BroadcastToRoom(message.RoomID, messageEdited(message))
+}
+
+func messageEdited(message *models.Message) *MessageEvent {
+	return &MessageEvent{
+		Envelope: Envelope{Type: EventMessageEdited, Seq: message.UpdatedSeq},
+		RoomID:   message.RoomID,
+		Message:  message,
+	}
+}
+
+// PublishMessageUpdated tells a room's subscribers that the server changed a
+// message after it was posted, without its author editing it.
+func (h *Hub) PublishMessageUpdated(message *models.Message) {
+	h.BroadcastToRoom(message.RoomID, &MessageEvent{
+		Envelope: Envelope{Type: EventMessageUpdated, Seq: message.UpdatedSeq},
+		RoomID:   message.RoomID,
+		Message:  message,
+	})
+}
+
+// PublishMessagePinned tells a room's subscribers that a message was pinned
+// or unpinned.
+func (h *Hub) PublishMessagePinned(message *models.Message, pinned bool) {
+	eventType := EventMessageUnpinned
+	if pinned {
+		eventType = EventMessagePinned
+	}
+	h.BroadcastToRoom(message.RoomID, &MessageEvent{
+		Envelope: Envelope{Type: eventType, Seq: message.UpdatedSeq},
+		RoomID:   message.RoomID,
+		Message:  message,
+	})
+}
+
+// PublishSavedItem tells all of a user's connections that one of their saved
+// items was saved, changed or removed.
+func (h *Hub) PublishSavedItem(item *models.SavedItem, removed bool) {
+	eventType := EventSavedItem
+	if removed {
+		eventType = EventSavedItemRemoved
+	}
+	event := &SavedItemEvent{Envelope: Envelope{Type: eventType}, Item: item}
+	h.commands <- func() { h.sendToUser(item.UserID, event) }
+}
+
+// PublishScheduledJob tells all of a user's connections that one of their
+// scheduled messages or reminders fired.
+func (h *Hub) PublishScheduledJob(job *models.ScheduledJob) {
+	eventType := EventScheduledJob
+	if job.Kind == models.ScheduledReminder && job.Status == models.ScheduledSent {
+		eventType = EventReminder
+	}
+	event := &ScheduledJobEvent{Envelope: Envelope{Type: eventType}, Job: job}
+	h.commands <- func() { h.sendToUser(job.UserID, event) }
+}
+
+// PublishThreadUpdated tells a room's subscribers a thread's counters after a
+// reply was deleted.
+func (h *Hub) PublishThreadUpdated(root *models.Message) {
+	h.BroadcastToRoom(root.RoomID, &ThreadUpdatedEvent{
+		Envelope:    Envelope{Type: EventThreadUpdated, Seq: root.UpdatedSeq},
+		RoomID:      root.RoomID,
+		RootID:      root.ID,
+		ReplyCount:  root.ReplyCount,
+		LastReplyAt: root.LastReplyAt,
+	})
+}
+
+// PublishMessageDeleted tells a room's subscribers that a message was deleted.
+func (h *Hub) PublishMessageDeleted(message *models.Message) {
+	h.BroadcastToRoom(message.RoomID, messageDeleted(message))
+}
+
+func messageDeleted(message *models.Message) *MessageDeletedEvent {
+	event := &MessageDeletedEvent{
+		Envelope:  Envelope{Type: EventMessageDeleted, Seq: message.UpdatedSeq},
+		RoomID:    message.RoomID,
+		MessageID: message.ID,
+	}
+	if message.Tombstone != nil {
+		event.DeletedBy = message.Tombstone.DeletedBy
+		event.DeletedAt = message.Tombstone.DeletedAt
+	}
+	return event
+}
+
+// PublishReaction tells a room's subscribers that a reaction was added or removed.
+func (h *Hub) PublishReaction(change *models.ReactionChange, added bool) {
+	h.BroadcastToRoom(change.RoomID, reactionEvent(change, added))
+}
+
+// PublishPollUpdated tells a room's subscribers a poll's new tallies.
+func (h *Hub) PublishPollUpdated(change *models.PollChange) {
+	h.BroadcastToRoom(change.RoomID, pollUpdated(change))
+}
+
+// pollUpdated builds the poll_updated event for a change. The poll loses the
+// votes of the user who changed it, which are theirs alone to see.
+func pollUpdated(change *models.PollChange) *PollUpdatedEvent {
+	poll := *change.Poll
+	poll.MyVotes = nil
+	return &PollUpdatedEvent{
+		Envelope:  Envelope{Type: EventPollUpdated, Seq: change.Seq},
+		RoomID:    change.RoomID,
+		MessageID: change.MessageID,
+		Poll:      &poll,
+	}
+}
+
+func reactionEvent(change *models.ReactionChange, added bool) *ReactionEvent {
+	eventType := EventReactionRemoved
+	if added {
+		eventType = EventReactionAdded
+	}
+	return &ReactionEvent{
+		Envelope:       Envelope{Type: eventType, Seq: change.Seq},
+		ReactionChange: *change,
+	}
+}
+
+// PublishReadPosition tells a room that one of its members read further.
+func (h *Hub) PublishReadPosition(position *models.ReadPosition) {
+	h.BroadcastToRoom(position.RoomID, readPositionEvent(position))
+}
+
+func readPositionEvent(position *models.ReadPosition) *ReadPositionEvent {
+	return &ReadPositionEvent{
+		Envelope:     Envelope{Type: EventReadPosition},
+		ReadPosition: *position,
+	}
+}
+
 func (h *Hub) GetOnlineUsers(roomID uint) []*models.User {
 	var users []*models.User
 	if roomClients, exists := h.rooms[roomID]; exists {
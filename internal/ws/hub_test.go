@@ -0,0 +1,288 @@
+package ws
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Shobayosamuel/tap-me/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+// fakeChatService answers the calls the tests make; the rest of ChatService
+// is left nil. Sync blocks until release is closed.
+type fakeChatService struct {
+	ChatService
+	release chan struct{}
+}
+
+func (f *fakeChatService) CanUserAccessRoom(userID, roomID uint) (bool, error) {
+	return roomID == 1, nil
+}
+
+func (f *fakeChatService) Sync(userID, roomID uint, since uint64, limit int) (*models.SyncResult, error) {
+	<-f.release
+	return &models.SyncResult{RoomID: roomID, Seq: since}, nil
+}
+
+func (f *fakeChatService) CreateMessage(userID, roomID uint, input models.MessageInput) (*models.Message, bool, error) {
+	return &models.Message{ID: 1, UserID: userID, RoomID: roomID, Content: input.Content, Seq: 1, UpdatedSeq: 1}, true, nil
+}
+
+func (f *fakeChatService) MarkRead(userID, roomID, messageID uint) (*models.ReadPosition, bool, error) {
+	if messageID == 0 {
+		return nil, false, errors.New("message not found")
+	}
+	return &models.ReadPosition{RoomID: roomID, UserID: userID, MessageID: messageID}, true, nil
+}
+
+func newTestHub(t *testing.T) (*Hub, *fakeChatService) {
+	t.Helper()
+	service := &fakeChatService{release: make(chan struct{})}
+	hub := NewHub(service, NewPresence())
+	go hub.Run()
+	return hub, service
+}
+
+// connect registers a client without a connection; its events are read
+// straight from its send channel.
+func connect(t *testing.T, hub *Hub, id uint) *Client {
+	t.Helper()
+	client := NewClient(hub, nil, &models.User{ID: id, Username: "user"}, ProtocolV1)
+	hub.Register <- client
+	expectEvent(t, client, EventConnected)
+	return client
+}
+
+// command feeds a client frame through the same dispatch as ReadPump.
+func command(client *Client, frame string) {
+	var header WSMessage
+	json.Unmarshal([]byte(frame), &header)
+	client.handleMessage(header, []byte(frame))
+}
+
+func expectEvent(t *testing.T, client *Client, eventType EventType) map[string]interface{} {
+	t.Helper()
+	select {
+	case data := <-client.send:
+		var event map[string]interface{}
+		if err := json.Unmarshal(data, &event); err != nil {
+			t.Fatal(err)
+		}
+		if event["type"] != string(eventType) {
+			t.Fatalf("got %s event %s, want %s", event["type"], data, eventType)
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatalf("no %s event", eventType)
+		return nil
+	}
+}
+
+func TestSlowCommandDoesNotStallHub(t *testing.T) {
+	hub, service := newTestHub(t)
+	slow := connect(t, hub, 1)
+	other := connect(t, hub, 2)
+
+	synced := make(chan struct{})
+	go func() {
+		command(slow, `{"type":"sync","request_id":"s1","room_id":1}`)
+		close(synced)
+	}()
+
+	// The hub keeps serving other clients while the sync's query runs
+	go command(other, `{"type":"mark_read","request_id":"r1","room_id":1,"message_id":5}`)
+	ack := expectEvent(t, other, EventAck)
+	if ack["request_id"] != "r1" {
+		t.Fatalf("ack for %v, want r1", ack["request_id"])
+	}
+
+	close(service.release)
+	<-synced
+	if event := expectEvent(t, slow, EventSynced); event["request_id"] != "s1" {
+		t.Fatalf("synced for %v, want s1", event["request_id"])
+	}
+}
+
+func TestCommandErrorsAreReported(t *testing.T) {
+	hub, _ := newTestHub(t)
+	client := connect(t, hub, 1)
+
+	command(client, `{"type":"mark_read","request_id":"r1","room_id":1,"message_id":0}`)
+	event := expectEvent(t, client, EventError)
+	if event["request_id"] != "r1" {
+		t.Fatalf("error for %v, want r1", event["request_id"])
+	}
+
+	command(client, `{"type":"join_room","request_id":"j1","room_id":2}`)
+	event = expectEvent(t, client, EventError)
+	if event["request_id"] != "j1" || event["error"] != "Cannot access this room" {
+		t.Fatalf("join of a forbidden room answered %v", event)
+	}
+
+	command(client, `{"type":"send_message","request_id":"m1","room_id":1,"content":"hi"}`)
+	event = expectEvent(t, client, EventError)
+	if event["request_id"] != "m1" || event["error"] != "You are not in this room" {
+		t.Fatalf("send to an unjoined room answered %v", event)
+	}
+}
+
+func TestJoinRoom(t *testing.T) {
+	hub, _ := newTestHub(t)
+	client := connect(t, hub, 1)
+
+	command(client, `{"type":"join_room","request_id":"j1","room_id":1}`)
+	expectEvent(t, client, EventJoinedRoom)
+	expectEvent(t, client, EventAck)
+	if !hub.inRoom(client, 1) {
+		t.Fatal("client not in the room it joined")
+	}
+}
+
+// dial connects a client to the hub over a real WebSocket, as the chat
+// handler does.
+func dial(t *testing.T, hub *Hub, id uint) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		client := NewClient(hub, conn, &models.User{ID: id, Username: "user"}, ProtocolV1)
+		hub.Register <- client
+		go client.WritePump()
+		go client.ReadPump()
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readUntil reads events off a connection until one of the given type
+// arrives. Several events may share a frame, one per line.
+func readUntil(t *testing.T, conn *websocket.Conn, eventType EventType) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		_, frame, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("waiting for %s: %v", eventType, err)
+		}
+		for _, line := range bytes.Split(frame, []byte("\n")) {
+			var event map[string]interface{}
+			if err := json.Unmarshal(line, &event); err != nil {
+				t.Fatal(err)
+			}
+			if event["type"] == string(EventError) {
+				t.Fatalf("waiting for %s: got error %v", eventType, event["error"])
+			}
+			if event["type"] == string(eventType) {
+				return event
+			}
+		}
+	}
+}
+
+func TestLongMessageOverWebSocket(t *testing.T) {
+	hub, _ := newTestHub(t)
+	conn := dial(t, hub, 1)
+	readUntil(t, conn, EventConnected)
+
+	conn.WriteJSON(map[string]interface{}{"type": "join_room", "request_id": "j1", "room_id": 1})
+	readUntil(t, conn, EventJoinedRoom)
+
+	// 1000 characters of 4 bytes each, and a poll, in one frame
+	options := make([]string, 10)
+	for i := range options {
+		options[i] = strings.Repeat(string(rune('a'+i)), 100)
+	}
+	err := conn.WriteJSON(map[string]interface{}{
+		"type":       "send_message",
+		"request_id": "m1",
+		"room_id":    1,
+		"content":    strings.Repeat("😀", 1000),
+		"poll":       map[string]interface{}{"question": strings.Repeat("?", 300), "options": options},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for {
+		if ack := readUntil(t, conn, EventAck); ack["request_id"] == "m1" {
+			return
+		}
+	}
+}
+
+// joinedClient connects a client and joins it to room 1.
+func joinedClient(t *testing.T, hub *Hub, id uint) *Client {
+	t.Helper()
+	client := connect(t, hub, id)
+	command(client, `{"type":"join_room","request_id":"j1","room_id":1}`)
+	expectEvent(t, client, EventJoinedRoom)
+	expectEvent(t, client, EventAck)
+	return client
+}
+
+func expectSeq(t *testing.T, client *Client, seq uint64) {
+	t.Helper()
+	event := expectEvent(t, client, EventNewMessage)
+	if event["seq"] != float64(seq) {
+		t.Fatalf("got seq %v, want %d", event["seq"], seq)
+	}
+}
+
+func TestRoomEventsInSeqOrder(t *testing.T) {
+	hub, _ := newTestHub(t)
+	client := joinedClient(t, hub, 1)
+
+	// The room's first change settles where its sequence stands
+	hub.PublishMessage(&models.Message{ID: 1, RoomID: 1, Seq: 1})
+	expectSeq(t, client, 1)
+
+	// Changes committed in order reach the hub in any order
+	const changes = 50
+	var wg sync.WaitGroup
+	for seq := uint64(2); seq <= changes+1; seq++ {
+		wg.Add(1)
+		go func(seq uint64) {
+			defer wg.Done()
+			hub.PublishMessage(&models.Message{ID: uint(seq), RoomID: 1, Seq: seq})
+		}(seq)
+	}
+	wg.Wait()
+	for seq := uint64(2); seq <= changes+1; seq++ {
+		expectSeq(t, client, seq)
+	}
+}
+
+func TestRoomEventsSkipMissingChange(t *testing.T) {
+	hub, _ := newTestHub(t)
+	client := joinedClient(t, hub, 1)
+	hub.PublishMessage(&models.Message{ID: 1, RoomID: 1, Seq: 1})
+	expectSeq(t, client, 1)
+
+	// Seq 2 is never published; seq 3 goes out once it stops waiting
+	start := time.Now()
+	hub.PublishMessage(&models.Message{ID: 3, RoomID: 1, Seq: 3})
+	expectSeq(t, client, 3)
+	if waited := time.Since(start); waited < reorderWait {
+		t.Fatalf("seq 3 sent after %v, before giving seq 2 %v", waited, reorderWait)
+	}
+
+	// Events without a seq are never held
+	hub.BroadcastToRoom(1, &PresenceEvent{Envelope: Envelope{Type: EventUserTyping}, RoomID: 1})
+	hub.PublishMessage(&models.Message{ID: 5, RoomID: 1, Seq: 5})
+	expectEvent(t, client, EventUserTyping)
+}
@@ -0,0 +1,117 @@
+package ws
+
+import "time"
+
+// reorderWait is how long a room's events wait for an earlier change that
+// has not been published yet. Changes take their seq in the database on many
+// goroutines and reach the hub in whatever order those finish, usually a few
+// milliseconds apart.
+const reorderWait = 250 * time.Millisecond
+
+// roomOrder puts a room's events back in seq order before they are sent.
+// It belongs to the hub goroutine.
+type roomOrder struct {
+	// last is the highest seq sent; known is false until the room's first
+	// events have settled.
+	last  uint64
+	known bool
+
+	// held are events waiting for an earlier seq, since the time the first
+	// of them arrived. flushing is set while a flush is scheduled.
+	held     map[uint64][]heldEvent
+	since    time.Time
+	flushing bool
+}
+
+type heldEvent struct {
+	event   Event
+	exclude *Client
+}
+
+// publishInOrder sends an event reporting a change to a room once every
+// earlier change has been sent. Events for one change share a seq and go
+// out together. A change that never arrives holds the room up for at most
+// reorderWait; clients then see the gap and sync.
+func (h *Hub) publishInOrder(roomID uint, event Event, exclude *Client) {
+	seq := event.envelope().Seq
+	order := h.order[roomID]
+	if order == nil {
+		order = &roomOrder{held: make(map[uint64][]heldEvent)}
+		h.order[roomID] = order
+
+		// Nobody is listening, so the room can start from here
+		if len(h.rooms[roomID]) == 0 {
+			order.last, order.known = seq, true
+		}
+	}
+
+	if order.known && seq <= order.last+1 {
+		h.deliver(roomID, event, exclude)
+		if seq > order.last {
+			order.last = seq
+			h.releaseHeld(roomID, order)
+		}
+		return
+	}
+
+	if len(order.held) == 0 {
+		order.since = time.Now()
+	}
+	order.held[seq] = append(order.held[seq], heldEvent{event: event, exclude: exclude})
+	h.scheduleFlush(roomID, order, reorderWait)
+}
+
+// releaseHeld sends the held events that have become next in line.
+func (h *Hub) releaseHeld(roomID uint, order *roomOrder) {
+	for {
+		events, ok := order.held[order.last+1]
+		if !ok {
+			break
+		}
+		delete(order.held, order.last+1)
+		order.last++
+		for _, held := range events {
+			h.deliver(roomID, held.event, held.exclude)
+		}
+
+		// What is still held now waits for a new gap
+		order.since = time.Now()
+	}
+}
+
+// scheduleFlush runs flushHeld on the hub goroutine after wait.
+func (h *Hub) scheduleFlush(roomID uint, order *roomOrder, wait time.Duration) {
+	if order.flushing {
+		return
+	}
+	order.flushing = true
+	time.AfterFunc(wait, func() {
+		h.commands <- func() { h.flushHeld(roomID) }
+	})
+}
+
+// flushHeld gives up on the changes a room's held events have waited
+// reorderWait for and sends the held events from the lowest seq on.
+func (h *Hub) flushHeld(roomID uint) {
+	order := h.order[roomID]
+	order.flushing = false
+	if len(order.held) == 0 {
+		return
+	}
+	if wait := reorderWait - time.Since(order.since); wait > 0 {
+		h.scheduleFlush(roomID, order, wait)
+		return
+	}
+
+	first := uint64(0)
+	for seq := range order.held {
+		if first == 0 || seq < first {
+			first = seq
+		}
+	}
+	order.last, order.known = first-1, true
+	h.releaseHeld(roomID, order)
+	if len(order.held) > 0 {
+		h.scheduleFlush(roomID, order, reorderWait)
+	}
+}
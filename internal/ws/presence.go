@@ -0,0 +1,38 @@
+package ws
+
+import "sync"
+
+// Presence tracks which users have at least one open connection. The hub
+// keeps it up to date; unlike the hub's own maps it may be read from any
+// goroutine, including services called by WS command handlers.
+type Presence struct {
+	mu     sync.RWMutex
+	online map[uint]int
+}
+
+func NewPresence() *Presence {
+	return &Presence{online: make(map[uint]int)}
+}
+
+// IsOnline reports whether the user has any open connection.
+func (p *Presence) IsOnline(userID uint) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.online[userID] > 0
+}
+
+func (p *Presence) connect(userID uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.online[userID]++
+}
+
+func (p *Presence) disconnect(userID uint) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.online[userID] <= 1 {
+		delete(p.online, userID)
+		return
+	}
+	p.online[userID]--
+}
@@ -0,0 +1,85 @@
+package ws
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ProtocolV1 is the current version of the chat protocol. Clients ask for it
+// with the Sec-WebSocket-Protocol header or the "protocol" query parameter;
+// clients that ask for nothing get the current version.
+const ProtocolV1 = "tapme.v1"
+
+// Close codes in the 4000-4999 range are reserved for applications.
+const (
+	CloseUnsupportedProtocol = 4400
+	CloseDeprecatedProtocol  = 4410
+)
+
+// SupportedProtocols lists the protocol versions the server speaks, newest first.
+var SupportedProtocols = []string{ProtocolV1}
+
+// deprecatedProtocols maps versions that are no longer served to the close
+// reason sent to clients that still ask for them. Move a version here from
+// SupportedProtocols when it is retired.
+var deprecatedProtocols = map[string]string{}
+
+// NegotiateProtocol picks the protocol version for a handshake. When no
+// supported version was requested it returns the close code and reason to
+// send once the connection is upgraded.
+func NegotiateProtocol(r *http.Request) (version string, closeCode int, reason string) {
+	requested := websocket.Subprotocols(r)
+	if q := r.URL.Query().Get("protocol"); q != "" {
+		requested = append(requested, q)
+	}
+	if len(requested) == 0 {
+		return SupportedProtocols[0], 0, ""
+	}
+
+	for _, v := range requested {
+		for _, supported := range SupportedProtocols {
+			if v == supported {
+				return v, 0, ""
+			}
+		}
+	}
+	for _, v := range requested {
+		if why, ok := deprecatedProtocols[v]; ok {
+			return "", CloseDeprecatedProtocol, fmt.Sprintf("protocol %s is deprecated: %s", v, why)
+		}
+	}
+	return "", CloseUnsupportedProtocol, fmt.Sprintf("unsupported protocol %q, supported: %s",
+		strings.Join(requested, ","), strings.Join(SupportedProtocols, ","))
+}
+
+// ProtocolHeader builds the handshake response header for a negotiated
+// version. Browsers fail the handshake outright when none of their requested
+// subprotocols is echoed, so otherwise the client's first choice is echoed to
+// let the close frame and its reason reach the client.
+func ProtocolHeader(r *http.Request, version string) http.Header {
+	requested := websocket.Subprotocols(r)
+	if len(requested) == 0 {
+		return nil
+	}
+	for _, v := range requested {
+		if v == version {
+			return http.Header{"Sec-Websocket-Protocol": {v}}
+		}
+	}
+	return http.Header{"Sec-Websocket-Protocol": {requested[0]}}
+}
+
+// CloseWithReason sends a close frame and closes the connection. Used when a
+// handshake completed but the session cannot continue.
+func CloseWithReason(conn *websocket.Conn, code int, reason string) {
+	// Control frame payloads are limited to 125 bytes, two of which are the code.
+	if len(reason) > 123 {
+		reason = reason[:123]
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+	conn.Close()
+}